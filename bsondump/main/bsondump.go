@@ -3,11 +3,13 @@ package main
 
 import (
 	"github.com/dezmodue/mongo-tools/bsondump"
+	"github.com/dezmodue/mongo-tools/common/json"
 	"github.com/dezmodue/mongo-tools/common/log"
 	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/signals"
 	"github.com/dezmodue/mongo-tools/common/util"
 	"os"
+	"strings"
 )
 
 func main() {
@@ -61,6 +63,12 @@ func main() {
 		os.Exit(util.ExitBadOptions)
 	}
 
+	bsonDumpOpts.JSONFormat = strings.ToLower(bsonDumpOpts.JSONFormat)
+	if err = json.ValidateFormat(bsonDumpOpts.JSONFormat); err != nil {
+		log.Logf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	err = dumper.Open()
 	if err != nil {
 		log.Logf(log.Always, "Failed: %v", err)
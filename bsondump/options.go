@@ -14,6 +14,9 @@ type BSONDumpOptions struct {
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
+	// Extended JSON format of JSON output
+	JSONFormat string `long:"jsonFormat" default:"legacy" default-mask:"-" description:"the Extended JSON format to output, either legacy, canonical or relaxed; Decimal128 values ($numberDecimal) are not supported (default 'legacy')"`
+
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 }
@@ -184,6 +184,98 @@ func ParseSpecialKeys(doc map[string]interface{}) (interface{}, error) {
 			return bson.MongoTimestamp(int64(ts.Seconds)<<32 | int64(ts.Increment)), nil
 		}
 
+		if jsonValue, ok := doc["$numberDouble"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				return json.ParseDouble(v)
+			default:
+				return nil, errors.New("expected $numberDouble field to have string value")
+			}
+		}
+
+		if _, ok := doc["$numberDecimal"]; ok {
+			// the BSON library has no Decimal128 type to convert them to
+			return nil, errors.New("decimal values ($numberDecimal) are not supported")
+		}
+
+		if jsonValue, ok := doc["$binary"]; ok {
+			binDoc, ok := jsonValue.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected $binary field to contain a document, or a string with a $type field")
+			}
+			data, ok := binDoc["base64"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have a string 'base64' field")
+			}
+			subType, ok := binDoc["subType"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have a string 'subType' field")
+			}
+			bytes, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, err
+			}
+			if len(subType) == 1 {
+				subType = "0" + subType
+			}
+			kind, err := hex.DecodeString(subType)
+			if err != nil {
+				return nil, err
+			} else if len(kind) != 1 {
+				return nil, errors.New("expected single byte (as hexadecimal string) for $binary 'subType' field")
+			}
+			return bson.Binary{Kind: kind[0], Data: bytes}, nil
+		}
+
+		if jsonValue, ok := doc["$regularExpression"]; ok {
+			regexDoc, ok := jsonValue.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected $regularExpression field to contain a document")
+			}
+			pattern, ok := regexDoc["pattern"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have a string 'pattern' field")
+			}
+			options, ok := regexDoc["options"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have a string 'options' field")
+			}
+			return bson.RegEx{Pattern: pattern, Options: options}, nil
+		}
+
+		if jsonValue, ok := doc["$symbol"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				return bson.Symbol(v), nil
+			default:
+				return nil, errors.New("expected $symbol field to have string value")
+			}
+		}
+
+		if jsonValue, ok := doc["$dbPointer"]; ok {
+			pointerDoc, ok := jsonValue.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected $dbPointer field to contain a document")
+			}
+			namespace, ok := pointerDoc["$ref"].(string)
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have a string $ref field")
+			}
+			idDoc, ok := pointerDoc["$id"].(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have an $id field containing an $oid")
+			}
+			id, err := ParseSpecialKeys(idDoc)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing $id field: %v", err)
+			}
+			objectId, ok := id.(bson.ObjectId)
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have an $id field containing an $oid")
+			}
+			return bson.DBPointer{Namespace: namespace, Id: objectId}, nil
+		}
+
 		if _, ok := doc["$undefined"]; ok {
 			return bson.Undefined, nil
 		}
@@ -359,11 +451,59 @@ func ParseJSONValue(jsonValue interface{}) (interface{}, error) {
 	case map[string]interface{}: // subdocument
 		return ParseSpecialKeys(v)
 
+	case bson.D: // ordered subdocument
+		// extended JSON types never depend on key order, but other '$' keys,
+		// such as query operators and pipeline stages, may
+		if isExtendedJSON(v) {
+			return ParseSpecialKeys(specialKeysMap(v))
+		}
+		return ConvertJSONValueToBSON(v)
+
 	default:
 		return ConvertJSONValueToBSON(v)
 	}
 }
 
+// extendedJSONKeys are the keys of the extended JSON types that
+// ParseSpecialKeys converts.
+var extendedJSONKeys = map[string]bool{
+	"$binary": true, "$code": true, "$date": true, "$db": true, "$dbPointer": true,
+	"$id": true, "$maxKey": true, "$minKey": true, "$numberDecimal": true,
+	"$numberDouble": true, "$numberInt": true, "$numberLong": true, "$oid": true,
+	"$options": true, "$ref": true, "$regex": true, "$regularExpression": true,
+	"$scope": true, "$symbol": true, "$timestamp": true, "$type": true,
+	"$undefined": true,
+}
+
+// isExtendedJSON returns true if the ordered document only has the keys of
+// extended JSON types.
+func isExtendedJSON(doc bson.D) bool {
+	if len(doc) == 0 || len(doc) > 3 {
+		return false
+	}
+	for _, elem := range doc {
+		if !extendedJSONKeys[elem.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// specialKeysMap converts an ordered document holding an extended JSON type,
+// and the documents nested in it, to the map form expected by
+// ParseSpecialKeys.
+func specialKeysMap(doc bson.D) map[string]interface{} {
+	m := make(map[string]interface{}, len(doc))
+	for _, elem := range doc {
+		if subdoc, ok := elem.Value.(bson.D); ok {
+			m[elem.Name] = specialKeysMap(subdoc)
+		} else {
+			m[elem.Name] = elem.Value
+		}
+	}
+	return m
+}
+
 func parseNumberLongField(jsonValue interface{}) (int64, error) {
 	switch v := jsonValue.(type) {
 	case string:
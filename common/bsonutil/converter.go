@@ -30,6 +30,16 @@ func ConvertJSONValueToBSON(x interface{}) (interface{}, error) {
 		}
 		return v, nil
 
+	case bson.D: // ordered document
+		for i := range v {
+			bsonValue, err := ParseJSONValue(v[i].Value)
+			if err != nil {
+				return nil, err
+			}
+			v[i].Value = bsonValue
+		}
+		return v, nil
+
 	case []interface{}: // array
 		for i, jsonValue := range v {
 			bsonValue, err := ParseJSONValue(jsonValue)
@@ -335,3 +335,33 @@ func TestJSCodeBSONToJSON(t *testing.T) {
 		})
 	})
 }
+
+func TestOrderedDocumentJSONToBSON(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Converting an ordered JSON document to BSON", t, func() {
+		Convey("should keep the key order and convert extended JSON values", func() {
+			jsonDoc, err := json.UnmarshalOrdered([]byte(
+				`{"b": {"$date": {"$numberLong": "1000"}}, "a": {"y": ObjectId("5437e5e3d4e63d1ad3d2e1e4"), "x": 1}}`))
+			So(err, ShouldBeNil)
+			bsonDoc, err := ParseJSONValue(jsonDoc)
+			So(err, ShouldBeNil)
+			So(bsonDoc, ShouldResemble, bson.D{
+				{"b", time.Unix(1, 0)},
+				{"a", bson.D{{"y", bson.ObjectIdHex("5437e5e3d4e63d1ad3d2e1e4")}, {"x", int32(1)}}},
+			})
+		})
+
+		Convey("should keep the order of '$' keys that aren't extended JSON", func() {
+			jsonDoc, err := json.UnmarshalOrdered([]byte(
+				`{"n": {"$lt": 5, "$gte": 1}, "ts": {"$timestamp": {"t": 1, "i": 2}}}`))
+			So(err, ShouldBeNil)
+			bsonDoc, err := ParseJSONValue(jsonDoc)
+			So(err, ShouldBeNil)
+			So(bsonDoc, ShouldResemble, bson.D{
+				{"n", bson.D{{"$lt", int32(5)}, {"$gte", int32(1)}}},
+				{"ts", bson.MongoTimestamp(1<<32 | 2)},
+			})
+		})
+	})
+}
@@ -0,0 +1,225 @@
+package bsonutil
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ConvertBSONValueToExtJSON is like ConvertBSONValueToJSON, but converts to
+// the given Extended JSON format: json.LegacyFormat is the format produced by
+// ConvertBSONValueToJSON, while json.CanonicalFormat and json.RelaxedFormat
+// are the modes of Extended JSON v2.
+func ConvertBSONValueToExtJSON(x interface{}, format string) (interface{}, error) {
+	if format == "" || format == json.LegacyFormat {
+		return ConvertBSONValueToJSON(x)
+	}
+	canonical := format == json.CanonicalFormat
+
+	switch v := x.(type) {
+	case nil:
+		return nil, nil
+	case bool, string:
+		return v, nil
+
+	case *bson.M: // document
+		return convertMapToExtJSON(*v, format)
+	case bson.M: // document
+		return convertMapToExtJSON(v, format)
+	case map[string]interface{}:
+		return convertMapToExtJSON(v, format)
+	case bson.D:
+		doc := make(MarshalD, 0, len(v))
+		for _, elem := range v {
+			jsonValue, err := ConvertBSONValueToExtJSON(elem.Value, format)
+			if err != nil {
+				return nil, err
+			}
+			doc = append(doc, bson.DocElem{elem.Name, jsonValue})
+		}
+		return doc, nil
+	case []interface{}: // array
+		array := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			jsonValue, err := ConvertBSONValueToExtJSON(elem, format)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, jsonValue)
+		}
+		return array, nil
+
+	case int:
+		return convertIntToExtJSON(int64(v), canonical), nil
+	case int32:
+		if canonical {
+			return wrapExtJSON("$numberInt", strconv.FormatInt(int64(v), 10)), nil
+		}
+		return json.NumberInt(v), nil
+	case int64:
+		if canonical {
+			return wrapExtJSON("$numberLong", strconv.FormatInt(v, 10)), nil
+		}
+		return v, nil
+	case float32:
+		return convertDoubleToExtJSON(float64(v), canonical), nil
+	case float64:
+		return convertDoubleToExtJSON(v, canonical), nil
+
+	case bson.ObjectId:
+		return wrapExtJSON("$oid", v.Hex()), nil
+
+	case time.Time:
+		millis := v.Unix()*1000 + int64(v.Nanosecond()/1e6)
+		// relaxed mode uses ISO-8601 strings for dates they can represent
+		if year := v.UTC().Year(); !canonical && year >= 1970 && year <= 9999 {
+			return wrapExtJSON("$date", v.UTC().Format(json.JSON_DATE_FORMAT)), nil
+		}
+		return wrapExtJSON("$date", wrapExtJSON("$numberLong", strconv.FormatInt(millis, 10))), nil
+
+	case []byte:
+		return convertBinaryToExtJSON(0x00, v), nil
+	case bson.Binary:
+		return convertBinaryToExtJSON(v.Kind, v.Data), nil
+
+	case bson.RegEx:
+		return wrapExtJSON("$regularExpression", MarshalD{
+			{"pattern", v.Pattern},
+			{"options", v.Options},
+		}), nil
+
+	case bson.MongoTimestamp:
+		timestamp := int64(v)
+		return wrapExtJSON("$timestamp", MarshalD{
+			{"t", uint32(timestamp >> 32)},
+			{"i", uint32(timestamp)},
+		}), nil
+
+	case bson.JavaScript:
+		if v.Scope == nil {
+			return wrapExtJSON("$code", v.Code), nil
+		}
+		scope, err := ConvertBSONValueToExtJSON(v.Scope, format)
+		if err != nil {
+			return nil, err
+		}
+		return MarshalD{{"$code", v.Code}, {"$scope", scope}}, nil
+
+	case bson.Symbol:
+		return wrapExtJSON("$symbol", string(v)), nil
+
+	case mgo.DBRef:
+		// DBRefs are ordinary documents in Extended JSON v2
+		id, err := ConvertBSONValueToExtJSON(v.Id, format)
+		if err != nil {
+			return nil, err
+		}
+		doc := MarshalD{{"$ref", v.Collection}, {"$id", id}}
+		if v.Database != "" {
+			doc = append(doc, bson.DocElem{"$db", v.Database})
+		}
+		return doc, nil
+
+	case bson.DBPointer:
+		return wrapExtJSON("$dbPointer", MarshalD{
+			{"$ref", v.Namespace},
+			{"$id", wrapExtJSON("$oid", v.Id.Hex())},
+		}), nil
+	}
+
+	switch x {
+	case bson.MinKey:
+		return wrapExtJSON("$minKey", 1), nil
+	case bson.MaxKey:
+		return wrapExtJSON("$maxKey", 1), nil
+	case bson.Undefined:
+		return wrapExtJSON("$undefined", true), nil
+	}
+
+	return nil, fmt.Errorf("conversion of BSON type '%v' not supported %v", reflect.TypeOf(x), x)
+}
+
+func convertMapToExtJSON(doc map[string]interface{}, format string) (interface{}, error) {
+	converted := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		jsonValue, err := ConvertBSONValueToExtJSON(value, format)
+		if err != nil {
+			return nil, err
+		}
+		converted[key] = jsonValue
+	}
+	return converted, nil
+}
+
+// convertIntToExtJSON converts a Go int, which mgo uses for BSON int32 values
+// on 64-bit platforms, to the smallest integer type that holds it.
+func convertIntToExtJSON(n int64, canonical bool) interface{} {
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		if canonical {
+			return wrapExtJSON("$numberLong", strconv.FormatInt(n, 10))
+		}
+		return n
+	}
+	if canonical {
+		return wrapExtJSON("$numberInt", strconv.FormatInt(n, 10))
+	}
+	return json.NumberInt(n)
+}
+
+func convertDoubleToExtJSON(f float64, canonical bool) interface{} {
+	// relaxed mode uses plain numbers for all doubles that JSON can represent
+	if canonical || math.IsInf(f, 0) || math.IsNaN(f) {
+		return wrapExtJSON("$numberDouble", json.FormatDouble(f))
+	}
+	return json.NumberFloat(f)
+}
+
+func convertBinaryToExtJSON(kind byte, data []byte) interface{} {
+	return wrapExtJSON("$binary", MarshalD{
+		{"base64", base64.StdEncoding.EncodeToString(data)},
+		{"subType", fmt.Sprintf("%02x", kind)},
+	})
+}
+
+// wrapExtJSON returns the single field document {key: value}.
+func wrapExtJSON(key string, value interface{}) MarshalD {
+	return MarshalD{{key, value}}
+}
+
+// CheckExtJSONV2 returns an error if a value decoded by the json package uses
+// shell syntax, such as ObjectId(...) or NumberLong(...), which is allowed in
+// legacy extended JSON but not in Extended JSON v2.
+func CheckExtJSONV2(x interface{}) error {
+	switch v := x.(type) {
+	case map[string]interface{}:
+		for _, value := range v {
+			if err := CheckExtJSONV2(value); err != nil {
+				return err
+			}
+		}
+	case bson.D:
+		for _, elem := range v {
+			if err := CheckExtJSONV2(elem.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, elem := range v {
+			if err := CheckExtJSONV2(elem); err != nil {
+				return err
+			}
+		}
+	case json.BinData, json.Date, json.ISODate, json.DBRef, json.DBPointer, json.MinKey,
+		json.MaxKey, json.NumberInt, json.NumberLong, json.NumberFloat, json.ObjectId,
+		json.RegExp, json.Timestamp, json.JavaScript, json.Undefined:
+		return fmt.Errorf("shell syntax for %v values is not valid Extended JSON v2",
+			reflect.TypeOf(v).Name())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package bsonutil
+
+import (
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"testing"
+	"time"
+)
+
+// toExtJSON converts a BSON value to Extended JSON text in the given format.
+func toExtJSON(value interface{}, format string) string {
+	converted, err := ConvertBSONValueToExtJSON(value, format)
+	So(err, ShouldBeNil)
+	data, err := json.Marshal(converted)
+	So(err, ShouldBeNil)
+	return string(data)
+}
+
+// fromExtJSON parses Extended JSON text into a BSON document.
+func fromExtJSON(data string) bson.M {
+	doc := map[string]interface{}{}
+	So(json.Unmarshal([]byte(data), &doc), ShouldBeNil)
+	So(ConvertJSONDocumentToBSON(doc), ShouldBeNil)
+	return bson.M(doc)
+}
+
+func TestExtJSONV2Output(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Converting BSON values to Extended JSON v2", t, func() {
+		date := time.Date(2015, 6, 1, 12, 30, 0, 5e6, time.UTC)
+		oldDate := time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		Convey("canonical mode should wrap every typed value", func() {
+			So(toExtJSON(int32(5), json.CanonicalFormat), ShouldEqual, `{"$numberInt":"5"}`)
+			So(toExtJSON(5, json.CanonicalFormat), ShouldEqual, `{"$numberInt":"5"}`)
+			So(toExtJSON(int64(5), json.CanonicalFormat), ShouldEqual, `{"$numberLong":"5"}`)
+			So(toExtJSON(1.0, json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"1.0"}`)
+			So(toExtJSON(-1.5e300, json.CanonicalFormat), ShouldEqual, `{"$numberDouble":"-1.5E+300"}`)
+			So(toExtJSON(date, json.CanonicalFormat), ShouldEqual, `{"$date":{"$numberLong":"1433161800005"}}`)
+			So(toExtJSON(bson.Binary{0x80, []byte("hi")}, json.CanonicalFormat),
+				ShouldEqual, `{"$binary":{"base64":"aGk=","subType":"80"}}`)
+			So(toExtJSON(bson.RegEx{"^a", "i"}, json.CanonicalFormat),
+				ShouldEqual, `{"$regularExpression":{"pattern":"^a","options":"i"}}`)
+			So(toExtJSON(bson.D{{"b", int32(1)}, {"a", bson.MaxKey}}, json.CanonicalFormat),
+				ShouldEqual, `{"b":{"$numberInt":"1"},"a":{"$maxKey":1}}`)
+		})
+
+		Convey("relaxed mode should use plain numbers and ISO-8601 dates", func() {
+			So(toExtJSON(int32(5), json.RelaxedFormat), ShouldEqual, `5`)
+			So(toExtJSON(int64(5), json.RelaxedFormat), ShouldEqual, `5`)
+			So(toExtJSON(1.0, json.RelaxedFormat), ShouldEqual, `1.0`)
+			So(toExtJSON(math.Inf(-1), json.RelaxedFormat), ShouldEqual, `{"$numberDouble":"-Infinity"}`)
+			So(toExtJSON(date, json.RelaxedFormat), ShouldEqual, `{"$date":"2015-06-01T12:30:00.005Z"}`)
+			So(toExtJSON(oldDate, json.RelaxedFormat), ShouldEqual, `{"$date":{"$numberLong":"-315619200000"}}`)
+		})
+
+		Convey("legacy mode should match ConvertBSONValueToJSON", func() {
+			So(toExtJSON(int64(5), json.LegacyFormat), ShouldEqual, `{"$numberLong":"5"}`)
+			So(toExtJSON(date, json.LegacyFormat), ShouldEqual, `{"$date":"2015-06-01T12:30:00.005Z"}`)
+		})
+	})
+}
+
+func TestExtJSONV2RoundTrip(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Documents should round trip through canonical Extended JSON", t, func() {
+		original := bson.M{
+			"int":       int32(-7),
+			"long":      int64(1) << 40,
+			"double":    2.5,
+			"infinity":  math.Inf(1),
+			"string":    "s",
+			"bool":      true,
+			"null":      nil,
+			"oid":       bson.ObjectIdHex("5437e5e3d4e63d1ad3d2e1e4"),
+			"binary":    bson.Binary{0x04, []byte{1, 2, 3}},
+			"regex":     bson.RegEx{"x+", "m"},
+			"timestamp": bson.MongoTimestamp(int64(5)<<32 | 6),
+			"code":      bson.JavaScript{Code: "f()"},
+			"symbol":    bson.Symbol("sym"),
+			"pointer":   bson.DBPointer{"db.c", bson.ObjectIdHex("5437e5e3d4e63d1ad3d2e1e4")},
+			"ref":       mgo.DBRef{"c", int32(1), "db"},
+			"minKey":    bson.MinKey,
+			"maxKey":    bson.MaxKey,
+			"undefined": bson.Undefined,
+			"array":     []interface{}{int32(1), "two", map[string]interface{}{"three": int64(3)}},
+			"subdoc":    map[string]interface{}{"a": 1.5},
+		}
+		parsed := fromExtJSON(toExtJSON(original, json.CanonicalFormat))
+		So(parsed, ShouldResemble, original)
+
+		Convey("and dates should keep their millisecond value", func() {
+			date := time.Date(2015, 6, 1, 12, 30, 0, 5e6, time.UTC)
+			for _, format := range []string{json.CanonicalFormat, json.RelaxedFormat} {
+				parsed := fromExtJSON(toExtJSON(bson.M{"d": date}, format))
+				So(parsed["d"].(time.Time).Equal(date), ShouldBeTrue)
+			}
+		})
+	})
+
+	Convey("Documents should round trip through relaxed Extended JSON, up to number types", t, func() {
+		original := bson.M{"int": int32(3), "long": int64(1) << 40, "double": 0.25, "oid": bson.NewObjectId()}
+		parsed := fromExtJSON(toExtJSON(original, json.RelaxedFormat))
+		So(parsed, ShouldResemble, original)
+	})
+
+}
+
+func TestCheckExtJSONV2(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Checking decoded JSON for Extended JSON v2", t, func() {
+		Convey("wrapped values should be accepted", func() {
+			doc, err := json.UnmarshalBsonD([]byte(`{"a": {"$oid": "5437e5e3d4e63d1ad3d2e1e4"}, "b": [1, {"c": 2}]}`))
+			So(err, ShouldBeNil)
+			So(CheckExtJSONV2(doc), ShouldBeNil)
+		})
+		Convey("shell syntax should be rejected, at any depth", func() {
+			doc, err := json.UnmarshalBsonD([]byte(`{"a": [{"b": NumberLong(5)}]}`))
+			So(err, ShouldBeNil)
+			So(CheckExtJSONV2(doc), ShouldNotBeNil)
+		})
+	})
+}
@@ -86,6 +86,13 @@ var (
 //
 // Comma is the field delimiter.  It defaults to ','.
 //
+// Quote is the character quoted fields start and end with.  It defaults
+// to '"'.
+//
+// Escape, if not 0, is the character that makes the character following it
+// within a quoted field part of the field, e.g. '\\' reads "a\"b" as a"b.
+// If it is 0, a quote character within a quoted field is written twice.
+//
 // Comment, if not 0, is the comment character. Lines beginning with the
 // Comment character are ignored.
 //
@@ -101,6 +108,8 @@ var (
 // If TrimLeadingSpace is true, leading white space in a field is ignored.
 type Reader struct {
 	Comma            rune // field delimiter (set to ',' by NewReader)
+	Quote            rune // quote character (set to '"' by NewReader)
+	Escape           rune // escape character within quoted fields
 	Comment          rune // comment character for start of line
 	FieldsPerRecord  int  // number of expected fields per record
 	LazyQuotes       bool // allow lazy quotes
@@ -116,6 +125,7 @@ type Reader struct {
 func NewReader(r io.Reader) *Reader {
 	return &Reader{
 		Comma: ',',
+		Quote: '"',
 		r:     bufio.NewReader(r),
 	}
 }
@@ -249,7 +259,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 	r.field.Reset()
 
 	r1, err := r.readRune()
-	for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+	for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 		r1, err = r.readRune()
 	}
 
@@ -273,11 +283,23 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 		}
 		return true, r1, nil
 
-	case '"':
+	case r.Quote:
 		// quoted field
 	Quoted:
 		for {
 			r1, err = r.readRune()
+			if err == nil && r.Escape != 0 && r.Escape != r.Quote && r1 == r.Escape {
+				// the escaped character is part of the field
+				r1, err = r.readRune()
+				if err == nil {
+					if r1 == '\n' {
+						r.line++
+						r.column = -1
+					}
+					r.field.WriteRune(r1)
+					continue
+				}
+			}
 			if err != nil {
 				if err == io.EOF {
 					if r.LazyQuotes {
@@ -288,17 +310,17 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				return false, 0, err
 			}
 			switch r1 {
-			case '"':
+			case r.Quote:
 				r1, err = r.readRune()
-				if err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
-					for err == nil && r.TrimLeadingSpace && r1 != '\n' && unicode.IsSpace(r1) {
+				if err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
+					for err == nil && r.TrimLeadingSpace && r1 != '\n' && r1 != r.Comma && unicode.IsSpace(r1) {
 						r1, err = r.readRune()
 					}
 					// we don't want '"foo" "bar",' to look like '"foo""bar"'
 					// which evaluates to 'foo"bar'
 					// so we explicitly test for the case that the trimed whitespace isn't
 					// followed by a '"'
-					if err == nil && r1 == '"' {
+					if err == nil && r1 == r.Quote {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
@@ -309,13 +331,13 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 				if r1 == '\n' {
 					return true, r1, nil
 				}
-				if r1 != '"' {
+				if r1 != r.Quote {
 					if !r.LazyQuotes {
 						r.column--
 						return false, 0, r.error(ErrQuote)
 					}
 					// accept the bare quote
-					r.field.WriteRune('"')
+					r.field.WriteRune(r.Quote)
 				}
 			case '\n':
 				r.line++
@@ -342,7 +364,7 @@ func (r *Reader) parseField() (haveField bool, delim rune, err error) {
 			if r1 == '\n' {
 				return true, r1, nil
 			}
-			if !r.LazyQuotes && r1 == '"' {
+			if !r.LazyQuotes && r1 == r.Quote {
 				return false, 0, r.error(ErrBareQuote)
 			}
 		}
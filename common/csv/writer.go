@@ -0,0 +1,186 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A Writer writes records to a CSV encoded file.
+//
+// As returned by NewWriter, a Writer writes records terminated by a
+// newline and uses ',' as the field delimiter and '"' as the quote
+// character.  The exported fields can be changed to customize the details
+// before the first call to Write.
+//
+// Comma is the field delimiter.
+//
+// Quote is the character quoted fields start and end with.
+//
+// Escape, if not 0, is written before each quote and escape character
+// within a quoted field.  If it is 0, quote characters are written twice.
+//
+// If UseCRLF is true, the Writer ends each record with \r\n instead of \n.
+type Writer struct {
+	Comma   rune // field delimiter (set to ',' by NewWriter)
+	Quote   rune // quote character (set to '"' by NewWriter)
+	Escape  rune // escape character within quoted fields
+	UseCRLF bool // true to use \r\n as the line terminator
+	w       *bufio.Writer
+}
+
+// NewWriter returns a new Writer that writes to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		Comma: ',',
+		Quote: '"',
+		w:     bufio.NewWriter(w),
+	}
+}
+
+// Write writes a single CSV record to w along with any necessary quoting.
+// A record is a slice of strings with each string being one field.
+func (w *Writer) Write(record []string) (err error) {
+	for n, field := range record {
+		if n > 0 {
+			if _, err = w.w.WriteRune(w.Comma); err != nil {
+				return
+			}
+		}
+
+		// If we don't have to have a quoted field then just
+		// write out the field and continue to the next field.
+		if !w.fieldNeedsQuotes(field) {
+			if _, err = w.w.WriteString(field); err != nil {
+				return
+			}
+			continue
+		}
+		if _, err = w.w.WriteRune(w.Quote); err != nil {
+			return
+		}
+
+		for _, r1 := range field {
+			switch {
+			case r1 == w.Quote && !w.escaping():
+				_, err = w.w.WriteRune(w.Quote)
+			case r1 == w.Quote || (r1 == w.Escape && w.escaping()):
+				_, err = w.w.WriteRune(w.Escape)
+			case r1 == '\n' && w.UseCRLF:
+				_, err = w.w.WriteRune('\r')
+			}
+			if err != nil {
+				return
+			}
+			if _, err = w.w.WriteRune(r1); err != nil {
+				return
+			}
+		}
+
+		if _, err = w.w.WriteRune(w.Quote); err != nil {
+			return
+		}
+	}
+	if w.UseCRLF {
+		_, err = w.w.WriteString("\r\n")
+	} else {
+		err = w.w.WriteByte('\n')
+	}
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+// To check if an error occurred during the Flush, call Error.
+func (w *Writer) Flush() {
+	w.w.Flush()
+}
+
+// Error reports any error that has occurred during a previous Write or Flush.
+func (w *Writer) Error() error {
+	_, err := w.w.Write(nil)
+	return err
+}
+
+// escaping returns true if quote characters are escaped rather than doubled.
+func (w *Writer) escaping() bool {
+	return w.Escape != 0 && w.Escape != w.Quote
+}
+
+// fieldNeedsQuotes returns true if our field must be enclosed in quotes.
+// Fields with a delimiter, quote, escape or line break need to be quoted,
+// as do fields with leading space, which the Reader trims, and `\.`, which
+// Postgres treats as the end of data.
+func (w *Writer) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	if field == `\.` || strings.ContainsRune(field, w.Comma) ||
+		strings.ContainsRune(field, w.Quote) || strings.ContainsAny(field, "\r\n") ||
+		(w.escaping() && strings.ContainsRune(field, w.Escape)) {
+		return true
+	}
+
+	r1, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r1)
+}
+
+// Dialect holds the characters that delimit, quote and escape CSV fields.
+type Dialect struct {
+	Comma, Quote, Escape rune
+}
+
+// DefaultDialect is the RFC 4180 dialect, in which quote characters within
+// quoted fields are doubled.
+var DefaultDialect = Dialect{Comma: ',', Quote: '"'}
+
+// ParseDialect returns the dialect given by the values of the --delimiter,
+// --quote and --escape options. Empty values are those of DefaultDialect; a
+// tab can also be given as "\t" or "tab".
+func ParseDialect(delimiter, quote, escape string) (dialect Dialect, err error) {
+	dialect = DefaultDialect
+	if delimiter != "" {
+		if dialect.Comma, err = parseCharacter("delimiter", delimiter); err != nil {
+			return
+		}
+	}
+	if quote != "" {
+		if dialect.Quote, err = parseCharacter("quote", quote); err != nil {
+			return
+		}
+	}
+	if escape != "" {
+		if dialect.Escape, err = parseCharacter("escape", escape); err != nil {
+			return
+		}
+	}
+	if dialect.Comma == dialect.Quote {
+		return dialect, fmt.Errorf("--delimiter and --quote can not be the same character")
+	}
+	if dialect.Comma == dialect.Escape {
+		return dialect, fmt.Errorf("--delimiter and --escape can not be the same character")
+	}
+	return dialect, nil
+}
+
+// parseCharacter returns the single character given as the value of the
+// named option.
+func parseCharacter(option, value string) (rune, error) {
+	if value == `\t` || value == "tab" {
+		return '\t', nil
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("--%v must be a single character, not '%v'", option, value)
+	}
+	r1, _ := utf8.DecodeRuneInString(value)
+	if r1 == '\r' || r1 == '\n' || r1 == utf8.RuneError {
+		return 0, fmt.Errorf("invalid --%v character %q", option, r1)
+	}
+	return r1, nil
+}
@@ -0,0 +1,259 @@
+package db
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+)
+
+// Plan stages and legacy cursor types that explain output is summarized by.
+const (
+	collScanStage     = "COLLSCAN"
+	basicCursor       = "BasicCursor"
+	btreeCursorPrefix = "BtreeCursor "
+)
+
+// FindQuery describes a find, as built by a tool's cursor, to explain.
+type FindQuery struct {
+	Filter   interface{}
+	Sort     bson.D
+	Skip     int
+	Limit    int
+	Snapshot bool
+}
+
+// QueryPlan summarizes the plan the server chooses to run a query.
+type QueryPlan struct {
+	// Namespace is the collection queried
+	Namespace string
+
+	// WinningPlan describes the stages of the chosen plan, from the last
+	// to the first, e.g. "FETCH <- IXSCAN"
+	WinningPlan string
+
+	// Indexes are the names of the indexes the plan uses
+	Indexes []string
+
+	// CollScan is true if the plan scans the whole collection
+	CollScan bool
+
+	// DocsExamined is the estimated number of documents the query examines
+	DocsExamined int64
+}
+
+// String returns a one line report of the plan.
+func (plan *QueryPlan) String() string {
+	indexes := "none"
+	if len(plan.Indexes) > 0 {
+		indexes = strings.Join(plan.Indexes, ", ")
+	}
+	return fmt.Sprintf("%v: winning plan %v, indexes used: %v, estimated documents examined: %v",
+		plan.Namespace, plan.WinningPlan, indexes, plan.DocsExamined)
+}
+
+// CheckCollScan returns an error if the plan is a collection scan estimated
+// to examine more than maxDocs documents. A maxDocs of 0 allows any scan.
+func (plan *QueryPlan) CheckCollScan(maxDocs int64) error {
+	if maxDocs <= 0 || !plan.CollScan || plan.DocsExamined <= maxDocs {
+		return nil
+	}
+	return fmt.Errorf("the query on %v is a collection scan of an estimated %v documents, "+
+		"more than --maxCollScanDocs=%v; use --allowCollScan to run it anyway",
+		plan.Namespace, plan.DocsExamined, maxDocs)
+}
+
+// ExplainFind returns the plan the server chooses for the find on the
+// collection, without running it. Servers that can't explain a find command
+// are sent the find with the $explain modifier instead, which does run it;
+// any other error is returned as it is.
+func ExplainFind(collection *mgo.Collection, find FindQuery) (*QueryPlan, error) {
+	filter := find.Filter
+	if filter == nil {
+		filter = bson.M{}
+	}
+	findCmd := bson.D{{"find", collection.Name}, {"filter", filter}}
+	if len(find.Sort) > 0 {
+		findCmd = append(findCmd, bson.DocElem{"sort", find.Sort})
+	}
+	if find.Skip > 0 {
+		findCmd = append(findCmd, bson.DocElem{"skip", find.Skip})
+	}
+	if find.Limit > 0 {
+		findCmd = append(findCmd, bson.DocElem{"limit", find.Limit})
+	}
+	if find.Snapshot {
+		findCmd = append(findCmd, bson.DocElem{"snapshot", true})
+	}
+
+	explain := bson.M{}
+	err := collection.Database.Run(bson.D{{"explain", findCmd}, {"verbosity", "queryPlanner"}}, &explain)
+	if err != nil && !explainUnsupported(err) {
+		return nil, fmt.Errorf("error explaining query on %v: %v", collection.FullName, err)
+	}
+	if err != nil {
+		// fall back to the $explain modifier of servers older than 3.2
+		query := collection.Find(filter).Skip(find.Skip).Limit(find.Limit)
+		if len(find.Sort) > 0 {
+			sortFields, err := bsonutil.MakeSortString(find.Sort)
+			if err != nil {
+				return nil, err
+			}
+			query = query.Sort(sortFields...)
+		}
+		if find.Snapshot {
+			query = query.Snapshot()
+		}
+		explain = bson.M{}
+		if err = query.Explain(explain); err != nil {
+			return nil, fmt.Errorf("error explaining query on %v: %v", collection.FullName, err)
+		}
+	}
+
+	plan := ParseQueryPlan(explain)
+	plan.Namespace = collection.FullName
+	if plan.DocsExamined < 0 {
+		if plan.DocsExamined, err = estimateDocsExamined(collection, plan, filter); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// explainUnsupported returns true if err shows that the server can't explain
+// a find command: servers before 3.0 have no explain command, and 3.0 has no
+// find command to explain.
+func explainUnsupported(err error) bool {
+	if IsNoCmd(err) {
+		return true
+	}
+	e, ok := err.(*mgo.QueryError)
+	return ok && (e.Code == 59 || strings.Contains(e.Message, "unknown command"))
+}
+
+// ExplainPipeline returns the plan the server chooses to read the documents
+// an aggregation pipeline on the collection starts from.
+func ExplainPipeline(collection *mgo.Collection, pipeline interface{}) (*QueryPlan, error) {
+	explain := bson.M{}
+	if err := collection.Pipe(pipeline).Explain(&explain); err != nil {
+		return nil, fmt.Errorf("error explaining pipeline on %v: %v", collection.FullName, err)
+	}
+	var filter interface{} = bson.M{}
+	if stages, ok := explain["stages"].([]interface{}); ok && len(stages) > 0 {
+		if first, ok := stages[0].(bson.M); ok {
+			if cursor, ok := first["$cursor"].(bson.M); ok {
+				explain = cursor
+				if query, ok := cursor["query"]; ok {
+					filter = query
+				}
+			}
+		}
+	}
+
+	plan := ParseQueryPlan(explain)
+	plan.Namespace = collection.FullName
+	if plan.DocsExamined < 0 {
+		var err error
+		if plan.DocsExamined, err = estimateDocsExamined(collection, plan, filter); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// ParseQueryPlan summarizes the output of explain, in either the format of
+// servers since 3.0 or the legacy format. DocsExamined is -1 if the output
+// doesn't give it, as when only the query planner ran.
+func ParseQueryPlan(explain bson.M) *QueryPlan {
+	plan := &QueryPlan{DocsExamined: -1}
+	if planner, ok := explain["queryPlanner"].(bson.M); ok {
+		if winningPlan, ok := planner["winningPlan"].(bson.M); ok {
+			plan.WinningPlan = describeStage(winningPlan, plan)
+		}
+		if stats, ok := explain["executionStats"].(bson.M); ok {
+			if examined, err := util.ToInt(stats["totalDocsExamined"]); err == nil {
+				plan.DocsExamined = int64(examined)
+			}
+		}
+		return plan
+	}
+
+	// servers older than 3.0 describe the cursor the query used
+	cursor, _ := explain["cursor"].(string)
+	plan.WinningPlan = cursor
+	switch {
+	case cursor == basicCursor:
+		plan.CollScan = true
+	case strings.HasPrefix(cursor, btreeCursorPrefix):
+		name := strings.Fields(strings.TrimPrefix(cursor, btreeCursorPrefix))
+		if len(name) > 0 {
+			plan.Indexes = append(plan.Indexes, name[0])
+		}
+	}
+	if examined, err := util.ToInt(explain["nscannedObjects"]); err == nil {
+		plan.DocsExamined = int64(examined)
+	}
+	return plan
+}
+
+// describeStage returns a description of the plan stage and the stages it
+// reads from, recording the indexes they use and whether they scan the
+// collection in the plan.
+func describeStage(stage bson.M, plan *QueryPlan) string {
+	name, _ := stage["stage"].(string)
+	if name == collScanStage {
+		plan.CollScan = true
+	}
+	if index, ok := stage["indexName"].(string); ok {
+		plan.Indexes = append(plan.Indexes, index)
+	}
+
+	var inputs []string
+	if input, ok := stage["inputStage"].(bson.M); ok {
+		inputs = append(inputs, describeStage(input, plan))
+	}
+	if stages, ok := stage["inputStages"].([]interface{}); ok {
+		for _, input := range stages {
+			if input, ok := input.(bson.M); ok {
+				inputs = append(inputs, describeStage(input, plan))
+			}
+		}
+	}
+	// sharded plans hold the winning plan of each shard
+	if shards, ok := stage["shards"].([]interface{}); ok {
+		for _, shard := range shards {
+			if shard, ok := shard.(bson.M); ok {
+				if winningPlan, ok := shard["winningPlan"].(bson.M); ok {
+					inputs = append(inputs, describeStage(winningPlan, plan))
+				}
+			}
+		}
+	}
+
+	switch len(inputs) {
+	case 0:
+		return name
+	case 1:
+		return name + " <- " + inputs[0]
+	}
+	return name + " <- (" + strings.Join(inputs, ", ") + ")"
+}
+
+// estimateDocsExamined returns the number of documents in the collection if
+// the plan scans it, and otherwise the number of documents matching the filter,
+// which an index scan fetches.
+func estimateDocsExamined(collection *mgo.Collection, plan *QueryPlan, filter interface{}) (int64, error) {
+	var count int
+	var err error
+	if plan.CollScan {
+		count, err = collection.Count()
+	} else {
+		count, err = collection.Find(filter).Count()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error counting documents in %v: %v", collection.FullName, err)
+	}
+	return int64(count), nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestParseQueryPlan(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When summarizing explain output", t, func() {
+		Convey("a collection scan should be found in the query planner output", func() {
+			plan := ParseQueryPlan(bson.M{
+				"queryPlanner": bson.M{
+					"winningPlan": bson.M{"stage": "COLLSCAN"},
+				},
+			})
+			So(plan.WinningPlan, ShouldEqual, "COLLSCAN")
+			So(plan.CollScan, ShouldBeTrue)
+			So(len(plan.Indexes), ShouldEqual, 0)
+			So(plan.DocsExamined, ShouldEqual, -1)
+		})
+
+		Convey("the indexes of nested stages should be found", func() {
+			plan := ParseQueryPlan(bson.M{
+				"queryPlanner": bson.M{
+					"winningPlan": bson.M{
+						"stage": "FETCH",
+						"inputStage": bson.M{
+							"stage": "OR",
+							"inputStages": []interface{}{
+								bson.M{"stage": "IXSCAN", "indexName": "a_1"},
+								bson.M{"stage": "IXSCAN", "indexName": "b_1"},
+							},
+						},
+					},
+				},
+				"executionStats": bson.M{"totalDocsExamined": 12},
+			})
+			So(plan.WinningPlan, ShouldEqual, "FETCH <- OR <- (IXSCAN, IXSCAN)")
+			So(plan.CollScan, ShouldBeFalse)
+			So(plan.Indexes, ShouldResemble, []string{"a_1", "b_1"})
+			So(plan.DocsExamined, ShouldEqual, 12)
+		})
+
+		Convey("the plans of each shard should be summarized", func() {
+			plan := ParseQueryPlan(bson.M{
+				"queryPlanner": bson.M{
+					"winningPlan": bson.M{
+						"stage": "SHARD_MERGE",
+						"shards": []interface{}{
+							bson.M{"winningPlan": bson.M{"stage": "COLLSCAN"}},
+						},
+					},
+				},
+			})
+			So(plan.WinningPlan, ShouldEqual, "SHARD_MERGE <- COLLSCAN")
+			So(plan.CollScan, ShouldBeTrue)
+		})
+
+		Convey("legacy output should be summarized by its cursor", func() {
+			plan := ParseQueryPlan(bson.M{"cursor": "BtreeCursor a_1 reverse", "nscannedObjects": 3})
+			So(plan.Indexes, ShouldResemble, []string{"a_1"})
+			So(plan.CollScan, ShouldBeFalse)
+			So(plan.DocsExamined, ShouldEqual, 3)
+
+			plan = ParseQueryPlan(bson.M{"cursor": "BasicCursor", "nscannedObjects": 100})
+			So(plan.CollScan, ShouldBeTrue)
+			So(plan.DocsExamined, ShouldEqual, 100)
+		})
+
+		Convey("only collection scans over the limit should be refused", func() {
+			plan := &QueryPlan{Namespace: "test.c", CollScan: true, DocsExamined: 100}
+			So(plan.CheckCollScan(0), ShouldBeNil)
+			So(plan.CheckCollScan(100), ShouldBeNil)
+			So(plan.CheckCollScan(99), ShouldNotBeNil)
+			plan.CollScan = false
+			So(plan.CheckCollScan(99), ShouldBeNil)
+		})
+	})
+}
+
+func TestExplainUnsupported(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Only errors from servers that can't explain a find should fall back to $explain", t, func() {
+		So(explainUnsupported(&mgo.QueryError{Message: "no such cmd: explain"}), ShouldBeTrue)
+		So(explainUnsupported(&mgo.QueryError{Code: 59, Message: "Explain failed due to unknown command: find"}), ShouldBeTrue)
+		So(explainUnsupported(&mgo.QueryError{Code: 13, Message: "not authorized on test to execute command"}), ShouldBeFalse)
+		So(explainUnsupported(&mgo.QueryError{Code: 2, Message: "unknown operator: $foo"}), ShouldBeFalse)
+		So(explainUnsupported(fmt.Errorf("read tcp: connection reset by peer")), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// oplogAwaitTimeout is how long a cursor returned by TailOplog waits for
+	// new oplog entries before Next returns false.
+	oplogAwaitTimeout = time.Second
+
+	// MaxTailRetries is how many times in a row an OplogTailer queries the
+	// oplog again after an error, without reading further, before giving up.
+	MaxTailRetries = 10
+
+	// TailRetryInterval is how long an OplogTailer waits before querying the
+	// oplog again after an error.
+	TailRetryInterval = 5 * time.Second
+)
+
+// OplogGapError is the error returned when the oplog no longer holds every
+// entry after a timestamp, because older entries have been overwritten.
+type OplogGapError struct {
+	After bson.MongoTimestamp
+}
+
+func (e OplogGapError) Error() string {
+	return fmt.Sprintf("the oplog no longer holds the entries after %v", FormatTimestamp(e.After))
+}
+
+// IsOplogGap returns true if err is an OplogGapError.
+func IsOplogGap(err error) bool {
+	_, ok := err.(OplogGapError)
+	return ok
+}
+
+// TimestampFromTime returns the oplog timestamp of the first operation in
+// the second of t.
+func TimestampFromTime(t time.Time) bson.MongoTimestamp {
+	return bson.MongoTimestamp(uint64(t.Unix()) << 32)
+}
+
+// FormatTimestamp returns ts in the form <time_t>:<ordinal>, as parsed by
+// ParseTimestamp.
+func FormatTimestamp(ts bson.MongoTimestamp) string {
+	return fmt.Sprintf("%v:%v", uint64(ts)>>32, uint32(ts))
+}
+
+// ParseTimestamp takes in a string the form of <time_t>:<ordinal>,
+// where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
+// a counter of operations in the oplog that occurred in the specified second.
+// It parses this timestamp string and returns a bson.MongoTimestamp type.
+func ParseTimestamp(ts string) (bson.MongoTimestamp, error) {
+	var seconds, increment int
+	timestampFields := strings.Split(ts, ":")
+	if len(timestampFields) > 2 {
+		return 0, fmt.Errorf("too many : characters")
+	}
+
+	seconds, err := strconv.Atoi(timestampFields[0])
+	if err != nil {
+		return 0, fmt.Errorf("error parsing timestamp seconds: %v", err)
+	}
+
+	// parse the increment field if it exists
+	if len(timestampFields) == 2 {
+		if len(timestampFields[1]) > 0 {
+			increment, err = strconv.Atoi(timestampFields[1])
+			if err != nil {
+				return 0, fmt.Errorf("error parsing timestamp increment: %v", err)
+			}
+		} else {
+			// handle the case where the user writes "<time_t>:" with no ordinal
+			increment = 0
+		}
+	}
+
+	timestamp := (int64(seconds) << 32) | int64(increment)
+	return bson.MongoTimestamp(timestamp), nil
+}
+
+// ReadTimestampFile returns the timestamp recorded in the file at path by
+// WriteTimestampFile, and false if the file doesn't exist.
+func ReadTimestampFile(path string) (bson.MongoTimestamp, bool, error) {
+	contents, err := ioutil.ReadFile(util.ToUniversalPath(path))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	ts, err := ParseTimestamp(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 0, false, err
+	}
+	return ts, true, nil
+}
+
+// WriteTimestampFile records the timestamp in the file at path, in the form
+// <time_t>:<ordinal>. The file is replaced rather than rewritten, so that it
+// always holds a complete timestamp.
+func WriteTimestampFile(path string, ts bson.MongoTimestamp) error {
+	path = util.ToUniversalPath(path)
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(temp, FormatTimestamp(ts))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// GetLatestOplogTimestamp returns the timestamp of the most recent entry in
+// the oplog.
+func GetLatestOplogTimestamp(oplog *mgo.Collection) (bson.MongoTimestamp, error) {
+	mostRecentOplogEntry := Oplog{}
+	err := oplog.Find(nil).Sort("-$natural").One(&mostRecentOplogEntry)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the latest oplog entry: %v", err)
+	}
+	return mostRecentOplogEntry.Timestamp, nil
+}
+
+// TailOplog returns a tailable cursor over the entries in the oplog after
+// the given timestamp that match the query. Once it has returned every
+// entry, Next waits briefly for new ones and then returns false, with the
+// cursor's Timeout method returning true; Next can then be called again.
+func TailOplog(oplog *mgo.Collection, query bson.M, after bson.MongoTimestamp) *mgo.Iter {
+	oplogQuery := bson.M{"ts": bson.M{"$gt": after}}
+	for key, value := range query {
+		oplogQuery[key] = value
+	}
+	return oplog.Find(oplogQuery).LogReplay().Tail(oplogAwaitTimeout)
+}
+
+// CheckOplogGap returns an OplogGapError if the oldest entry in the oplog is
+// after the given timestamp, so that the entries in between are lost.
+func CheckOplogGap(oplog *mgo.Collection, after bson.MongoTimestamp) error {
+	oldest := Oplog{}
+	err := oplog.Find(nil).Sort("$natural").One(&oldest)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading the oldest oplog entry: %v", err)
+	}
+	if oldest.Timestamp > after {
+		return OplogGapError{after}
+	}
+	return nil
+}
+
+// OplogTailer follows the entries in the oplog that match a query, querying
+// it again when the cursor is lost or fails, e.g. because of a failover.
+type OplogTailer struct {
+	Oplog *mgo.Collection
+	Query bson.M
+
+	// failures counts the errors in a row since the cursor last read past
+	// lastAfter
+	failures  int
+	lastAfter bson.MongoTimestamp
+}
+
+// Tail returns a cursor from TailOplog over the entries after the given
+// timestamp.
+func (tailer *OplogTailer) Tail(after bson.MongoTimestamp) *mgo.Iter {
+	return TailOplog(tailer.Oplog, tailer.Query, after)
+}
+
+// Retail closes a cursor that was lost or failed, and returns a new one over
+// the entries after the given timestamp. It waits before querying again, and
+// after an error also refreshes the session, up to MaxTailRetries times in a
+// row. It returns an OplogGapError if the oplog has meanwhile moved past
+// the timestamp, rather than silently skip the entries in between.
+func (tailer *OplogTailer) Retail(tail *mgo.Iter, after bson.MongoTimestamp) (*mgo.Iter, error) {
+	err := tail.Err()
+	tail.Close()
+	if after != tailer.lastAfter {
+		tailer.failures = 0
+		tailer.lastAfter = after
+	}
+	for {
+		if err != nil {
+			tailer.failures++
+			if tailer.failures > MaxTailRetries {
+				return nil, fmt.Errorf("error tailing the oplog: %v", err)
+			}
+			log.Logf(log.Always, "error tailing the oplog, querying again after %v: %v",
+				FormatTimestamp(after), err)
+			time.Sleep(TailRetryInterval)
+			tailer.Oplog.Database.Session.Refresh()
+		} else {
+			log.Logf(log.Info, "oplog cursor was lost, querying again after %v", FormatTimestamp(after))
+			// wait as a cursor would, rather than query the server in a loop
+			time.Sleep(oplogAwaitTimeout)
+		}
+		if err = CheckOplogGap(tailer.Oplog, after); err == nil {
+			return tailer.Tail(after), nil
+		}
+		if IsOplogGap(err) {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOplogTimestamps(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With oplog timestamps", t, func() {
+		Convey("a time should be the first timestamp of its second", func() {
+			ts := TimestampFromTime(time.Unix(1450000000, 999))
+			So(ts, ShouldEqual, bson.MongoTimestamp(int64(1450000000)<<32))
+		})
+
+		Convey("formatted timestamps should parse back to the same timestamp", func() {
+			ts := bson.MongoTimestamp(int64(1450000000)<<32 | 42)
+			So(FormatTimestamp(ts), ShouldEqual, "1450000000:42")
+			parsed, err := ParseTimestamp(FormatTimestamp(ts))
+			So(err, ShouldBeNil)
+			So(parsed, ShouldEqual, ts)
+		})
+
+		Convey("gap errors should name the timestamp and be told apart", func() {
+			err := error(OplogGapError{bson.MongoTimestamp(int64(1450000000)<<32 | 3)})
+			So(err.Error(), ShouldContainSubstring, "1450000000:3")
+			So(IsOplogGap(err), ShouldBeTrue)
+			So(IsOplogGap(fmt.Errorf("error reading the oldest oplog entry")), ShouldBeFalse)
+		})
+	})
+}
+
+func TestTimestampFile(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a timestamp file", t, func() {
+		dir, err := ioutil.TempDir("", "timestamp_file")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "state")
+
+		Convey("a missing file should hold no timestamp", func() {
+			_, ok, err := ReadTimestampFile(path)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("a written timestamp should be read back", func() {
+			ts := bson.MongoTimestamp(int64(1450000000)<<32 | 7)
+			So(WriteTimestampFile(path, ts), ShouldBeNil)
+			contents, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "1450000000:7\n")
+			read, ok, err := ReadTimestampFile(path)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(read, ShouldEqual, ts)
+		})
+
+		Convey("a file that doesn't hold a timestamp should be an error", func() {
+			So(ioutil.WriteFile(path, []byte("garbage"), 0644), ShouldBeNil)
+			_, _, err := ReadTimestampFile(path)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
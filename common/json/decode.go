@@ -108,6 +108,24 @@ func UnmarshalBsonD(data []byte) (bson.D, error) {
 	return d.unmarshalBsonD()
 }
 
+// UnmarshalOrdered parses any JSON value like Unmarshal into an interface{}
+// would, except that objects at every level are returned as bson.D, so that
+// the order of their keys is preserved.
+func UnmarshalOrdered(data []byte) (interface{}, error) {
+	// Check for well-formedness.
+	// Avoids filling out half a data structure
+	// before discovering a JSON syntax error.
+	var d decodeState
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return nil, err
+	}
+
+	d.init(data)
+	d.orderedObjects = true
+	return d.unmarshalOrdered()
+}
+
 // Unmarshaler is the interface implemented by objects
 // that can unmarshal a JSON description of themselves.
 // The input can be assumed to be a valid encoding of
@@ -192,6 +210,21 @@ func (d *decodeState) unmarshalBsonD() (out bson.D, err error) {
 	return out, d.savedError
 }
 
+func (d *decodeState) unmarshalOrdered() (out interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			err = r.(error)
+		}
+	}()
+
+	d.scan.reset()
+	out = d.valueInterface()
+	return out, d.savedError
+}
+
 func (d *decodeState) unmarshal(v interface{}) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -270,6 +303,10 @@ type decodeState struct {
 	savedError error
 	tempstr    string // scratch space to avoid some allocations
 	useNumber  bool
+
+	// orderedObjects makes objects decoded into interface values be
+	// stored as bson.D rather than maps, preserving the order of keys
+	orderedObjects bool
 }
 
 // errPhase is used for errors that should not happen unless
@@ -979,6 +1016,9 @@ func (d *decodeState) valueInterface() interface{} {
 	case scanBeginArray:
 		return d.arrayInterface()
 	case scanBeginObject:
+		if d.orderedObjects {
+			return d.bsonDInterface()
+		}
 		return d.objectInterface()
 	case scanBeginLiteral:
 		return d.literalInterface()
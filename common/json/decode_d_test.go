@@ -42,3 +42,22 @@ func TestDecodeBsonD(t *testing.T) {
 		So(err, ShouldNotBeNil)
 	})
 }
+
+func TestUnmarshalOrdered(t *testing.T) {
+	Convey("When unmarshalling JSON with ordered objects", t, func() {
+		Convey("Objects at every level should be stored as bson.D", func() {
+			data := `[{"$sort": {"b": 1, "a": -1}}, {"$limit": 5}]`
+			out, err := UnmarshalOrdered([]byte(data))
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []interface{}{
+				bson.D{{"$sort", bson.D{{"b", int32(1)}, {"a", int32(-1)}}}},
+				bson.D{{"$limit", int32(5)}},
+			})
+		})
+
+		Convey("Invalid JSON should return an error", func() {
+			_, err := UnmarshalOrdered([]byte(`[{"a": }]`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
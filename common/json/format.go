@@ -0,0 +1,61 @@
+package json
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Extended JSON formats. LegacyFormat is the format historically used by the
+// tools; CanonicalFormat and RelaxedFormat are the two modes of Extended JSON
+// v2, which respectively preserve every type and favor readability.
+const (
+	LegacyFormat    = "legacy"
+	CanonicalFormat = "canonical"
+	RelaxedFormat   = "relaxed"
+)
+
+// ValidateFormat returns an error if format isn't one of the Extended JSON
+// formats.
+func ValidateFormat(format string) error {
+	switch format {
+	case LegacyFormat, CanonicalFormat, RelaxedFormat:
+		return nil
+	}
+	return fmt.Errorf("invalid JSON format '%v', choose '%v', '%v' or '%v'",
+		format, LegacyFormat, CanonicalFormat, RelaxedFormat)
+}
+
+// FormatDouble returns the string representation of a double used by the
+// $numberDouble wrapper of Extended JSON v2.
+func FormatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	// keep a decimal point so integral values still read as doubles
+	if !strings.ContainsAny(s, ".EN") {
+		s += ".0"
+	}
+	return s
+}
+
+// ParseDouble parses the string representation of a double used by the
+// $numberDouble wrapper of Extended JSON v2.
+func ParseDouble(s string) (float64, error) {
+	switch s {
+	case "Infinity":
+		return math.Inf(1), nil
+	case "-Infinity":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
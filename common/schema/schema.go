@@ -0,0 +1,478 @@
+// Package schema implements client-side validation of BSON documents against
+// JSON Schema (draft 4) documents.
+package schema
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Schema is a compiled JSON Schema that documents can be validated against.
+// A Schema is safe for concurrent use.
+type Schema struct {
+	// raw is the parsed schema document, used to resolve "$ref" pointers
+	raw map[string]interface{}
+
+	root *node
+
+	// refs caches the compiled subschemas that "$ref" pointers resolve to
+	refs map[string]*node
+}
+
+// Violation describes a single way in which a value fails to match a schema.
+type Violation struct {
+	// Path is the JSON pointer (RFC 6901) to the offending value
+	Path string `json:"path"`
+
+	// Message describes the failed constraint
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v: %v", v.Path, v.Message)
+}
+
+// node is a compiled schema or subschema.
+type node struct {
+	// ref is a local "$ref" pointer, and target the subschema it resolves to
+	ref    string
+	target *node
+
+	types []string
+	enum  []interface{}
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+
+	// object constraints
+	properties           map[string]*node
+	patternProperties    []patternNode
+	additionalProperties *node
+	noAdditionalProps    bool
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	// array constraints
+	items             *node
+	tupleItems        []*node
+	additionalItems   *node
+	noAdditionalItems bool
+	minItems          *int
+	maxItems          *int
+	uniqueItems       bool
+
+	// string constraints
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	// numeric constraints
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum bool
+	exclusiveMaximum bool
+	multipleOf       *float64
+}
+
+type patternNode struct {
+	pattern *regexp.Regexp
+	schema  *node
+}
+
+// Parse compiles the given JSON Schema document.
+func Parse(data []byte) (*Schema, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %v", err)
+	}
+	root, err := compile(raw, "")
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{raw: raw, root: root, refs: map[string]*node{"#": root}}
+	// resolve every reference up front so that validation never has to
+	// modify the schema
+	nodes := map[*node]bool{}
+	if err = s.resolveAll(root, nodes); err != nil {
+		return nil, err
+	}
+	done := map[*node]bool{}
+	for n := range nodes {
+		if err = checkCycles(n, map[*node]bool{}, done); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// ParseFile reads and compiles the JSON Schema document at the given path.
+func ParseFile(path string) (*Schema, error) {
+	file, err := os.Open(util.ToUniversalPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error opening schema file: %v", err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema file: %v", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema file '%v': %v", path, err)
+	}
+	return s, nil
+}
+
+// compile builds a node from the raw subschema found at the given pointer.
+func compile(raw map[string]interface{}, pointer string) (*node, error) {
+	n := &node{}
+	var err error
+	fail := func(keyword string, format string, args ...interface{}) error {
+		return fmt.Errorf("invalid schema at '%v/%v': %v", pointer, keyword, fmt.Sprintf(format, args...))
+	}
+
+	if ref, ok := raw["$ref"]; ok {
+		if n.ref, ok = ref.(string); !ok || !strings.HasPrefix(n.ref, "#") {
+			return nil, fail("$ref", "only local references are supported")
+		}
+		// all other keywords are ignored alongside "$ref"
+		return n, nil
+	}
+
+	switch types := raw["type"].(type) {
+	case nil:
+	case string:
+		n.types = []string{types}
+	case []interface{}:
+		for _, t := range types {
+			name, ok := t.(string)
+			if !ok {
+				return nil, fail("type", "types must be strings")
+			}
+			n.types = append(n.types, name)
+		}
+	default:
+		return nil, fail("type", "must be a string or an array of strings")
+	}
+	for _, t := range n.types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fail("type", "unknown type '%v'", t)
+		}
+	}
+
+	if enum, ok := raw["enum"]; ok {
+		if n.enum, ok = enum.([]interface{}); !ok {
+			return nil, fail("enum", "must be an array")
+		}
+	}
+
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		value, ok := raw[keyword]
+		if !ok {
+			continue
+		}
+		list, err := compileList(value, pointer+"/"+keyword)
+		if err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "allOf":
+			n.allOf = list
+		case "anyOf":
+			n.anyOf = list
+		case "oneOf":
+			n.oneOf = list
+		}
+	}
+	if n.not, err = compileOptional(raw, "not", pointer); err != nil {
+		return nil, err
+	}
+
+	if properties, ok := raw["properties"]; ok {
+		propertyMap, ok := properties.(map[string]interface{})
+		if !ok {
+			return nil, fail("properties", "must be an object")
+		}
+		n.properties = map[string]*node{}
+		for name := range propertyMap {
+			if n.properties[name], err = compileOptional(propertyMap, name, pointer+"/properties"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if patternProperties, ok := raw["patternProperties"]; ok {
+		patternMap, ok := patternProperties.(map[string]interface{})
+		if !ok {
+			return nil, fail("patternProperties", "must be an object")
+		}
+		patterns := make([]string, 0, len(patternMap))
+		for pattern := range patternMap {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fail("patternProperties", "%v", err)
+			}
+			subschema, err := compileOptional(patternMap, pattern, pointer+"/patternProperties")
+			if err != nil {
+				return nil, err
+			}
+			n.patternProperties = append(n.patternProperties, patternNode{re, subschema})
+		}
+	}
+	if allowed, ok := raw["additionalProperties"].(bool); ok {
+		n.noAdditionalProps = !allowed
+	} else if n.additionalProperties, err = compileOptional(raw, "additionalProperties", pointer); err != nil {
+		return nil, err
+	}
+	if required, ok := raw["required"]; ok {
+		list, ok := required.([]interface{})
+		if !ok {
+			return nil, fail("required", "must be an array of strings")
+		}
+		for _, name := range list {
+			field, ok := name.(string)
+			if !ok {
+				return nil, fail("required", "must be an array of strings")
+			}
+			n.required = append(n.required, field)
+		}
+	}
+
+	if items, ok := raw["items"]; ok {
+		if _, isList := items.([]interface{}); isList {
+			if n.tupleItems, err = compileList(items, pointer+"/items"); err != nil {
+				return nil, err
+			}
+		} else if n.items, err = compileOptional(raw, "items", pointer); err != nil {
+			return nil, err
+		}
+	}
+	if allowed, ok := raw["additionalItems"].(bool); ok {
+		n.noAdditionalItems = !allowed
+	} else if n.additionalItems, err = compileOptional(raw, "additionalItems", pointer); err != nil {
+		return nil, err
+	}
+	if n.uniqueItems, err = getBool(raw, "uniqueItems"); err != nil {
+		return nil, fail("uniqueItems", "%v", err)
+	}
+
+	if pattern, ok := raw["pattern"]; ok {
+		str, ok := pattern.(string)
+		if !ok {
+			return nil, fail("pattern", "must be a string")
+		}
+		if n.pattern, err = regexp.Compile(str); err != nil {
+			return nil, fail("pattern", "%v", err)
+		}
+	}
+	if format, ok := raw["format"]; ok {
+		if n.format, ok = format.(string); !ok {
+			return nil, fail("format", "must be a string")
+		}
+	}
+
+	for keyword, target := range map[string]**int{
+		"minProperties": &n.minProperties,
+		"maxProperties": &n.maxProperties,
+		"minItems":      &n.minItems,
+		"maxItems":      &n.maxItems,
+		"minLength":     &n.minLength,
+		"maxLength":     &n.maxLength,
+	} {
+		if value, ok := raw[keyword]; ok {
+			limit, err := util.ToInt(value)
+			if err != nil || limit < 0 {
+				return nil, fail(keyword, "must be a non-negative integer")
+			}
+			*target = &limit
+		}
+	}
+	for keyword, target := range map[string]**float64{
+		"minimum":    &n.minimum,
+		"maximum":    &n.maximum,
+		"multipleOf": &n.multipleOf,
+	} {
+		if value, ok := raw[keyword]; ok {
+			limit, err := util.ToFloat64(value)
+			if err != nil {
+				return nil, fail(keyword, "must be a number")
+			}
+			*target = &limit
+		}
+	}
+	if n.multipleOf != nil && *n.multipleOf <= 0 {
+		return nil, fail("multipleOf", "must be greater than 0")
+	}
+	if n.exclusiveMinimum, err = getBool(raw, "exclusiveMinimum"); err != nil {
+		return nil, fail("exclusiveMinimum", "%v", err)
+	}
+	if n.exclusiveMaximum, err = getBool(raw, "exclusiveMaximum"); err != nil {
+		return nil, fail("exclusiveMaximum", "%v", err)
+	}
+	return n, nil
+}
+
+// compileOptional compiles the subschema stored under key in raw, if any.
+func compileOptional(raw map[string]interface{}, key string, pointer string) (*node, error) {
+	value, ok := raw[key]
+	if !ok {
+		return nil, nil
+	}
+	subschema, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid schema at '%v/%v': must be an object", pointer, escapePointer(key))
+	}
+	return compile(subschema, pointer+"/"+escapePointer(key))
+}
+
+// compileList compiles an array of subschemas.
+func compileList(value interface{}, pointer string) ([]*node, error) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("invalid schema at '%v': must be a non-empty array of schemas", pointer)
+	}
+	nodes := make([]*node, 0, len(list))
+	for i, elem := range list {
+		subschema, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid schema at '%v/%v': must be an object", pointer, i)
+		}
+		compiled, err := compile(subschema, pointer+"/"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, compiled)
+	}
+	return nodes, nil
+}
+
+func getBool(raw map[string]interface{}, key string) (bool, error) {
+	value, ok := raw[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("must be a boolean")
+	}
+	return b, nil
+}
+
+// resolveAll resolves the references of n and all of its subschemas.
+func (s *Schema) resolveAll(n *node, visited map[*node]bool) error {
+	if n == nil || visited[n] {
+		return nil
+	}
+	visited[n] = true
+	if n.ref != "" {
+		target, err := s.resolve(n.ref)
+		if err != nil {
+			return err
+		}
+		n.target = target
+	}
+	children := []*node{n.not, n.additionalProperties, n.items, n.additionalItems, n.target}
+	children = append(children, n.allOf...)
+	children = append(children, n.anyOf...)
+	children = append(children, n.oneOf...)
+	children = append(children, n.tupleItems...)
+	for _, property := range n.properties {
+		children = append(children, property)
+	}
+	for _, patternProperty := range n.patternProperties {
+		children = append(children, patternProperty.schema)
+	}
+	for _, child := range children {
+		if err := s.resolveAll(child, visited); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCycles returns an error if n leads back to itself through references
+// and combinators alone, which apply to the same value, since validating
+// against it would then never end. References reached through properties or
+// items apply to a nested value, so recursive schemas remain valid.
+func checkCycles(n *node, path map[*node]bool, done map[*node]bool) error {
+	if n == nil || done[n] {
+		return nil
+	}
+	if path[n] {
+		return fmt.Errorf("a '$ref' cycle never descends into the document")
+	}
+	path[n] = true
+	children := []*node{n.target, n.not}
+	children = append(children, n.allOf...)
+	children = append(children, n.anyOf...)
+	children = append(children, n.oneOf...)
+	for _, child := range children {
+		if err := checkCycles(child, path, done); err != nil {
+			return err
+		}
+	}
+	delete(path, n)
+	done[n] = true
+	return nil
+}
+
+// resolve returns the compiled subschema that a local "$ref" points to.
+func (s *Schema) resolve(ref string) (*node, error) {
+	if compiled, ok := s.refs[ref]; ok {
+		return compiled, nil
+	}
+	var target interface{} = s.raw
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = unescapePointer(token)
+			switch current := target.(type) {
+			case map[string]interface{}:
+				target = current[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(current) {
+					return nil, fmt.Errorf("unresolvable reference '%v'", ref)
+				}
+				target = current[i]
+			default:
+				return nil, fmt.Errorf("unresolvable reference '%v'", ref)
+			}
+		}
+	}
+	subschema, ok := target.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unresolvable reference '%v'", ref)
+	}
+	compiled, err := compile(subschema, pointer)
+	if err != nil {
+		return nil, err
+	}
+	s.refs[ref] = compiled
+	return compiled, nil
+}
+
+// escapePointer escapes a single JSON pointer reference token.
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func unescapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
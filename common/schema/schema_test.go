@@ -0,0 +1,183 @@
+package schema
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+	"time"
+)
+
+func mustParse(data string) *Schema {
+	s, err := Parse([]byte(data))
+	So(err, ShouldBeNil)
+	return s
+}
+
+func TestParse(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing a schema", t, func() {
+		Convey("valid schemas should compile", func() {
+			_, err := Parse([]byte(`{"type": "object", "properties": {"a": {"type": ["string", "null"]}}}`))
+			So(err, ShouldBeNil)
+		})
+		Convey("invalid JSON should return an error", func() {
+			_, err := Parse([]byte(`{"type": `))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("unknown types should return an error", func() {
+			_, err := Parse([]byte(`{"properties": {"a": {"type": "text"}}}`))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "/properties/a/type")
+		})
+		Convey("invalid patterns should return an error", func() {
+			_, err := Parse([]byte(`{"pattern": "("}`))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("remote and unresolvable references should return an error", func() {
+			_, err := Parse([]byte(`{"$ref": "http://example.com/schema"}`))
+			So(err, ShouldNotBeNil)
+			_, err = Parse([]byte(`{"properties": {"a": {"$ref": "#/definitions/missing"}}}`))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("references that lead back to themselves without descending should return an error", func() {
+			for _, cyclic := range []string{
+				`{"definitions": {"a": {"$ref": "#/definitions/a"}}, "properties": {"x": {"$ref": "#/definitions/a"}}}`,
+				`{"anyOf": [{"type": "string"}, {"$ref": "#"}]}`,
+				`{"definitions": {"a": {"not": {"$ref": "#/definitions/b"}}, "b": {"allOf": [{"$ref": "#/definitions/a"}]}},
+					"$ref": "#/definitions/a"}`,
+			} {
+				_, err := Parse([]byte(cyclic))
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("a missing schema file should return an error", func() {
+			_, err := ParseFile("this/file/does/not/exist.json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidate(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Given a schema for people", t, func() {
+		s := mustParse(`{
+			"type": "object",
+			"required": ["_id", "name", "age"],
+			"additionalProperties": false,
+			"definitions": {
+				"tag": {"type": "string", "minLength": 1}
+			},
+			"properties": {
+				"_id": {"type": "string", "pattern": "^[0-9a-f]{24}$"},
+				"name": {
+					"type": "object",
+					"properties": {
+						"first": {"type": "string"},
+						"last/name": {"type": "string"}
+					}
+				},
+				"age": {"type": "integer", "minimum": 0, "maximum": 150, "exclusiveMaximum": true},
+				"weight": {"type": "number", "multipleOf": 0.5},
+				"born": {"type": "string", "format": "date-time"},
+				"email": {"type": "string", "format": "email"},
+				"status": {"enum": ["active", "inactive", null]},
+				"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}, "uniqueItems": true, "maxItems": 3},
+				"point": {"type": "array", "items": [{"type": "number"}, {"type": "number"}], "additionalItems": false},
+				"code": {"anyOf": [{"type": "integer"}, {"type": "string", "maxLength": 3}]}
+			}
+		}`)
+
+		Convey("a valid document should have no violations", func() {
+			document := bson.D{
+				{"_id", bson.NewObjectId()},
+				{"name", &bson.D{{"first", "Jane"}, {"last/name", "Doe"}}},
+				{"age", int32(42)},
+				{"weight", 61.5},
+				{"born", time.Now()},
+				{"email", "jane@example.com"},
+				{"status", nil},
+				{"tags", []interface{}{"a", "b"}},
+				{"point", []interface{}{1, 2.5}},
+				{"code", "abc"},
+			}
+			So(s.Validate(document), ShouldBeEmpty)
+		})
+
+		Convey("each violation should be reported with a JSON pointer", func() {
+			document := bson.D{
+				{"_id", "zzz"},
+				{"name", bson.M{"last/name": 7}},
+				{"age", 150},
+				{"weight", 61.2},
+				{"born", "yesterday"},
+				{"status", "unknown"},
+				{"tags", []interface{}{"a", "", "a"}},
+				{"point", []interface{}{1, 2, 3}},
+				{"code", "abcd"},
+				{"extra", true},
+			}
+			So(s.Validate(document), ShouldResemble, []Violation{
+				{"/_id", "string does not match pattern '^[0-9a-f]{24}$'"},
+				{"/name/last~1name", "expected string, got integer"},
+				{"/age", "expected a number less than 150, got 150"},
+				{"/weight", "expected a multiple of 0.5, got 61.2"},
+				{"/born", "string is not a valid date-time"},
+				{"/status", "value is not one of the allowed values"},
+				{"/tags", "items 0 and 2 are equal"},
+				{"/tags/1", "expected a string of at least 1 characters, got 0"},
+				{"/point/2", "additional item is not allowed"},
+				{"/code", "value does not match any of the schemas in anyOf"},
+				{"/extra", "additional property is not allowed"},
+			})
+		})
+
+		Convey("missing required properties should be reported", func() {
+			So(s.Validate(bson.D{{"name", bson.D{}}}), ShouldResemble, []Violation{
+				{"/_id", "required property is missing"},
+				{"/age", "required property is missing"},
+			})
+		})
+
+		Convey("a value of the wrong type should only report the type", func() {
+			So(s.Validate("a string"), ShouldResemble, []Violation{
+				{"", "expected object, got string"},
+			})
+		})
+	})
+
+	Convey("Given a schema with combinators", t, func() {
+		s := mustParse(`{
+			"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}],
+			"not": {"enum": [3]}
+		}`)
+		So(s.Validate(2), ShouldBeEmpty)
+		So(s.Validate(2.5), ShouldNotBeEmpty)
+		So(s.Validate(12), ShouldNotBeEmpty)
+		So(s.Validate(int64(3)), ShouldResemble, []Violation{
+			{"", "value must not match the schema in not"},
+		})
+	})
+
+	Convey("Given a recursive schema", t, func() {
+		s := mustParse(`{
+			"type": "object",
+			"properties": {
+				"value": {"type": "integer"},
+				"children": {"type": "array", "items": {"$ref": "#"}}
+			}
+		}`)
+		document := bson.D{
+			{"value", 1},
+			{"children", []interface{}{
+				bson.D{{"value", 2}},
+				bson.D{{"value", "three"}},
+			}},
+		}
+		So(s.Validate(document), ShouldResemble, []Violation{
+			{"/children/1/value", "expected integer, got string"},
+		})
+	})
+}
@@ -0,0 +1,376 @@
+package schema
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validate checks the given value - usually a bson.D - against the schema and
+// returns every violation found, or nil if the value is valid.
+//
+// BSON values are matched against JSON types as follows: documents are
+// objects, arrays are arrays, all numeric types are numbers (and integers if
+// they have no fractional part), ObjectIds and dates are strings (in hex and
+// RFC 3339 form respectively) and any other BSON type is an object.
+func (s *Schema) Validate(value interface{}) []Violation {
+	return s.root.validate(normalize(value), "")
+}
+
+// object is the normalized form of a document which keeps the order of its
+// fields so that violations are reported in document order.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// normalize converts BSON values into the plain types the validator works
+// with: objects, []interface{}, float64, string, bool and nil.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case bson.ObjectId:
+		return v.Hex()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bson.D:
+		obj := object{values: map[string]interface{}{}}
+		for _, elem := range v {
+			obj.keys = append(obj.keys, elem.Name)
+			obj.values[elem.Name] = normalize(elem.Value)
+		}
+		return obj
+	case *bson.D:
+		return normalize(*v)
+	case bson.M:
+		return normalize(map[string]interface{}(v))
+	case map[string]interface{}:
+		obj := object{values: map[string]interface{}{}}
+		for key, elem := range v {
+			obj.keys = append(obj.keys, key)
+			obj.values[key] = normalize(elem)
+		}
+		sort.Strings(obj.keys)
+		return obj
+	case []interface{}:
+		array := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			array = append(array, normalize(elem))
+		}
+		return array
+	}
+	// other BSON types, like binary data and timestamps, are objects in
+	// extended JSON
+	return object{values: map[string]interface{}{}}
+}
+
+// typeOf returns the JSON type name of a normalized value.
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func (n *node) validate(value interface{}, path string) []Violation {
+	if n.target != nil {
+		return n.target.validate(value, path)
+	}
+
+	var violations []Violation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if len(n.types) != 0 {
+		valueType := typeOf(value)
+		matched := false
+		for _, t := range n.types {
+			if t == valueType || (t == "number" && valueType == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("expected %v, got %v", strings.Join(n.types, " or "), valueType)
+			// the remaining constraints would only add noise
+			return violations
+		}
+	}
+
+	if n.enum != nil {
+		matched := false
+		for _, allowed := range n.enum {
+			if equal(value, normalize(allowed)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value is not one of the allowed values")
+		}
+	}
+
+	for _, subschema := range n.allOf {
+		violations = append(violations, subschema.validate(value, path)...)
+	}
+	if n.anyOf != nil {
+		matched := false
+		for _, subschema := range n.anyOf {
+			if len(subschema.validate(value, path)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("value does not match any of the schemas in anyOf")
+		}
+	}
+	if n.oneOf != nil {
+		matches := 0
+		for _, subschema := range n.oneOf {
+			if len(subschema.validate(value, path)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("value matches %v of the schemas in oneOf instead of exactly one", matches)
+		}
+	}
+	if n.not != nil && len(n.not.validate(value, path)) == 0 {
+		fail("value must not match the schema in not")
+	}
+
+	switch v := value.(type) {
+	case object:
+		violations = append(violations, n.validateObject(v, path)...)
+	case []interface{}:
+		violations = append(violations, n.validateArray(v, path)...)
+	case string:
+		violations = append(violations, n.validateString(v, path)...)
+	case float64:
+		violations = append(violations, n.validateNumber(v, path)...)
+	}
+	return violations
+}
+
+func (n *node) validateObject(obj object, path string) []Violation {
+	var violations []Violation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if n.minProperties != nil && len(obj.keys) < *n.minProperties {
+		fail("expected at least %v properties, got %v", *n.minProperties, len(obj.keys))
+	}
+	if n.maxProperties != nil && len(obj.keys) > *n.maxProperties {
+		fail("expected at most %v properties, got %v", *n.maxProperties, len(obj.keys))
+	}
+	for _, name := range n.required {
+		if _, ok := obj.values[name]; !ok {
+			violations = append(violations, Violation{path + "/" + escapePointer(name), "required property is missing"})
+		}
+	}
+
+	for _, key := range obj.keys {
+		keyPath := path + "/" + escapePointer(key)
+		value := obj.values[key]
+		matched := false
+		if subschema, ok := n.properties[key]; ok {
+			matched = true
+			violations = append(violations, subschema.validate(value, keyPath)...)
+		}
+		for _, patternProperty := range n.patternProperties {
+			if patternProperty.pattern.MatchString(key) {
+				matched = true
+				violations = append(violations, patternProperty.schema.validate(value, keyPath)...)
+			}
+		}
+		if matched {
+			continue
+		}
+		if n.noAdditionalProps {
+			violations = append(violations, Violation{keyPath, "additional property is not allowed"})
+		} else if n.additionalProperties != nil {
+			violations = append(violations, n.additionalProperties.validate(value, keyPath)...)
+		}
+	}
+	return violations
+}
+
+func (n *node) validateArray(array []interface{}, path string) []Violation {
+	var violations []Violation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if n.minItems != nil && len(array) < *n.minItems {
+		fail("expected at least %v items, got %v", *n.minItems, len(array))
+	}
+	if n.maxItems != nil && len(array) > *n.maxItems {
+		fail("expected at most %v items, got %v", *n.maxItems, len(array))
+	}
+	if n.uniqueItems {
+	uniqueLoop:
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if equal(array[i], array[j]) {
+					fail("items %v and %v are equal", i, j)
+					break uniqueLoop
+				}
+			}
+		}
+	}
+
+	for i, elem := range array {
+		itemPath := path + "/" + strconv.Itoa(i)
+		switch {
+		case n.items != nil:
+			violations = append(violations, n.items.validate(elem, itemPath)...)
+		case i < len(n.tupleItems):
+			violations = append(violations, n.tupleItems[i].validate(elem, itemPath)...)
+		case n.tupleItems == nil:
+		case n.noAdditionalItems:
+			violations = append(violations, Violation{itemPath, "additional item is not allowed"})
+		case n.additionalItems != nil:
+			violations = append(violations, n.additionalItems.validate(elem, itemPath)...)
+		}
+	}
+	return violations
+}
+
+func (n *node) validateString(str string, path string) []Violation {
+	var violations []Violation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(str)
+	if n.minLength != nil && length < *n.minLength {
+		fail("expected a string of at least %v characters, got %v", *n.minLength, length)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		fail("expected a string of at most %v characters, got %v", *n.maxLength, length)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(str) {
+		fail("string does not match pattern '%v'", n.pattern)
+	}
+	if n.format != "" && !matchesFormat(n.format, str) {
+		fail("string is not a valid %v", n.format)
+	}
+	return violations
+}
+
+func (n *node) validateNumber(number float64, path string) []Violation {
+	var violations []Violation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, Violation{path, fmt.Sprintf(format, args...)})
+	}
+
+	if n.minimum != nil {
+		if n.exclusiveMinimum && number <= *n.minimum {
+			fail("expected a number greater than %v, got %v", *n.minimum, number)
+		} else if number < *n.minimum {
+			fail("expected a number of at least %v, got %v", *n.minimum, number)
+		}
+	}
+	if n.maximum != nil {
+		if n.exclusiveMaximum && number >= *n.maximum {
+			fail("expected a number less than %v, got %v", *n.maximum, number)
+		} else if number > *n.maximum {
+			fail("expected a number of at most %v, got %v", *n.maximum, number)
+		}
+	}
+	if n.multipleOf != nil {
+		quotient := number / *n.multipleOf
+		if quotient != math.Trunc(quotient) {
+			fail("expected a multiple of %v, got %v", *n.multipleOf, number)
+		}
+	}
+	return violations
+}
+
+// matchesFormat checks a string against the formats defined by draft 4.
+// Unknown formats always match.
+func matchesFormat(format, str string) bool {
+	switch format {
+	case "date-time":
+		_, err := util.FormatDate(str)
+		if err != nil {
+			_, err = time.Parse(time.RFC3339Nano, str)
+		}
+		return err == nil
+	case "email":
+		at := strings.Index(str, "@")
+		return at > 0 && at < len(str)-1
+	case "ipv4":
+		ip := net.ParseIP(str)
+		return ip != nil && ip.To4() != nil && strings.Contains(str, ".")
+	case "ipv6":
+		ip := net.ParseIP(str)
+		return ip != nil && strings.Contains(str, ":")
+	case "uri":
+		parsed, err := url.Parse(str)
+		return err == nil && parsed.Scheme != ""
+	}
+	return true
+}
+
+// equal compares two normalized values; object field order is ignored.
+func equal(a, b interface{}) bool {
+	switch valueA := a.(type) {
+	case object:
+		valueB, ok := b.(object)
+		if !ok || len(valueA.values) != len(valueB.values) {
+			return false
+		}
+		for key, elem := range valueA.values {
+			other, ok := valueB.values[key]
+			if !ok || !equal(elem, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		valueB, ok := b.([]interface{})
+		if !ok || len(valueA) != len(valueB) {
+			return false
+		}
+		for i := range valueA {
+			if !equal(valueA[i], valueB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,228 @@
+package text
+
+import (
+	"bufio"
+	"bytes"
+	byteorder "encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Character encodings of text input and output. UTF16 is read in the byte
+// order given by its byte order mark, little-endian if there is none, and
+// written little-endian with a byte order mark.
+const (
+	UTF8    = "utf-8"
+	UTF16   = "utf-16"
+	UTF16LE = "utf-16le"
+	UTF16BE = "utf-16be"
+	Latin1  = "latin1"
+)
+
+// encodingNames maps the accepted names of each encoding to its canonical one.
+var encodingNames = map[string]string{
+	"utf8":       UTF8,
+	"utf-8":      UTF8,
+	"utf16":      UTF16,
+	"utf-16":     UTF16,
+	"utf16le":    UTF16LE,
+	"utf-16le":   UTF16LE,
+	"utf16be":    UTF16BE,
+	"utf-16be":   UTF16BE,
+	"latin1":     Latin1,
+	"latin-1":    Latin1,
+	"iso-8859-1": Latin1,
+	"iso8859-1":  Latin1,
+}
+
+var byteOrderMark = []byte{0xEF, 0xBB, 0xBF}
+
+// ParseEncoding returns the canonical name of the named encoding, or an
+// error if it isn't supported.
+func ParseEncoding(name string) (string, error) {
+	if encoding, ok := encodingNames[strings.ToLower(name)]; ok {
+		return encoding, nil
+	}
+	return "", fmt.Errorf("invalid encoding '%v', choose '%v', '%v', '%v', '%v' or '%v'",
+		name, UTF8, UTF16, UTF16LE, UTF16BE, Latin1)
+}
+
+// NewDecodingReader returns an io.Reader of the text read from in, decoded
+// from the given encoding to UTF-8. A leading byte order mark is skipped.
+func NewDecodingReader(in io.Reader, encoding string) io.Reader {
+	return &decodingReader{in: bufio.NewReader(in), encoding: encoding}
+}
+
+type decodingReader struct {
+	in       *bufio.Reader
+	encoding string
+	order    byteorder.ByteOrder
+	started  bool
+	// pending holds the bytes of a decoded rune that didn't fit in the
+	// last read
+	pending []byte
+}
+
+func (dr *decodingReader) Read(p []byte) (int, error) {
+	if !dr.started {
+		dr.started = true
+		dr.skipByteOrderMark()
+	}
+	if dr.encoding == UTF8 {
+		return dr.in.Read(p)
+	}
+
+	n := copy(p, dr.pending)
+	dr.pending = dr.pending[n:]
+	var buf [utf8.UTFMax]byte
+	for n < len(p) {
+		// don't block for more input once there is some to return
+		if n > 0 && dr.in.Buffered() == 0 {
+			break
+		}
+		r, err := dr.readRune()
+		if err != nil {
+			return n, err
+		}
+		size := utf8.EncodeRune(buf[:], r)
+		copied := copy(p[n:], buf[:size])
+		n += copied
+		if copied < size {
+			dr.pending = append(dr.pending[:0], buf[copied:size]...)
+		}
+	}
+	return n, nil
+}
+
+// skipByteOrderMark discards the byte order mark at the start of the input,
+// if any, and sets the byte order of UTF-16 input.
+func (dr *decodingReader) skipByteOrderMark() {
+	switch dr.encoding {
+	case UTF8:
+		if mark, _ := dr.in.Peek(len(byteOrderMark)); bytes.Equal(mark, byteOrderMark) {
+			dr.in.Discard(len(byteOrderMark))
+		}
+		return
+	case UTF16LE:
+		dr.order = byteorder.LittleEndian
+	case UTF16BE:
+		dr.order = byteorder.BigEndian
+	case UTF16:
+		dr.order = byteorder.LittleEndian
+		if mark, _ := dr.in.Peek(2); bytes.Equal(mark, []byte{0xFE, 0xFF}) {
+			dr.order = byteorder.BigEndian
+		}
+	default:
+		return
+	}
+	if mark, _ := dr.in.Peek(2); len(mark) == 2 && dr.order.Uint16(mark) == 0xFEFF {
+		dr.in.Discard(2)
+	}
+}
+
+func (dr *decodingReader) readRune() (rune, error) {
+	if dr.encoding == Latin1 {
+		b, err := dr.in.ReadByte()
+		return rune(b), err
+	}
+	r1, err := dr.readUnit()
+	if err != nil || !utf16.IsSurrogate(r1) {
+		return r1, err
+	}
+	r2, err := dr.readUnit()
+	if err != nil {
+		return 0, err
+	}
+	return utf16.DecodeRune(r1, r2), nil
+}
+
+// readUnit reads a UTF-16 code unit.
+func (dr *decodingReader) readUnit() (rune, error) {
+	var unit [2]byte
+	if _, err := io.ReadFull(dr.in, unit[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf("truncated UTF-16 input")
+		}
+		return 0, err
+	}
+	return rune(dr.order.Uint16(unit[:])), nil
+}
+
+// NewEncodingWriter returns an io.Writer that encodes the UTF-8 text written
+// to it in the given encoding before writing it to out. The output starts
+// with a byte order mark if bom is true, and always for UTF16. Writing text
+// that Latin-1 can't represent to a Latin1 writer is an error.
+func NewEncodingWriter(out io.Writer, encoding string, bom bool) io.Writer {
+	return &encodingWriter{out: out, encoding: encoding, bom: bom || encoding == UTF16}
+}
+
+type encodingWriter struct {
+	out      io.Writer
+	encoding string
+	bom      bool
+	// partial holds the start of a rune split across writes
+	partial []byte
+	buf     []byte
+}
+
+func (ew *encodingWriter) Write(p []byte) (int, error) {
+	ew.buf = ew.buf[:0]
+	if ew.bom {
+		ew.bom = false
+		ew.buf = ew.appendUnits(ew.buf, 0xFEFF)
+	}
+	if ew.encoding == UTF8 {
+		ew.buf = append(ew.buf, p...)
+	} else {
+		data := p
+		if len(ew.partial) > 0 {
+			data = append(ew.partial, p...)
+			ew.partial = nil
+		}
+		for len(data) > 0 {
+			if !utf8.FullRune(data) {
+				ew.partial = append([]byte(nil), data...)
+				break
+			}
+			r, size := utf8.DecodeRune(data)
+			data = data[size:]
+			if ew.encoding == Latin1 {
+				if r > 0xFF {
+					return 0, fmt.Errorf("character %q can not be encoded as %v", r, Latin1)
+				}
+				ew.buf = append(ew.buf, byte(r))
+				continue
+			}
+			ew.buf = ew.appendUnits(ew.buf, r)
+		}
+	}
+	if _, err := ew.out.Write(ew.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// appendUnits appends the encoding of r to buf, for the UTF encodings.
+func (ew *encodingWriter) appendUnits(buf []byte, r rune) []byte {
+	var order byteorder.ByteOrder = byteorder.LittleEndian
+	switch ew.encoding {
+	case UTF8:
+		var encoded [utf8.UTFMax]byte
+		return append(buf, encoded[:utf8.EncodeRune(encoded[:], r)]...)
+	case UTF16BE:
+		order = byteorder.BigEndian
+	}
+	units := []uint16{uint16(r)}
+	if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		units = []uint16{uint16(r1), uint16(r2)}
+	}
+	for _, unit := range units {
+		var encoded [2]byte
+		order.PutUint16(encoded[:], unit)
+		buf = append(buf, encoded[:]...)
+	}
+	return buf
+}
@@ -0,0 +1,70 @@
+package text
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncodings(t *testing.T) {
+	Convey("With the supported encodings", t, func() {
+		Convey("encoding names should be normalized", func() {
+			encoding, err := ParseEncoding("UTF16LE")
+			So(err, ShouldBeNil)
+			So(encoding, ShouldEqual, UTF16LE)
+			encoding, err = ParseEncoding("ISO-8859-1")
+			So(err, ShouldBeNil)
+			So(encoding, ShouldEqual, Latin1)
+			_, err = ParseEncoding("ebcdic")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a UTF-8 byte order mark should be skipped", func() {
+			decoded, err := ioutil.ReadAll(NewDecodingReader(bytes.NewReader([]byte("\xEF\xBB\xBFa,b\n")), UTF8))
+			So(err, ShouldBeNil)
+			So(string(decoded), ShouldEqual, "a,b\n")
+		})
+
+		Convey("UTF-16 should be read in the order of its byte order mark", func() {
+			input := []byte{0xFE, 0xFF, 0x00, 'a', 0x00, 0xE9, 0xD8, 0x3D, 0xDE, 0x00}
+			decoded, err := ioutil.ReadAll(NewDecodingReader(bytes.NewReader(input), UTF16))
+			So(err, ShouldBeNil)
+			So(string(decoded), ShouldEqual, "aé😀")
+		})
+
+		Convey("truncated UTF-16 should be an error", func() {
+			_, err := ioutil.ReadAll(NewDecodingReader(bytes.NewReader([]byte{'a', 0, 'b'}), UTF16LE))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("text Latin-1 can't represent should not be written as Latin-1", func() {
+			_, err := NewEncodingWriter(&bytes.Buffer{}, Latin1, false).Write([]byte("a€"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("UTF-16 output should start with a byte order mark", func() {
+			out := &bytes.Buffer{}
+			_, err := NewEncodingWriter(out, UTF16, false).Write([]byte("a"))
+			So(err, ShouldBeNil)
+			So(out.Bytes(), ShouldResemble, []byte{0xFF, 0xFE, 'a', 0})
+		})
+
+		for _, encoding := range []string{UTF8, UTF16, UTF16LE, UTF16BE, Latin1} {
+			encoding := encoding
+			Convey("text should round trip through "+encoding, func() {
+				text := "name,café\n\"x\",ÿ\n"
+				out := &bytes.Buffer{}
+				writer := NewEncodingWriter(out, encoding, encoding != Latin1)
+				// split the writes within a multi-byte character
+				for _, b := range []byte(text) {
+					_, err := writer.Write([]byte{b})
+					So(err, ShouldBeNil)
+				}
+				decoded, err := ioutil.ReadAll(NewDecodingReader(out, encoding))
+				So(err, ShouldBeNil)
+				So(string(decoded), ShouldEqual, text)
+			})
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package transform
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// getValue returns the value at the given path in the document, descending
+// into ordered and unordered subdocuments. The boolean result is false if no
+// such field exists.
+func getValue(document interface{}, path []string) (interface{}, bool) {
+	var value interface{}
+	var found bool
+	switch doc := document.(type) {
+	case bson.D:
+		for _, elem := range doc {
+			if elem.Name == path[0] {
+				value, found = elem.Value, true
+				break
+			}
+		}
+	case *bson.D:
+		return getValue(*doc, path)
+	case bson.M:
+		value, found = doc[path[0]]
+	case map[string]interface{}:
+		value, found = doc[path[0]]
+	}
+	if !found || len(path) == 1 {
+		return value, found
+	}
+	return getValue(value, path[1:])
+}
+
+// setValue sets the value at the given path in the document, creating any
+// missing subdocuments along the way, and returns the updated document.
+func setValue(document bson.D, path []string, value interface{}) bson.D {
+	for i := range document {
+		if document[i].Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			document[i].Value = value
+		} else {
+			document[i].Value = setSubdocumentValue(document[i].Value, path[1:], value)
+		}
+		return document
+	}
+	if len(path) == 1 {
+		return append(document, bson.DocElem{path[0], value})
+	}
+	return append(document, bson.DocElem{path[0], setValue(bson.D{}, path[1:], value)})
+}
+
+// setSubdocumentValue is a helper to setValue that sets the value within an
+// existing field; a field that isn't a subdocument is replaced by one.
+func setSubdocumentValue(subdocument interface{}, path []string, value interface{}) interface{} {
+	switch doc := subdocument.(type) {
+	case bson.D:
+		return setValue(doc, path, value)
+	case *bson.D:
+		*doc = setValue(*doc, path, value)
+		return doc
+	case bson.M:
+		setMapValue(doc, path, value)
+		return doc
+	case map[string]interface{}:
+		setMapValue(doc, path, value)
+		return doc
+	}
+	return setValue(bson.D{}, path, value)
+}
+
+func setMapValue(document map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 1 {
+		document[path[0]] = value
+		return
+	}
+	subdocument, ok := document[path[0]]
+	if !ok {
+		subdocument = bson.M{}
+	}
+	document[path[0]] = setSubdocumentValue(subdocument, path[1:], value)
+}
+
+// removeValue removes the field at the given path from the document and
+// returns the updated document along with whether the field existed.
+func removeValue(document bson.D, path []string) (bson.D, bool) {
+	for i := range document {
+		if document[i].Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return append(document[:i], document[i+1:]...), true
+		}
+		var removed bool
+		document[i].Value, removed = removeSubdocumentValue(document[i].Value, path[1:])
+		return document, removed
+	}
+	return document, false
+}
+
+func removeSubdocumentValue(subdocument interface{}, path []string) (interface{}, bool) {
+	var removed bool
+	switch doc := subdocument.(type) {
+	case bson.D:
+		return removeValue(doc, path)
+	case *bson.D:
+		*doc, removed = removeValue(*doc, path)
+		return doc, removed
+	case bson.M:
+		return doc, removeMapValue(doc, path)
+	case map[string]interface{}:
+		return doc, removeMapValue(doc, path)
+	}
+	return subdocument, false
+}
+
+func removeMapValue(document map[string]interface{}, path []string) bool {
+	value, ok := document[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		delete(document, path[0])
+		return true
+	}
+	var removed bool
+	document[path[0]], removed = removeSubdocumentValue(value, path[1:])
+	return removed
+}
@@ -0,0 +1,376 @@
+// Package transform implements declarative, per-document field transformations
+// that can be applied to documents as they are imported or exported.
+package transform
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations supported in a transform step.
+const (
+	Rename  = "rename"
+	Drop    = "drop"
+	Cast    = "cast"
+	Compute = "compute"
+	Split   = "split"
+	Join    = "join"
+	Date    = "date"
+	Format  = "format"
+)
+
+// Types that values can be cast to using the "cast" operation.
+const (
+	TypeInt      = "int"
+	TypeLong     = "long"
+	TypeDouble   = "double"
+	TypeString   = "string"
+	TypeBool     = "bool"
+	TypeObjectId = "objectId"
+)
+
+const defaultSeparator = ","
+
+// Step is a single transformation applied to a document. Field (and To, for
+// renames) may use dot notation to address nested documents; intermediate
+// documents are created as needed when setting a value.
+type Step struct {
+	// Op is the operation to perform - e.g. "rename" or "cast"
+	Op string `json:"op"`
+
+	// Field is the field the operation applies to
+	Field string `json:"field"`
+
+	// To is the new name of the field for "rename" operations
+	To string `json:"to"`
+
+	// Type is the target type for "cast" operations
+	Type string `json:"type"`
+
+	// Template is used to build the value of "compute" operations. Fields
+	// from the document are referenced as ${field} or ${nested.field}
+	Template string `json:"template"`
+
+	// Separator is used by "split" and "join" operations (defaults to ",")
+	Separator string `json:"separator"`
+
+	// Layout is a Go time layout used by "date" and "format" operations. If
+	// empty, ISO-8601 dates are accepted and RFC 3339 dates are written
+	Layout string `json:"layout"`
+}
+
+// Transformer applies an ordered list of steps to documents.
+type Transformer struct {
+	Steps []Step
+}
+
+// New returns a Transformer for the given steps, or an error if any of the
+// steps is invalid.
+func New(steps []Step) (*Transformer, error) {
+	for i, step := range steps {
+		if err := step.validate(); err != nil {
+			return nil, fmt.Errorf("invalid transform step #%v: %v", i+1, err)
+		}
+	}
+	return &Transformer{steps}, nil
+}
+
+// NewFromFile reads a JSON array of steps from the file at the given path and
+// returns the corresponding Transformer.
+func NewFromFile(path string) (*Transformer, error) {
+	file, err := os.Open(util.ToUniversalPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error opening transform file: %v", err)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading transform file: %v", err)
+	}
+	var steps []Step
+	if err = json.Unmarshal(data, &steps); err != nil {
+		return nil, fmt.Errorf("error parsing transform file '%v': %v", path, err)
+	}
+	return New(steps)
+}
+
+func (step Step) validate() error {
+	if step.Field == "" {
+		return fmt.Errorf("'%v' requires a field", step.Op)
+	}
+	switch step.Op {
+	case Rename:
+		if step.To == "" {
+			return fmt.Errorf("rename of '%v' requires a target name", step.Field)
+		}
+	case Cast:
+		switch step.Type {
+		case TypeInt, TypeLong, TypeDouble, TypeString, TypeBool, TypeObjectId:
+		default:
+			return fmt.Errorf("unknown cast type '%v' for '%v'", step.Type, step.Field)
+		}
+	case Compute:
+		if step.Template == "" {
+			return fmt.Errorf("compute of '%v' requires a template", step.Field)
+		}
+	case Drop, Split, Join, Date, Format:
+	default:
+		return fmt.Errorf("unknown operation '%v'", step.Op)
+	}
+	return nil
+}
+
+// Reverse returns a Transformer that undoes the reversible steps of t, in
+// reverse order, so that documents written by one tool can be read back by
+// another. Renames are inverted, splits become joins, parsed dates are
+// formatted with the same layout and computed fields are dropped. Drops and
+// casts can not be undone, since the original value or type is unknown, and
+// are skipped.
+func (t *Transformer) Reverse() *Transformer {
+	reversed := &Transformer{}
+	for i := len(t.Steps) - 1; i >= 0; i-- {
+		step := t.Steps[i]
+		switch step.Op {
+		case Rename:
+			reversed.Steps = append(reversed.Steps, Step{Op: Rename, Field: step.To, To: step.Field})
+		case Compute:
+			reversed.Steps = append(reversed.Steps, Step{Op: Drop, Field: step.Field})
+		case Split:
+			reversed.Steps = append(reversed.Steps, Step{Op: Join, Field: step.Field, Separator: step.Separator})
+		case Join:
+			reversed.Steps = append(reversed.Steps, Step{Op: Split, Field: step.Field, Separator: step.Separator})
+		case Date:
+			reversed.Steps = append(reversed.Steps, Step{Op: Format, Field: step.Field, Layout: step.Layout})
+		case Format:
+			reversed.Steps = append(reversed.Steps, Step{Op: Date, Field: step.Field, Layout: step.Layout})
+		}
+	}
+	return reversed
+}
+
+// Apply runs every step of the transformer against the document and returns
+// the transformed document, which may share storage with the original. Steps
+// that reference missing fields are no-ops.
+func (t *Transformer) Apply(document bson.D) (bson.D, error) {
+	for _, step := range t.Steps {
+		var err error
+		if document, err = step.apply(document); err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+// ApplyMap is like Apply but operates on an unordered document.
+func (t *Transformer) ApplyMap(document bson.M) (bson.M, error) {
+	orderedDocument := make(bson.D, 0, len(document))
+	for key, value := range document {
+		orderedDocument = append(orderedDocument, bson.DocElem{key, value})
+	}
+	orderedDocument, err := t.Apply(orderedDocument)
+	if err != nil {
+		return nil, err
+	}
+	return orderedDocument.Map(), nil
+}
+
+func (step Step) apply(document bson.D) (bson.D, error) {
+	path := strings.Split(step.Field, ".")
+	if step.Op == Compute {
+		value := os.Expand(step.Template, func(field string) string {
+			fieldValue, ok := getValue(document, strings.Split(field, "."))
+			if !ok || fieldValue == nil {
+				return ""
+			}
+			return fmt.Sprintf("%v", fieldValue)
+		})
+		return setValue(document, path, value), nil
+	}
+
+	value, ok := getValue(document, path)
+	if !ok {
+		return document, nil
+	}
+
+	var err error
+	switch step.Op {
+	case Rename:
+		document, _ = removeValue(document, path)
+		return setValue(document, strings.Split(step.To, "."), value), nil
+	case Drop:
+		document, _ = removeValue(document, path)
+		return document, nil
+	case Cast:
+		value, err = CastValue(value, step.Type)
+	case Split:
+		value, err = splitValue(value, step.separator())
+	case Join:
+		value, err = joinValue(value, step.separator())
+	case Date:
+		value, err = ParseDate(value, step.Layout)
+	case Format:
+		value, err = formatDate(value, step.Layout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error applying %v to '%v': %v", step.Op, step.Field, err)
+	}
+	return setValue(document, path, value), nil
+}
+
+func (step Step) separator() string {
+	if step.Separator == "" {
+		return defaultSeparator
+	}
+	return step.Separator
+}
+
+// CastValue converts value to the given cast type, parsing strings as necessary.
+func CastValue(value interface{}, toType string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if toType == TypeString {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case bson.ObjectId:
+			return v.Hex(), nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		default:
+			return fmt.Sprintf("%v", v), nil
+		}
+	}
+
+	str, isString := value.(string)
+	if isString {
+		str = strings.TrimSpace(str)
+	}
+	switch toType {
+	case TypeInt, TypeLong:
+		var number int64
+		var err error
+		if isString {
+			number, err = strconv.ParseInt(str, 10, 64)
+		} else {
+			number, err = toInt64(value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if toType == TypeInt {
+			if number < math.MinInt32 || number > math.MaxInt32 {
+				return nil, fmt.Errorf("%v is out of range for type int", value)
+			}
+			return int32(number), nil
+		}
+		return number, nil
+	case TypeDouble:
+		if isString {
+			return strconv.ParseFloat(str, 64)
+		}
+		return util.ToFloat64(value)
+	case TypeBool:
+		if isString {
+			return strconv.ParseBool(str)
+		}
+		return util.IsTruthy(value), nil
+	case TypeObjectId:
+		if !isString || !bson.IsObjectIdHex(str) {
+			return nil, fmt.Errorf("'%v' is not a valid ObjectId", value)
+		}
+		return bson.ObjectIdHex(str), nil
+	}
+	return nil, fmt.Errorf("unknown cast type '%v'", toType)
+}
+
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	floatValue, err := util.ToFloat64(value)
+	if err != nil {
+		return 0, err
+	}
+	// only whole numbers are cast, rather than silently truncating fractions
+	if floatValue != math.Trunc(floatValue) || floatValue < math.MinInt64 || floatValue >= math.MaxInt64 {
+		return 0, fmt.Errorf("%v is not an integer in the range of type long", value)
+	}
+	return int64(floatValue), nil
+}
+
+// splitValue splits a string into an array of strings.
+func splitValue(value interface{}, separator string) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %T", value)
+	}
+	array := []interface{}{}
+	if str == "" {
+		return array, nil
+	}
+	for _, token := range strings.Split(str, separator) {
+		array = append(array, strings.TrimSpace(token))
+	}
+	return array, nil
+}
+
+// joinValue joins the elements of an array into a single string.
+func joinValue(value interface{}, separator string) (interface{}, error) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an array, got %T", value)
+	}
+	tokens := make([]string, 0, len(array))
+	for _, elem := range array {
+		tokens = append(tokens, fmt.Sprintf("%v", elem))
+	}
+	return strings.Join(tokens, separator), nil
+}
+
+// ParseDate parses a string into a date using the given layout, or any of the
+// ISO-8601 formats accepted by the tools if no layout is given.
+func ParseDate(value interface{}, layout string) (interface{}, error) {
+	if date, ok := value.(time.Time); ok {
+		return date, nil
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %T", value)
+	}
+	if layout == "" {
+		return util.FormatDate(str)
+	}
+	return time.Parse(layout, str)
+}
+
+// formatDate formats a date as a string using the given layout, or RFC 3339
+// if no layout is given.
+func formatDate(value interface{}, layout string) (interface{}, error) {
+	date, ok := value.(time.Time)
+	if !ok {
+		return nil, fmt.Errorf("expected a date, got %T", value)
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	return date.Format(layout), nil
+}
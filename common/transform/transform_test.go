@@ -0,0 +1,217 @@
+package transform
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewTransformer(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When creating a transformer", t, func() {
+		Convey("valid steps should not return an error", func() {
+			_, err := New([]Step{
+				{Op: Rename, Field: "a", To: "b"},
+				{Op: Cast, Field: "b", Type: TypeInt},
+				{Op: Compute, Field: "c", Template: "${b}"},
+			})
+			So(err, ShouldBeNil)
+		})
+		Convey("an unknown operation should return an error", func() {
+			_, err := New([]Step{{Op: "explode", Field: "a"}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("a step without a field should return an error", func() {
+			_, err := New([]Step{{Op: Drop}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("a rename without a target should return an error", func() {
+			_, err := New([]Step{{Op: Rename, Field: "a"}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("a cast to an unknown type should return an error", func() {
+			_, err := New([]Step{{Op: Cast, Field: "a", Type: "complex"}})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("steps should be read from a JSON file", func() {
+			file, err := ioutil.TempFile("", "transform")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			_, err = file.WriteString(`[{"op": "rename", "field": "a", "to": "b"}, {op: "drop", field: "c"}]`)
+			So(err, ShouldBeNil)
+			file.Close()
+
+			transformer, err := NewFromFile(file.Name())
+			So(err, ShouldBeNil)
+			So(transformer.Steps, ShouldResemble, []Step{
+				{Op: Rename, Field: "a", To: "b"},
+				{Op: Drop, Field: "c"},
+			})
+		})
+		Convey("a missing file should return an error", func() {
+			_, err := NewFromFile("this/file/does/not/exist.json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestApply(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Given a document to transform", t, func() {
+		document := bson.D{
+			{"first", "Jane"},
+			{"last", "Doe"},
+			{"age", "42"},
+			{"tags", "a, b,c"},
+			{"born", "1973-05-09"},
+			{"address", &bson.D{{"city", "Dublin"}}},
+		}
+
+		Convey("renaming should move the value and keep the others", func() {
+			transformer, err := New([]Step{{Op: Rename, Field: "first", To: "firstName"}})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(len(result), ShouldEqual, 6)
+			So(result[5], ShouldResemble, bson.DocElem{"firstName", "Jane"})
+		})
+
+		Convey("renaming to a dotted name should build nested documents", func() {
+			transformer, err := New([]Step{
+				{Op: Rename, Field: "first", To: "name.first"},
+				{Op: Rename, Field: "last", To: "name.last"},
+				{Op: Rename, Field: "address.city", To: "address.town"},
+			})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(result[len(result)-1], ShouldResemble, bson.DocElem{"name",
+				bson.D{{"first", "Jane"}, {"last", "Doe"}}})
+			So(*result[3].Value.(*bson.D), ShouldResemble, bson.D{{"town", "Dublin"}})
+		})
+
+		Convey("dropping should remove top-level and nested fields", func() {
+			transformer, err := New([]Step{
+				{Op: Drop, Field: "age"},
+				{Op: Drop, Field: "address.city"},
+				{Op: Drop, Field: "missing"},
+			})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(len(result), ShouldEqual, 5)
+			So(*result[4].Value.(*bson.D), ShouldResemble, bson.D{})
+		})
+
+		Convey("casting should convert values to the requested type", func() {
+			transformer, err := New([]Step{{Op: Cast, Field: "age", Type: TypeInt}})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(result[2].Value, ShouldEqual, int32(42))
+
+			for _, big := range []interface{}{"3000000000", int64(-3000000000), 3e9} {
+				_, err = CastValue(big, TypeInt)
+				So(err, ShouldNotBeNil)
+			}
+			long, err := CastValue("3000000000", TypeLong)
+			So(err, ShouldBeNil)
+			So(long, ShouldEqual, int64(3000000000))
+
+			for _, fraction := range []interface{}{3.7, -0.5, "3.7"} {
+				_, err = CastValue(fraction, TypeLong)
+				So(err, ShouldNotBeNil)
+			}
+			whole, err := CastValue(3.0, TypeInt)
+			So(err, ShouldBeNil)
+			So(whole, ShouldEqual, int32(3))
+
+			transformer, err = New([]Step{{Op: Cast, Field: "first", Type: TypeDouble}})
+			So(err, ShouldBeNil)
+			_, err = transformer.Apply(document)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("computing should fill in templates from other fields", func() {
+			transformer, err := New([]Step{{Op: Compute, Field: "full",
+				Template: "${first} ${last} of ${address.city}${missing}"}})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(result[6], ShouldResemble, bson.DocElem{"full", "Jane Doe of Dublin"})
+		})
+
+		Convey("splitting should turn a string into a trimmed array", func() {
+			transformer, err := New([]Step{{Op: Split, Field: "tags"}})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(result[3].Value, ShouldResemble, []interface{}{"a", "b", "c"})
+		})
+
+		Convey("dates should be parsed with the given layout", func() {
+			transformer, err := New([]Step{{Op: Date, Field: "born", Layout: "2006-01-02"}})
+			So(err, ShouldBeNil)
+			result, err := transformer.Apply(document)
+			So(err, ShouldBeNil)
+			So(result[4].Value, ShouldResemble, time.Date(1973, 5, 9, 0, 0, 0, 0, time.UTC))
+
+			transformer, err = New([]Step{{Op: Date, Field: "born", Layout: "02/01/2006"}})
+			So(err, ShouldBeNil)
+			_, err = transformer.Apply(bson.D{{"born", "1973-05-09"}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestReverse(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Given a transformer and its reverse", t, func() {
+		transformer, err := New([]Step{
+			{Op: Rename, Field: "first", To: "name.first"},
+			{Op: Drop, Field: "tmp"},
+			{Op: Cast, Field: "age", Type: TypeLong},
+			{Op: Split, Field: "tags", Separator: ";"},
+			{Op: Date, Field: "born", Layout: "2006-01-02"},
+			{Op: Compute, Field: "greeting", Template: "hi ${name.first}"},
+		})
+		So(err, ShouldBeNil)
+		reversed := transformer.Reverse()
+
+		Convey("the reversed steps should run in the opposite order", func() {
+			So(reversed.Steps, ShouldResemble, []Step{
+				{Op: Drop, Field: "greeting"},
+				{Op: Format, Field: "born", Layout: "2006-01-02"},
+				{Op: Join, Field: "tags", Separator: ";"},
+				{Op: Rename, Field: "name.first", To: "first"},
+			})
+		})
+
+		Convey("applying both should round trip the document", func() {
+			original := bson.D{
+				{"first", "Jane"},
+				{"age", int64(42)},
+				{"tags", "x;y"},
+				{"born", "1973-05-09"},
+			}
+			transformed, err := transformer.Apply(append(bson.D{}, original...))
+			So(err, ShouldBeNil)
+			result, err := reversed.ApplyMap(transformed.Map())
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, bson.M{
+				"first": "Jane",
+				"age":   int64(42),
+				"tags":  "x;y",
+				"born":  "1973-05-09",
+				"name":  bson.D{},
+			})
+		})
+	})
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+)
+
+// Compressors that can be used for tool input and output files.
+const (
+	NoCompressor   = "none"
+	GzipCompressor = "gzip"
+	ZstdCompressor = "zstd"
+)
+
+// compressorExtensions maps each compressor to its file extension.
+var compressorExtensions = map[string]string{
+	GzipCompressor: ".gz",
+	ZstdCompressor: ".zst",
+}
+
+// ValidateCompressor returns an error if compressor isn't a supported
+// compressor name.
+func ValidateCompressor(compressor string) error {
+	switch compressor {
+	case NoCompressor, GzipCompressor, ZstdCompressor:
+		return nil
+	}
+	return fmt.Errorf("invalid compressor '%v', choose '%v', '%v' or '%v'",
+		compressor, NoCompressor, GzipCompressor, ZstdCompressor)
+}
+
+// CompressorExtension returns the file extension for files written by the
+// compressor, or an empty string for NoCompressor.
+func CompressorExtension(compressor string) string {
+	return compressorExtensions[compressor]
+}
+
+// CompressorFromPath returns the compressor implied by the extension of
+// path, or NoCompressor if the extension isn't one of a compressor.
+func CompressorFromPath(path string) string {
+	for compressor, extension := range compressorExtensions {
+		if strings.HasSuffix(strings.ToLower(path), extension) {
+			return compressor
+		}
+	}
+	return NoCompressor
+}
+
+// TrimCompressorExtension returns path without the extension of the
+// compressor implied by it, if any.
+func TrimCompressorExtension(path string) string {
+	return path[:len(path)-len(CompressorExtension(CompressorFromPath(path)))]
+}
+
+// NewDecompressingReader returns an io.ReadCloser reading the data from in
+// decompressed with the given compressor. Closing it also closes in.
+func NewDecompressingReader(in io.ReadCloser, compressor string) (io.ReadCloser, error) {
+	switch compressor {
+	case NoCompressor:
+		return in, nil
+	case GzipCompressor:
+		reader, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, fmt.Errorf("error reading gzip data: %v", err)
+		}
+		return &wrappedReadCloser{reader, in}, nil
+	case ZstdCompressor:
+		decoder, err := zstd.NewReader(in)
+		if err != nil {
+			return nil, fmt.Errorf("error reading zstd data: %v", err)
+		}
+		return &wrappedReadCloser{decoder.IOReadCloser(), in}, nil
+	}
+	return nil, ValidateCompressor(compressor)
+}
+
+// NewCompressingWriter returns an io.WriteCloser compressing the data
+// written to it with the given compressor before writing it to out. Closing
+// it flushes the compressed data, then closes out.
+func NewCompressingWriter(out io.WriteCloser, compressor string) (io.WriteCloser, error) {
+	switch compressor {
+	case NoCompressor:
+		return out, nil
+	case GzipCompressor:
+		return &wrappedWriteCloser{gzip.NewWriter(out), out}, nil
+	case ZstdCompressor:
+		encoder, err := zstd.NewWriter(out)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd writer: %v", err)
+		}
+		return &wrappedWriteCloser{encoder, out}, nil
+	}
+	return nil, ValidateCompressor(compressor)
+}
+
+// wrappedReadCloser is an io.ReadCloser reading through a decompressor.
+// Close closes both the decompressor and the inner io.ReadCloser.
+type wrappedReadCloser struct {
+	io.ReadCloser
+	inner io.ReadCloser
+}
+
+func (wrc *wrappedReadCloser) Close() error {
+	err := wrc.ReadCloser.Close()
+	if innerErr := wrc.inner.Close(); err == nil {
+		err = innerErr
+	}
+	return err
+}
+
+// wrappedWriteCloser is an io.WriteCloser writing through a compressor.
+// Close closes both the compressor and the inner io.WriteCloser.
+type wrappedWriteCloser struct {
+	io.WriteCloser
+	inner io.WriteCloser
+}
+
+func (wwc *wrappedWriteCloser) Close() error {
+	err := wwc.WriteCloser.Close()
+	if innerErr := wwc.inner.Close(); err == nil {
+		err = innerErr
+	}
+	return err
+}
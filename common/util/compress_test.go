@@ -0,0 +1,61 @@
+package util
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"testing"
+)
+
+// closingBuffer is a bytes.Buffer that records whether it was closed.
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (cb *closingBuffer) Close() error {
+	cb.closed = true
+	return nil
+}
+
+func TestCompressors(t *testing.T) {
+	Convey("With the supported compressors", t, func() {
+		Convey("compressors should be found from file extensions", func() {
+			So(CompressorFromPath("a/b.json.gz"), ShouldEqual, GzipCompressor)
+			So(CompressorFromPath("b.CSV.ZST"), ShouldEqual, ZstdCompressor)
+			So(CompressorFromPath("b.json"), ShouldEqual, NoCompressor)
+			So(TrimCompressorExtension("b.json.gz"), ShouldEqual, "b.json")
+			So(TrimCompressorExtension("b.json"), ShouldEqual, "b.json")
+		})
+
+		Convey("unknown compressors should be rejected", func() {
+			So(ValidateCompressor("zstd"), ShouldBeNil)
+			So(ValidateCompressor("lzma"), ShouldNotBeNil)
+			_, err := NewCompressingWriter(&closingBuffer{}, "lzma")
+			So(err, ShouldNotBeNil)
+		})
+
+		for _, compressor := range []string{NoCompressor, GzipCompressor, ZstdCompressor} {
+			compressor := compressor
+			Convey("data should round trip through "+compressor, func() {
+				data := bytes.Repeat([]byte(`{"a":1,"b":"two"}`+"\n"), 1000)
+				compressed := &closingBuffer{}
+				writer, err := NewCompressingWriter(compressed, compressor)
+				So(err, ShouldBeNil)
+				_, err = writer.Write(data)
+				So(err, ShouldBeNil)
+				So(writer.Close(), ShouldBeNil)
+				So(compressed.closed, ShouldBeTrue)
+				if compressor != NoCompressor {
+					So(compressed.Len(), ShouldBeLessThan, len(data))
+				}
+
+				reader, err := NewDecompressingReader(compressed, compressor)
+				So(err, ShouldBeNil)
+				decompressed, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(decompressed, ShouldResemble, data)
+			})
+		}
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -77,6 +78,12 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("cannot run a query with --repair enabled")
 	case dump.OutputOptions.Out != "" && dump.OutputOptions.Archive != "":
 		return fmt.Errorf("--out not allowed when --archive is specified")
+	case dump.InputOptions.Explain && (dump.OutputOptions.Repair || dump.OutputOptions.Archive != "" || dump.OutputOptions.Oplog):
+		return fmt.Errorf("--explain cannot be used with --repair, --archive or --oplog")
+	case dump.InputOptions.MaxCollScanDocs < 0:
+		return fmt.Errorf("--maxCollScanDocs cannot be negative")
+	case dump.InputOptions.AllowCollScan && dump.InputOptions.MaxCollScanDocs == 0:
+		return fmt.Errorf("--allowCollScan can only be used with --maxCollScanDocs")
 	}
 	return nil
 }
@@ -215,6 +222,16 @@ func (dump *MongoDump) Dump() (err error) {
 		}
 	}
 
+	if dump.InputOptions.Explain ||
+		(dump.InputOptions.MaxCollScanDocs > 0 && !dump.InputOptions.AllowCollScan) {
+		if err = dump.ExplainIntents(); err != nil {
+			return err
+		}
+		if dump.InputOptions.Explain {
+			return nil
+		}
+	}
+
 	// IO Phase I
 	// metadata, users, roles, and versions
 
@@ -406,16 +423,10 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	}
 	defer intent.BSONFile.Close()
 
-	var findQuery *mgo.Query
-	switch {
-	case len(dump.query) > 0:
-		findQuery = session.DB(intent.DB).C(intent.C).Find(dump.query)
-	case dump.InputOptions.TableScan:
-		// ---forceTablesScan runs the query without snapshot enabled
-		findQuery = session.DB(intent.DB).C(intent.C).Find(nil)
-	default:
-		findQuery = session.DB(intent.DB).C(intent.C).Find(nil).Snapshot()
-
+	find := dump.getFindQuery()
+	findQuery := session.DB(intent.DB).C(intent.C).Find(find.Filter)
+	if find.Snapshot {
+		findQuery = findQuery.Snapshot()
 	}
 
 	if dump.useStdout {
@@ -449,6 +460,59 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent) error {
 	return nil
 }
 
+// getFindQuery returns the filter and snapshot mode of the find run by
+// DumpIntent for each collection.
+func (dump *MongoDump) getFindQuery() db.FindQuery {
+	switch {
+	case len(dump.query) > 0:
+		return db.FindQuery{Filter: dump.query}
+	case dump.InputOptions.TableScan:
+		// ---forceTablesScan runs the query without snapshot enabled
+		return db.FindQuery{}
+	}
+	return db.FindQuery{Snapshot: true}
+}
+
+// ExplainIntents logs the plan the server chooses for the find DumpIntent
+// runs on each collection to dump. Unless --allowCollScan is given, it
+// returns an error if a plan is a collection scan of more documents than
+// --maxCollScanDocs.
+func (dump *MongoDump) ExplainIntents() error {
+	session, err := dump.sessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var namespaces []string
+	collections := map[string]*intents.Intent{}
+	for _, intent := range dump.manager.Intents() {
+		if intent.IsOplog() || intent.IsUsers() || intent.IsRoles() ||
+			intent.IsAuthVersion() || intent.IsSystemIndexes() {
+			continue
+		}
+		namespaces = append(namespaces, intent.Namespace())
+		collections[intent.Namespace()] = intent
+	}
+	sort.Strings(namespaces)
+
+	find := dump.getFindQuery()
+	for _, namespace := range namespaces {
+		intent := collections[namespace]
+		plan, err := db.ExplainFind(session.DB(intent.DB).C(intent.C), find)
+		if err != nil {
+			return err
+		}
+		log.Logf(log.Always, "query plan of %v", plan)
+		if !dump.InputOptions.AllowCollScan {
+			if err = plan.CheckCollScan(dump.InputOptions.MaxCollScanDocs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // dumpQueryToWriter takes an mgo Query, its intent, and a writer, performs the query,
 // and writes the raw bson results to the writer.
 func (dump *MongoDump) dumpQueryToWriter(
@@ -251,6 +251,24 @@ func TestMongoDumpValidateOptions(t *testing.T) {
 			So(err.Error(), ShouldContainSubstring, "cannot dump using a query without a specified collection")
 		})
 
+		Convey("we cannot explain an archive dump", func() {
+			md.InputOptions.Explain = true
+			md.OutputOptions.Archive = "-"
+			md.OutputOptions.Out = ""
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--explain cannot be used with")
+		})
+
+		Convey("we have to specify --maxCollScanDocs to allow collection scans", func() {
+			md.InputOptions.AllowCollScan = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--allowCollScan can only be used with --maxCollScanDocs")
+		})
+
 	})
 }
 
@@ -10,8 +10,11 @@ See http://docs.mongodb.org/manual/reference/program/mongodump/ for more informa
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query     string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	TableScan bool   `long:"forceTableScan" description:"force a table scan"`
+	Query           string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	TableScan       bool   `long:"forceTableScan" description:"force a table scan"`
+	Explain         bool   `long:"explain" description:"instead of dumping, report the winning plan of the query on each collection, the indexes it uses and the estimated number of documents it examines"`
+	MaxCollScanDocs int64  `long:"maxCollScanDocs" description:"refuse to dump if the query on a collection scans the whole collection and is estimated to examine more than this many documents"`
+	AllowCollScan   bool   `long:"allowCollScan" description:"dump even if the query on a collection is a collection scan over --maxCollScanDocs"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -0,0 +1,235 @@
+package mongoexport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/archive"
+	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/intents"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+// archiveMetadata is the collection metadata stored in the archive prelude,
+// in the format written by mongodump.
+type archiveMetadata struct {
+	Options interface{}   `json:"options,omitempty"`
+	Indexes []interface{} `json:"indexes"`
+}
+
+// ArchiveExporter writes documents into an archive holding a single
+// namespace, in the format written by mongodump --archive, so that it can
+// be restored with mongorestore --archive. It isn't an ExportOutput, since
+// it writes ordered documents.
+type ArchiveExporter struct {
+	// Metadata is the collection options and indexes, as JSON.
+	Metadata    string
+	Out         io.Writer
+	NumExported int64
+
+	intent *intents.Intent
+	writer *archive.Writer
+	muxIn  *archive.MuxIn
+}
+
+// NewArchiveExporter creates a new ArchiveExporter for the namespace
+// dbName.collection, configured to write the archive to the given io.Writer.
+func NewArchiveExporter(dbName, collection, metadata string, out io.Writer) *ArchiveExporter {
+	return &ArchiveExporter{
+		Metadata: metadata,
+		Out:      out,
+		intent: &intents.Intent{
+			DB:       dbName,
+			C:        collection,
+			BSONPath: dbName + "." + collection,
+		},
+	}
+}
+
+// WriteHeader writes the archive prelude, which describes the namespace and
+// its metadata, and starts multiplexing documents into the archive.
+func (archiveExporter *ArchiveExporter) WriteHeader() error {
+	// the multiplexer closes its output when it's done, but we don't own it
+	out := &nopCloseWriter{archiveExporter.Out}
+	archiveExporter.writer = &archive.Writer{
+		Out: out,
+		Mux: archive.NewMultiplexer(out),
+	}
+	archiveExporter.intent.MetadataFile = &archive.MetadataFile{
+		Intent: archiveExporter.intent,
+		Buffer: bytes.NewBufferString(archiveExporter.Metadata),
+	}
+	archiveExporter.muxIn = &archive.MuxIn{
+		Intent: archiveExporter.intent,
+		Mux:    archiveExporter.writer.Mux,
+	}
+	archiveExporter.intent.BSONFile = archiveExporter.muxIn
+
+	manager := intents.NewIntentManager()
+	manager.Put(archiveExporter.intent)
+	prelude, err := archive.NewPrelude(manager, 1)
+	if err != nil {
+		return fmt.Errorf("error creating archive prelude: %v", err)
+	}
+	archiveExporter.writer.Prelude = prelude
+	if err = prelude.Write(out); err != nil {
+		return fmt.Errorf("error writing metadata into archive: %v", err)
+	}
+
+	go archiveExporter.writer.Mux.Run()
+	if err = archiveExporter.muxIn.Open(); err != nil {
+		// stop the multiplexer, since there is nothing to write a footer for
+		close(archiveExporter.writer.Mux.Control)
+		<-archiveExporter.writer.Mux.Completed
+		return err
+	}
+	return nil
+}
+
+// WriteDocument writes the document into the archive. It takes a bson.D so
+// that the order of the fields is preserved.
+func (archiveExporter *ArchiveExporter) WriteDocument(document bson.D) error {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("error converting document to BSON: %v", err)
+	}
+	if _, err = archiveExporter.muxIn.Write(data); err != nil {
+		return fmt.Errorf("error writing document into archive: %v", err)
+	}
+	archiveExporter.NumExported++
+	return nil
+}
+
+// WriteFooter ends the namespace and waits for the multiplexer to finish
+// writing the archive.
+func (archiveExporter *ArchiveExporter) WriteFooter() error {
+	closeErr := archiveExporter.muxIn.Close()
+	// the multiplexer runs until its Control is closed
+	close(archiveExporter.writer.Mux.Control)
+	muxErr := <-archiveExporter.writer.Mux.Completed
+	if closeErr != nil {
+		return fmt.Errorf("error writing archive: %v", closeErr)
+	}
+	if muxErr != nil {
+		return fmt.Errorf("error writing archive: %v", muxErr)
+	}
+	return nil
+}
+
+// Flush is a no-op for archives.
+func (archiveExporter *ArchiveExporter) Flush() error {
+	return nil
+}
+
+// nopCloseWriter implements io.WriteCloser. It wraps up a io.Writer, and adds a no-op Close.
+type nopCloseWriter struct {
+	io.Writer
+}
+
+// Close does nothing on nopCloseWriters.
+func (*nopCloseWriter) Close() error {
+	return nil
+}
+
+// exportArchive exports the documents into an archive written to out. It
+// returns the number of documents exported. The archive is ended even if
+// the export fails part way through.
+func (exp *MongoExport) exportArchive(out io.Writer) (numExported int64, err error) {
+	metadata, err := exp.getArchiveMetadata()
+	if err != nil {
+		return 0, err
+	}
+	archiveExporter := NewArchiveExporter(exp.ToolOptions.Namespace.DB,
+		exp.ToolOptions.Namespace.Collection, metadata, out)
+
+	cursor, session, err := exp.getCursor()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	defer cursor.Close()
+
+	if err = archiveExporter.WriteHeader(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		// the multiplexer runs until the footer is written
+		if footerErr := archiveExporter.WriteFooter(); err == nil {
+			err = footerErr
+		}
+	}()
+
+	var result bson.D
+	for cursor.Next(&result) {
+		if exp.transformer != nil {
+			if result, err = exp.transformer.Apply(result); err != nil {
+				return archiveExporter.NumExported, fmt.Errorf("error transforming document: %v", err)
+			}
+		}
+		if err = archiveExporter.WriteDocument(result); err != nil {
+			return archiveExporter.NumExported, err
+		}
+		result = nil
+	}
+	if err = cursor.Err(); err != nil {
+		return archiveExporter.NumExported, err
+	}
+	return archiveExporter.NumExported, nil
+}
+
+// getArchiveMetadata returns the options and indexes of the collection to
+// export as JSON, in the format mongorestore expects in an archive.
+func (exp *MongoExport) getArchiveMetadata() (string, error) {
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	collection := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection)
+
+	meta := archiveMetadata{
+		// an empty slice rather than nil, so that the indexes marshal as []
+		Indexes: []interface{}{},
+	}
+
+	collectionInfo, err := db.GetCollectionOptions(collection)
+	if err != nil {
+		return "", fmt.Errorf("error getting collection options: %v", err)
+	}
+	if collectionInfo != nil {
+		options, _ := bsonutil.FindValueByKey("options", collectionInfo)
+		if options != nil {
+			if meta.Options, err = bsonutil.ConvertBSONValueToJSON(options); err != nil {
+				return "", fmt.Errorf("error converting collection options to JSON: %v", err)
+			}
+		}
+	}
+
+	indexesIter, err := db.GetIndexes(collection)
+	if err != nil {
+		return "", fmt.Errorf("error getting indexes: %v", err)
+	}
+	index := bson.D{}
+	for indexesIter.Next(&index) {
+		convertedIndex, err := bsonutil.ConvertBSONValueToJSON(index)
+		if err != nil {
+			return "", fmt.Errorf("error converting index (%#v): %v", index, err)
+		}
+		meta.Indexes = append(meta.Indexes, convertedIndex)
+		index = bson.D{}
+	}
+	if err = indexesIter.Err(); err != nil {
+		return "", fmt.Errorf("error getting indexes: %v", err)
+	}
+	log.Logf(log.DebugLow, "archiving %v index(es) for %v.%v", len(meta.Indexes),
+		exp.ToolOptions.Namespace.DB, exp.ToolOptions.Namespace.Collection)
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return "", fmt.Errorf("error converting metadata to JSON: %v", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,97 @@
+package mongoexport
+
+import (
+	"bytes"
+	"github.com/dezmodue/mongo-tools/common/archive"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/intents"
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"testing"
+)
+
+func TestArchiveExporter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an archive exporter", t, func() {
+		out := &bytes.Buffer{}
+		metadata := `{"options":{"capped":true,"size":4096},"indexes":[{"v":1,"key":{"_id":1},"name":"_id_","ns":"db.c"}]}`
+		archiveExporter := NewArchiveExporter("db", "c", metadata, out)
+		So(archiveExporter.WriteHeader(), ShouldBeNil)
+		So(archiveExporter.WriteDocument(bson.D{{"_id", 1}, {"b", "x"}, {"a", 2.5}}), ShouldBeNil)
+		So(archiveExporter.WriteDocument(bson.D{{"_id", 2}}), ShouldBeNil)
+		So(archiveExporter.WriteFooter(), ShouldBeNil)
+		So(archiveExporter.NumExported, ShouldEqual, 2)
+
+		Convey("the prelude should describe the namespace and its metadata", func() {
+			prelude := &archive.Prelude{}
+			So(prelude.Read(out), ShouldBeNil)
+			So(len(prelude.NamespaceMetadatas), ShouldEqual, 1)
+			So(prelude.NamespaceMetadatas[0].Database, ShouldEqual, "db")
+			So(prelude.NamespaceMetadatas[0].Collection, ShouldEqual, "c")
+			So(prelude.NamespaceMetadatas[0].Metadata, ShouldEqual, metadata)
+
+			Convey("and the documents should follow, in field order", func() {
+				demux := &archive.Demultiplexer{In: out}
+				receiver := &archive.RegularCollectionReceiver{
+					Intent: &intents.Intent{DB: "db", C: "c"},
+					Demux:  demux,
+				}
+				So(receiver.Open(), ShouldBeNil)
+				docs := make(chan []bson.D)
+				go func() {
+					var read []bson.D
+					buf := make([]byte, db.MaxBSONSize)
+					for {
+						n, err := receiver.Read(buf)
+						if err == io.EOF {
+							break
+						}
+						doc := bson.D{}
+						bson.Unmarshal(buf[:n], &doc)
+						read = append(read, doc)
+					}
+					docs <- read
+				}()
+				So(demux.Run(), ShouldBeNil)
+				So(<-docs, ShouldResemble, []bson.D{
+					{{"_id", 1}, {"b", "x"}, {"a", 2.5}},
+					{{"_id", 2}},
+				})
+			})
+		})
+	})
+}
+
+func TestArchiveExportSettings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating an archive export", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: "ARCHIVE"},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("the archive type should be accepted", func() {
+			So(export.ValidateSettings(), ShouldBeNil)
+			So(export.OutputOpts.Type, ShouldEqual, Archive)
+		})
+
+		Convey("--outDir should not be used with it", func() {
+			export.OutputOpts.OutDir = "out"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--pretty should not be used with it", func() {
+			export.OutputOpts.Pretty = true
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
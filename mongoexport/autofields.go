@@ -0,0 +1,165 @@
+package mongoexport
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+)
+
+// fieldDiscoverer builds the list of CSV fields needed to hold every value
+// seen in a sample of documents, for use with --autoFields.
+type fieldDiscoverer struct {
+	// arrayWidth is the number of elements of each array that are given
+	// their own fields; 0 leaves arrays whole
+	arrayWidth int
+
+	// jsonCells, if set, makes values that can't be fully flattened - like
+	// arrays longer than arrayWidth - be exported whole as JSON in one field
+	jsonCells bool
+
+	root fieldNode
+}
+
+// fieldNode records what kinds of values were found at a single path.
+type fieldNode struct {
+	name string
+
+	// children are the subfields and array indexes seen under the path, in
+	// the order in which they were first seen
+	children []*fieldNode
+	byName   map[string]*fieldNode
+
+	// the kinds of values seen at the path
+	scalar, document, array bool
+
+	// maxLength is the length of the longest array seen at the path
+	maxLength int
+}
+
+func newFieldDiscoverer(arrayWidth int, jsonCells bool) *fieldDiscoverer {
+	return &fieldDiscoverer{arrayWidth: arrayWidth, jsonCells: jsonCells}
+}
+
+// AddDocument records the fields of a sampled document.
+func (fd *fieldDiscoverer) AddDocument(document bson.D) {
+	fd.addDocument(&fd.root, document)
+}
+
+func (fd *fieldDiscoverer) addDocument(node *fieldNode, document bson.D) {
+	node.document = true
+	for _, elem := range document {
+		fd.addValue(node.child(elem.Name), elem.Value)
+	}
+}
+
+func (fd *fieldDiscoverer) addValue(node *fieldNode, value interface{}) {
+	switch v := value.(type) {
+	case bson.D:
+		fd.addDocument(node, v)
+	case bson.M:
+		fd.addDocument(node, mapToD(v))
+	case []interface{}:
+		node.array = true
+		if len(v) > node.maxLength {
+			node.maxLength = len(v)
+		}
+		for i, elem := range v {
+			if i >= fd.arrayWidth {
+				break
+			}
+			fd.addValue(node.child(strconv.Itoa(i)), elem)
+		}
+	default:
+		node.scalar = true
+	}
+}
+
+func (node *fieldNode) child(name string) *fieldNode {
+	if child, ok := node.byName[name]; ok {
+		return child
+	}
+	if node.byName == nil {
+		node.byName = map[string]*fieldNode{}
+	}
+	child := &fieldNode{name: name}
+	node.byName[name] = child
+	node.children = append(node.children, child)
+	return child
+}
+
+// Fields returns the dotted paths of the discovered fields. Subdocuments and
+// arrays are expanded into their subfields, so the order of the fields
+// follows the order of the sampled documents.
+func (fd *fieldDiscoverer) Fields() []string {
+	return fd.appendFields(nil, "", &fd.root)
+}
+
+func (fd *fieldDiscoverer) appendFields(fields []string, prefix string, node *fieldNode) []string {
+	for _, child := range node.children {
+		path := prefix + child.name
+		if len(child.children) == 0 {
+			// scalars, along with empty documents and arrays
+			fields = append(fields, path)
+			continue
+		}
+
+		mixed := child.scalar || (child.document && child.array)
+		truncated := child.array && child.maxLength > fd.arrayWidth
+		if fd.jsonCells && (mixed || truncated) {
+			fields = append(fields, path)
+			continue
+		}
+		if truncated {
+			log.Logf(log.Info, "field '%v' holds arrays of up to %v elements, "+
+				"only the first %v of which will be exported", path, child.maxLength, fd.arrayWidth)
+		}
+		if mixed {
+			// keep the values that aren't subdocuments or arrays
+			fields = append(fields, path)
+		}
+		fields = fd.appendFields(fields, path+".", child)
+	}
+	return fields
+}
+
+// discoverFields samples the documents to export and returns the fields
+// needed to hold their values in a CSV export.
+func (exp *MongoExport) discoverFields() ([]string, error) {
+	discoverer := newFieldDiscoverer(exp.OutputOpts.ArrayWidth, exp.OutputOpts.JSONCells)
+	sampleSize := 0
+	if exp.InputOpts != nil {
+		sampleSize = exp.InputOpts.SampleSize
+	}
+
+	cursor, session, err := exp.getCursor()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	defer cursor.Close()
+
+	for numSampled := 0; sampleSize == 0 || numSampled < sampleSize; numSampled++ {
+		document := bson.D{}
+		if !cursor.Next(&document) {
+			break
+		}
+		// the fields have to match the documents as they are exported
+		if exp.transformer != nil {
+			if document, err = exp.transformer.Apply(document); err != nil {
+				return nil, fmt.Errorf("error transforming document: %v", err)
+			}
+		}
+		discoverer.AddDocument(document)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	fields := discoverer.Fields()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields found to export with --autoFields")
+	}
+	log.Logf(log.DebugLow, "discovered fields: %v", fields)
+	return fields, nil
+}
@@ -0,0 +1,97 @@
+package mongoexport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestFieldDiscovery(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	documents := []bson.D{
+		{
+			{"_id", 1},
+			{"name", bson.D{{"first", "Ada"}, {"last", "Lovelace"}}},
+			{"tags", []interface{}{"a", "b", "c", "d"}},
+			{"points", []interface{}{bson.D{{"x", 1}, {"y", 2}}}},
+		},
+		{
+			{"_id", 2},
+			{"name", "Alan"},
+			{"points", []interface{}{bson.D{{"x", 3}}, bson.D{{"y", 4}, {"z", 5}}}},
+			{"empty", bson.D{}},
+		},
+	}
+
+	Convey("With documents sampled for field discovery", t, func() {
+
+		Convey("subdocuments and arrays should be expanded up to the array width", func() {
+			discoverer := newFieldDiscoverer(2, false)
+			for _, document := range documents {
+				discoverer.AddDocument(document)
+			}
+			So(discoverer.Fields(), ShouldResemble, []string{
+				"_id", "name", "name.first", "name.last", "tags.0", "tags.1",
+				"points.0.x", "points.0.y", "points.1.y", "points.1.z", "empty",
+			})
+		})
+
+		Convey("an array width of 0 should leave arrays whole", func() {
+			discoverer := newFieldDiscoverer(0, false)
+			for _, document := range documents {
+				discoverer.AddDocument(document)
+			}
+			So(discoverer.Fields(), ShouldResemble, []string{
+				"_id", "name", "name.first", "name.last", "tags", "points", "empty",
+			})
+		})
+
+		Convey("values that can't be flattened should be kept whole with jsonCells", func() {
+			discoverer := newFieldDiscoverer(2, true)
+			for _, document := range documents {
+				discoverer.AddDocument(document)
+			}
+			So(discoverer.Fields(), ShouldResemble, []string{
+				"_id", "name", "tags", "points.0.x", "points.0.y",
+				"points.1.y", "points.1.z", "empty",
+			})
+		})
+	})
+}
+
+func TestAutoFieldsSettings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating --autoFields", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: CSV, AutoFields: true, ArrayWidth: 3},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("it should be accepted for CSV exports", func() {
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+
+		Convey("it should be rejected for JSON exports", func() {
+			export.OutputOpts.Type = JSON
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("it should be rejected along with a field list", func() {
+			export.OutputOpts.Fields = "a,b"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("a negative array width should be rejected", func() {
+			export.OutputOpts.ArrayWidth = -1
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
@@ -1,9 +1,9 @@
 package mongoexport
 
 import (
-	"encoding/csv"
 	"fmt"
 	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/csv"
 	"github.com/dezmodue/mongo-tools/common/json"
 	"gopkg.in/mgo.v2/bson"
 	"io"
@@ -22,6 +22,9 @@ type CSVExportOutput struct {
 	// NumExported maintains a running total of the number of documents written.
 	NumExported int64
 
+	// NullValue is written for null values.
+	NullValue string
+
 	csvWriter *csv.Writer
 }
 
@@ -29,9 +32,8 @@ type CSVExportOutput struct {
 // given io.Writer, extracting the specified fields only.
 func NewCSVExportOutput(fields []string, out io.Writer) *CSVExportOutput {
 	return &CSVExportOutput{
-		fields,
-		0,
-		csv.NewWriter(out),
+		Fields:    fields,
+		csvWriter: csv.NewWriter(out),
 	}
 }
 
@@ -67,7 +69,7 @@ func (csvExporter *CSVExportOutput) ExportDocument(document bson.M) error {
 			return nil
 		}
 		if fieldVal == nil {
-			rowOut = append(rowOut, "")
+			rowOut = append(rowOut, csvExporter.NullValue)
 		} else if reflect.TypeOf(fieldVal) == reflect.TypeOf(bson.M{}) || reflect.TypeOf(fieldVal) == reflect.TypeOf([]interface{}{}) {
 			buf, err := json.Marshal(fieldVal)
 			if err != nil {
@@ -2,6 +2,7 @@ package mongoexport
 
 import (
 	"bytes"
+	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -44,3 +45,61 @@ func TestWriteCSV(t *testing.T) {
 
 	})
 }
+
+func TestWriteCSVDialects(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a CSV export output for the output options", t, func() {
+		out := &bytes.Buffer{}
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: CSV},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("the dialect and null value should be used", func() {
+			export.OutputOpts.Delimiter = ";"
+			export.OutputOpts.Quote = "'"
+			export.OutputOpts.Escape = `\`
+			export.OutputOpts.NullValue = "NULL"
+			So(export.ValidateSettings(), ShouldBeNil)
+			csvExporter := export.newCSVExportOutput([]string{"a", "b", "c"}, out)
+			So(csvExporter.ExportDocument(bson.M{"a": "it's", "b": nil, "c": `a\b;c`}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, `'it\'s';NULL;'a\\b;c'`+"\n")
+		})
+
+		Convey("the output should be written in the encoding", func() {
+			export.OutputOpts.Encoding = "utf-16"
+			So(export.ValidateSettings(), ShouldBeNil)
+			csvExporter := export.newCSVExportOutput([]string{"a"}, out)
+			So(csvExporter.ExportDocument(bson.M{"a": "é"}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.Bytes(), ShouldResemble, []byte{0xFF, 0xFE, 0xE9, 0, '\n', 0})
+		})
+
+		Convey("a UTF-8 byte order mark should be written with --bom", func() {
+			export.OutputOpts.BOM = true
+			So(export.ValidateSettings(), ShouldBeNil)
+			csvExporter := export.newCSVExportOutput([]string{"a"}, out)
+			So(csvExporter.ExportDocument(bson.M{"a": 1}), ShouldBeNil)
+			So(csvExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, "\xEF\xBB\xBF1\n")
+		})
+
+		Convey("CSV options should not be used with JSON output", func() {
+			export.OutputOpts.Type = JSON
+			export.OutputOpts.Delimiter = "tab"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--bom should not be used with latin1", func() {
+			export.OutputOpts.Encoding = "latin1"
+			export.OutputOpts.BOM = true
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
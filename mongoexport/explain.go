@@ -0,0 +1,63 @@
+package mongoexport
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"io"
+)
+
+// Explain writes a report of the plan the server chooses for the query or
+// pipeline the export runs - its winning plan, the indexes it uses and the
+// number of documents it is estimated to examine - to out, without
+// exporting any documents.
+func (exp *MongoExport) Explain(out io.Writer) error {
+	plan, err := exp.explainQuery()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, plan)
+	return err
+}
+
+// checkQueryPlan returns an error if --maxCollScanDocs is set, --allowCollScan
+// isn't, and the export would scan a collection of more documents than it.
+func (exp *MongoExport) checkQueryPlan() error {
+	if exp.InputOpts == nil || exp.InputOpts.MaxCollScanDocs == 0 || exp.InputOpts.AllowCollScan {
+		return nil
+	}
+	plan, err := exp.explainQuery()
+	if err != nil {
+		return err
+	}
+	log.Logf(log.Info, "query plan of %v", plan)
+	return plan.CheckCollScan(exp.InputOpts.MaxCollScanDocs)
+}
+
+// explainQuery returns the plan the server chooses for the cursor returned
+// by getCursor.
+func (exp *MongoExport) explainQuery() (*db.QueryPlan, error) {
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	if exp.InputOpts.SlaveOk {
+		session.SetMode(mgo.Monotonic, true)
+	}
+	collection := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection)
+
+	if exp.InputOpts.Pipeline != "" {
+		pipeline, err := getPipelineFromArg(exp.InputOpts.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		return db.ExplainPipeline(collection, pipeline)
+	}
+	find, err := exp.getFindQuery(nil)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExplainFind(collection, find)
+}
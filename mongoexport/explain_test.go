@@ -0,0 +1,47 @@
+package mongoexport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestExplainSettings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating query plan options", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: JSON},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("--explain should be accepted with a query", func() {
+			export.InputOpts.Explain = true
+			export.InputOpts.Query = "{a: 1}"
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+
+		Convey("--explain should not be used with --follow", func() {
+			export.InputOpts.Explain = true
+			export.InputOpts.Follow = true
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--maxCollScanDocs should not be negative", func() {
+			export.InputOpts.MaxCollScanDocs = -1
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--allowCollScan should require --maxCollScanDocs", func() {
+			export.InputOpts.AllowCollScan = true
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.InputOpts.MaxCollScanDocs = 1000
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+	})
+}
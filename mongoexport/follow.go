@@ -0,0 +1,170 @@
+package mongoexport
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+)
+
+const (
+	oplogDB         = "local"
+	oplogCollection = "oplog.rs"
+)
+
+// oplogEventTypes maps the oplog operations written as events to the
+// operation type of the events.
+var oplogEventTypes = map[string]string{
+	"i": "insert",
+	"u": "update",
+	"d": "delete",
+}
+
+// exportAndFollow exports the collection, then writes an event for each
+// insert, update and delete of it in the oplog, until an error occurs. If
+// the --stateFile or --resumeAfter give a timestamp, the export is skipped,
+// and the events after that timestamp are written instead.
+func (exp *MongoExport) exportAndFollow(out io.Writer) (int64, error) {
+	after, resuming, err := exp.getResumeTimestamp()
+	if err != nil {
+		return 0, err
+	}
+
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+	oplog := session.DB(oplogDB).C(oplogCollection)
+
+	var count int64
+	if resuming {
+		if err = db.CheckOplogGap(oplog, after); err != nil {
+			return 0, gapHint(err)
+		}
+		log.Logf(log.Always, "resuming after oplog timestamp %v", db.FormatTimestamp(after))
+	} else {
+		// events are written from the start of the export on, so that the
+		// changes made while exporting aren't missed
+		if after, err = db.GetLatestOplogTimestamp(oplog); err != nil {
+			return 0, err
+		}
+		if count, err = exp.exportInternal(out); err != nil {
+			return count, err
+		}
+		log.Logf(log.Always, "exported %v record(s), following changes after oplog timestamp %v",
+			count, db.FormatTimestamp(after))
+		if err = exp.saveResumeTimestamp(after); err != nil {
+			return count, err
+		}
+	}
+
+	numEvents, err := exp.follow(oplog, out, after)
+	return count + numEvents, err
+}
+
+// follow writes an event for each insert, update and delete of the
+// collection in the oplog after the given timestamp, recording the
+// timestamp of each one in the --stateFile. It waits for new entries until
+// an error occurs, querying the oplog again if the cursor is lost or fails,
+// e.g. because of a failover.
+func (exp *MongoExport) follow(oplog *mgo.Collection, out io.Writer, after bson.MongoTimestamp) (int64, error) {
+	output := exp.newJSONExportOutput(out)
+	query := bson.M{
+		"ns": exp.ToolOptions.Namespace.DB + "." + exp.ToolOptions.Namespace.Collection,
+		"op": bson.M{"$in": []string{"i", "u", "d"}},
+	}
+
+	var numEvents int64
+	tailer := &db.OplogTailer{Oplog: oplog, Query: query}
+	tail := tailer.Tail(after)
+	for {
+		entry := db.Oplog{}
+		for tail.Next(&entry) {
+			if err := output.ExportDocument(oplogEvent(entry)); err != nil {
+				tail.Close()
+				return numEvents, err
+			}
+			numEvents++
+			after = entry.Timestamp
+			if err := exp.saveResumeTimestamp(after); err != nil {
+				tail.Close()
+				return numEvents, err
+			}
+		}
+		if tail.Err() == nil && tail.Timeout() {
+			// no new entries yet, wait again
+			continue
+		}
+		var err error
+		if tail, err = tailer.Retail(tail, after); err != nil {
+			return numEvents, gapHint(err)
+		}
+	}
+}
+
+// gapHint adds what to do to an error reporting that the oplog no longer
+// holds the entries to follow.
+func gapHint(err error) error {
+	if db.IsOplogGap(err) {
+		return fmt.Errorf("%v, export the collection again to resume following it", err)
+	}
+	return err
+}
+
+// oplogEvent returns the event written for an oplog entry. It holds the
+// timestamp of the entry, the operation type and namespace, the key of the
+// document, and the inserted document or the update applied to it.
+func oplogEvent(entry db.Oplog) bson.M {
+	event := bson.M{
+		"ts":            entry.Timestamp,
+		"operationType": oplogEventTypes[entry.Operation],
+		"ns":            entry.Namespace,
+	}
+	switch entry.Operation {
+	case "i":
+		event["documentKey"] = bson.M{"_id": entry.Object["_id"]}
+		event["fullDocument"] = entry.Object
+	case "u":
+		event["documentKey"] = entry.Query
+		event["update"] = entry.Object
+	case "d":
+		event["documentKey"] = entry.Object
+	}
+	return event
+}
+
+// getResumeTimestamp returns the timestamp to resume following after, from
+// the --stateFile if it exists or else from --resumeAfter, and false if
+// neither gives one.
+func (exp *MongoExport) getResumeTimestamp() (bson.MongoTimestamp, bool, error) {
+	if exp.InputOpts.StateFile != "" {
+		ts, ok, err := db.ReadTimestampFile(exp.InputOpts.StateFile)
+		if err != nil {
+			return 0, false, fmt.Errorf("error reading state file: %v", err)
+		}
+		if ok {
+			return ts, true, nil
+		}
+	}
+	if exp.InputOpts.ResumeAfter != "" {
+		ts, err := db.ParseTimestamp(exp.InputOpts.ResumeAfter)
+		return ts, true, err
+	}
+	return 0, false, nil
+}
+
+// saveResumeTimestamp records the timestamp of the last event written in
+// the --stateFile, if any.
+func (exp *MongoExport) saveResumeTimestamp(ts bson.MongoTimestamp) error {
+	if exp.InputOpts.StateFile == "" {
+		return nil
+	}
+	if err := db.WriteTimestampFile(exp.InputOpts.StateFile, ts); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	return nil
+}
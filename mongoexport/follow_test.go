@@ -0,0 +1,118 @@
+package mongoexport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOplogEvent(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When converting oplog entries to events", t, func() {
+		ts := bson.MongoTimestamp(int64(1450000000)<<32 | 3)
+
+		Convey("inserts should hold the inserted document", func() {
+			event := oplogEvent(db.Oplog{
+				Timestamp: ts,
+				Operation: "i",
+				Namespace: "db.c",
+				Object:    bson.M{"_id": 1, "a": "x"},
+			})
+			So(event, ShouldResemble, bson.M{
+				"ts":            ts,
+				"operationType": "insert",
+				"ns":            "db.c",
+				"documentKey":   bson.M{"_id": 1},
+				"fullDocument":  bson.M{"_id": 1, "a": "x"},
+			})
+		})
+
+		Convey("updates should hold the update and the key of the document", func() {
+			event := oplogEvent(db.Oplog{
+				Timestamp: ts,
+				Operation: "u",
+				Namespace: "db.c",
+				Object:    bson.M{"$set": bson.M{"a": "y"}},
+				Query:     bson.M{"_id": 1},
+			})
+			So(event["operationType"], ShouldEqual, "update")
+			So(event["documentKey"], ShouldResemble, bson.M{"_id": 1})
+			So(event["update"], ShouldResemble, bson.M{"$set": bson.M{"a": "y"}})
+		})
+
+		Convey("deletes should hold the key of the document", func() {
+			event := oplogEvent(db.Oplog{Timestamp: ts, Operation: "d", Namespace: "db.c", Object: bson.M{"_id": 1}})
+			So(event["operationType"], ShouldEqual, "delete")
+			So(event["documentKey"], ShouldResemble, bson.M{"_id": 1})
+		})
+	})
+}
+
+func TestFollowState(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --follow export", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_follow")
+		So(err, ShouldBeNil)
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: JSON},
+			InputOpts:  &InputOptions{Follow: true, StateFile: filepath.Join(dir, "state")},
+		}
+
+		Convey("nothing should be resumed before the state file is written", func() {
+			_, resuming, err := export.getResumeTimestamp()
+			So(err, ShouldBeNil)
+			So(resuming, ShouldBeFalse)
+		})
+
+		Convey("the saved timestamp should be resumed after", func() {
+			export.InputOpts.ResumeAfter = "100:1"
+			ts := bson.MongoTimestamp(int64(1450000000)<<32 | 3)
+			So(export.saveResumeTimestamp(ts), ShouldBeNil)
+			resumeTS, resuming, err := export.getResumeTimestamp()
+			So(err, ShouldBeNil)
+			So(resuming, ShouldBeTrue)
+			So(resumeTS, ShouldEqual, ts)
+		})
+
+		Convey("--resumeAfter should be used without a state file", func() {
+			export.InputOpts.ResumeAfter = "100:1"
+			resumeTS, resuming, err := export.getResumeTimestamp()
+			So(err, ShouldBeNil)
+			So(resuming, ShouldBeTrue)
+			So(resumeTS, ShouldEqual, bson.MongoTimestamp(int64(100)<<32|1))
+		})
+
+		Convey("settings that don't make a continuous JSON feed should be rejected", func() {
+			So(export.ValidateSettings(), ShouldBeNil)
+			export.OutputOpts.JSONArray = true
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.OutputOpts.JSONArray = false
+			export.InputOpts.Query = "{a: 1}"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.InputOpts.Query = ""
+			export.InputOpts.ResumeAfter = "cats"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--stateFile should require --follow", func() {
+			export.InputOpts.Follow = false
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
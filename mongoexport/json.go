@@ -20,6 +20,8 @@ type JSONExportOutput struct {
 	Encoder      *json.Encoder
 	Out          io.Writer
 	NumExported  int64
+	// JSONFormat is the Extended JSON format to write, json.LegacyFormat if empty.
+	JSONFormat string
 }
 
 // NewJSONExportOutput creates a new JSONExportOutput in array mode if specified,
@@ -31,6 +33,7 @@ func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, out io.Writer) *JS
 		json.NewEncoder(out),
 		out,
 		0,
+		json.LegacyFormat,
 	}
 }
 
@@ -80,7 +83,7 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.M) error {
 				jsonExporter.Out.Write([]byte("\n"))
 			}
 		}
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+		extendedDoc, err := bsonutil.ConvertBSONValueToExtJSON(document, jsonExporter.JSONFormat)
 		if err != nil {
 			return err
 		}
@@ -95,7 +98,7 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.M) error {
 		}
 		jsonExporter.Out.Write(jsonOut)
 	} else {
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+		extendedDoc, err := bsonutil.ConvertBSONValueToExtJSON(document, jsonExporter.JSONFormat)
 		if err != nil {
 			return err
 		}
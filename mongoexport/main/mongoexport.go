@@ -70,15 +70,53 @@ func main() {
 		os.Exit(util.ExitBadOptions)
 	}
 
+	if inputOpts.Explain {
+		if err = exporter.Explain(os.Stdout); err != nil {
+			log.Logf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
+	if outputOpts.OutDir != "" {
+		numDocs, err := exporter.ExportParts()
+		if err != nil {
+			log.Logf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		log.Logf(log.Always, "exported %v record(s) to %v", numDocs, outputOpts.OutDir)
+		return
+	}
+
 	writer, err := exporter.GetOutputWriter()
 	if err != nil {
 		log.Logf(log.Always, "error opening output stream: %v", err)
 		os.Exit(util.ExitError)
 	}
+	// closeWriter closes the output, which finishes writing compressed
+	// output, so it must succeed for the export to be complete
+	closeWriter := func() {
+		if writer == os.Stdout {
+			return
+		}
+		if err := writer.Close(); err != nil {
+			log.Logf(log.Always, "Failed: error closing output stream: %v", err)
+			os.Exit(util.ExitError)
+		}
+	}
 	if writer == nil {
 		writer = os.Stdout
-	} else {
-		defer writer.Close()
+	}
+
+	if outputOpts.Profile {
+		numDocs, err := exporter.Profile(writer)
+		if err != nil {
+			log.Logf(log.Always, "Failed: %v", err)
+			os.Exit(util.ExitError)
+		}
+		closeWriter()
+		log.Logf(log.Always, "profiled %v document(s)", numDocs)
+		return
 	}
 
 	numDocs, err := exporter.Export(writer)
@@ -86,6 +124,7 @@ func main() {
 		log.Logf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitError)
 	}
+	closeWriter()
 
 	if numDocs == 1 {
 		log.Logf(log.Always, "exported %v record", numDocs)
@@ -4,14 +4,18 @@ package mongoexport
 import (
 	"fmt"
 	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/csv"
 	"github.com/dezmodue/mongo-tools/common/db"
 	"github.com/dezmodue/mongo-tools/common/json"
 	"github.com/dezmodue/mongo-tools/common/log"
 	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/text"
+	"github.com/dezmodue/mongo-tools/common/transform"
 	"github.com/dezmodue/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,8 +23,9 @@ import (
 
 // Output types supported by mongoexport.
 const (
-	CSV  = "csv"
-	JSON = "json"
+	CSV     = "csv"
+	JSON    = "json"
+	Archive = "archive"
 )
 
 // MongoExport is a container for the user-specified options and
@@ -37,6 +42,13 @@ type MongoExport struct {
 	// for connecting to the db
 	SessionProvider *db.SessionProvider
 	ExportOutput    ExportOutput
+
+	// transformer, if set, is applied to each document before it is exported
+	transformer *transform.Transformer
+
+	// csvDialect holds the characters that delimit, quote and escape the
+	// fields of CSV output
+	csvDialect csv.Dialect
 }
 
 // ExportOutput is an interface that specifies how a document should be formatted
@@ -71,11 +83,17 @@ func (exp *MongoExport) ValidateSettings() error {
 		}
 	}
 
-	if exp.ToolOptions.Namespace.Collection == "" {
-		return fmt.Errorf("must specify a collection")
-	}
-	if err := util.ValidateCollectionName(exp.ToolOptions.Namespace.Collection); err != nil {
-		return err
+	if exp.InputOpts != nil && exp.InputOpts.BSONFile != "" {
+		if !exp.OutputOpts.Profile {
+			return fmt.Errorf("--bsonFile can only be used with --profile")
+		}
+	} else {
+		if exp.ToolOptions.Namespace.Collection == "" {
+			return fmt.Errorf("must specify a collection")
+		}
+		if err := util.ValidateCollectionName(exp.ToolOptions.Namespace.Collection); err != nil {
+			return err
+		}
 	}
 
 	exp.OutputOpts.Type = strings.ToLower(exp.OutputOpts.Type)
@@ -89,8 +107,108 @@ func (exp *MongoExport) ValidateSettings() error {
 		// special error for an empty type value
 		return fmt.Errorf("--type cannot be empty")
 	}
-	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON {
-		return fmt.Errorf("invalid output type '%v', choose 'json' or 'csv'", exp.OutputOpts.Type)
+	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != Archive {
+		return fmt.Errorf("invalid output type '%v', choose 'json', 'csv' or 'archive'", exp.OutputOpts.Type)
+	}
+	exp.OutputOpts.Compressor = strings.ToLower(exp.OutputOpts.Compressor)
+	if exp.OutputOpts.Compressor == "" {
+		exp.OutputOpts.Compressor = util.NoCompressor
+	}
+	if err := util.ValidateCompressor(exp.OutputOpts.Compressor); err != nil {
+		return err
+	}
+	if exp.OutputOpts.Gzip {
+		if exp.OutputOpts.Compressor != util.NoCompressor && exp.OutputOpts.Compressor != util.GzipCompressor {
+			return fmt.Errorf("--gzip cannot be used with --compressor=%v", exp.OutputOpts.Compressor)
+		}
+		exp.OutputOpts.Compressor = util.GzipCompressor
+	}
+
+	if exp.OutputOpts.Type == Archive {
+		if exp.OutputOpts.OutDir != "" {
+			return fmt.Errorf("--outDir cannot be used with --type=archive")
+		}
+		if exp.OutputOpts.JSONArray || exp.OutputOpts.Pretty {
+			return fmt.Errorf("--jsonArray and --pretty cannot be used with --type=archive")
+		}
+	}
+
+	csvDialect, err := csv.ParseDialect(exp.OutputOpts.Delimiter, exp.OutputOpts.Quote, exp.OutputOpts.Escape)
+	if err != nil {
+		return err
+	}
+	if exp.OutputOpts.Encoding == "" {
+		exp.OutputOpts.Encoding = text.UTF8
+	}
+	if exp.OutputOpts.Encoding, err = text.ParseEncoding(exp.OutputOpts.Encoding); err != nil {
+		return err
+	}
+	if exp.OutputOpts.Type != CSV && (csvDialect != csv.DefaultDialect || exp.OutputOpts.Encoding != text.UTF8 ||
+		exp.OutputOpts.BOM || exp.OutputOpts.NullValue != "") {
+		return fmt.Errorf("--delimiter, --quote, --escape, --encoding, --bom and --nullValue can only be used with --type=csv")
+	}
+	if exp.OutputOpts.BOM && exp.OutputOpts.Encoding == text.Latin1 {
+		return fmt.Errorf("--bom cannot be used with --encoding=%v", text.Latin1)
+	}
+	exp.csvDialect = csvDialect
+
+	if exp.OutputOpts.AutoFields {
+		if exp.OutputOpts.Type != CSV {
+			return fmt.Errorf("--autoFields can only be used with --type=csv")
+		}
+		if exp.OutputOpts.Fields != "" || exp.OutputOpts.FieldFile != "" {
+			return fmt.Errorf("--autoFields cannot be used with --fields or --fieldFile")
+		}
+		if exp.OutputOpts.ArrayWidth < 0 {
+			return fmt.Errorf("--arrayWidth cannot be negative")
+		}
+	}
+
+	if exp.OutputOpts.OutDir != "" {
+		if exp.OutputOpts.OutputFile != "" {
+			return fmt.Errorf("--outDir cannot be used with --out")
+		}
+		if exp.OutputOpts.Profile {
+			return fmt.Errorf("--outDir cannot be used with --profile")
+		}
+	} else if exp.OutputOpts.MaxFileDocs != 0 || exp.OutputOpts.MaxFileSize != 0 ||
+		(exp.InputOpts != nil && exp.InputOpts.NumParallel > 1) {
+		return fmt.Errorf("--numParallel, --maxFileDocs and --maxFileSize require --outDir")
+	}
+	if exp.OutputOpts.MaxFileDocs < 0 || exp.OutputOpts.MaxFileSize < 0 {
+		return fmt.Errorf("--maxFileDocs and --maxFileSize cannot be negative")
+	}
+	if exp.InputOpts != nil && exp.InputOpts.NumParallel > 1 {
+		if exp.InputOpts.Pipeline != "" || exp.InputOpts.Sort != "" ||
+			exp.InputOpts.Skip != 0 || exp.InputOpts.Limit != 0 {
+			return fmt.Errorf("--numParallel cannot be used with --pipeline, --sort, --skip or --limit")
+		}
+	}
+	if exp.InputOpts != nil && exp.InputOpts.NumParallel < 0 {
+		return fmt.Errorf("--numParallel cannot be negative")
+	}
+
+	if exp.OutputOpts.Profile {
+		exp.OutputOpts.ProfileFormat = strings.ToLower(exp.OutputOpts.ProfileFormat)
+		switch exp.OutputOpts.ProfileFormat {
+		case ProfileText, ProfileJSON, ProfileFields:
+		default:
+			return fmt.Errorf("invalid profile format '%v', choose 'text', 'json' or 'fields'",
+				exp.OutputOpts.ProfileFormat)
+		}
+		if exp.InputOpts != nil && exp.InputOpts.SampleSize < 0 {
+			return fmt.Errorf("--sampleSize cannot be negative")
+		}
+	}
+
+	if exp.OutputOpts.JSONFormat != "" {
+		exp.OutputOpts.JSONFormat = strings.ToLower(exp.OutputOpts.JSONFormat)
+		if err := json.ValidateFormat(exp.OutputOpts.JSONFormat); err != nil {
+			return err
+		}
+		if exp.OutputOpts.JSONFormat != json.LegacyFormat && exp.OutputOpts.Type != JSON {
+			return fmt.Errorf("can not use --jsonFormat when output type is %v", exp.OutputOpts.Type)
+		}
 	}
 
 	if exp.InputOpts != nil && exp.InputOpts.Query != "" {
@@ -106,11 +224,78 @@ func (exp *MongoExport) ValidateSettings() error {
 			return err
 		}
 	}
+
+	if exp.InputOpts != nil && exp.InputOpts.Pipeline != "" {
+		if exp.InputOpts.Query != "" || exp.InputOpts.Sort != "" ||
+			exp.InputOpts.Skip != 0 || exp.InputOpts.Limit != 0 {
+			return fmt.Errorf("--pipeline cannot be used with --query, --sort, --skip or --limit; " +
+				"use $match, $sort, $skip and $limit stages instead")
+		}
+		if exp.InputOpts.BSONFile != "" {
+			return fmt.Errorf("--pipeline cannot be used with --bsonFile")
+		}
+		// the pipeline decides the shape of the exported documents, so
+		// fields can only pick the CSV columns
+		if exp.OutputOpts.Type != CSV && exp.OutputOpts.Fields != "" {
+			return fmt.Errorf("--fields can only be used with --pipeline for --type=csv; use a $project stage instead")
+		}
+		_, err := getPipelineFromArg(exp.InputOpts.Pipeline)
+		if err != nil {
+			return err
+		}
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.Follow {
+		if exp.OutputOpts.Type != JSON || exp.OutputOpts.JSONArray || exp.OutputOpts.OutDir != "" ||
+			exp.OutputOpts.Profile || exp.OutputOpts.Compressor != util.NoCompressor {
+			return fmt.Errorf("--follow can only be used with uncompressed JSON output, " +
+				"and not with --jsonArray, --outDir or --profile")
+		}
+		if exp.InputOpts.Query != "" || exp.InputOpts.Sort != "" || exp.InputOpts.Skip != 0 ||
+			exp.InputOpts.Limit != 0 || exp.InputOpts.Pipeline != "" || exp.OutputOpts.Transform != "" {
+			return fmt.Errorf("--follow cannot be used with --query, --sort, --skip, --limit, --pipeline or --transform")
+		}
+		if exp.InputOpts.ResumeAfter != "" {
+			if _, err := db.ParseTimestamp(exp.InputOpts.ResumeAfter); err != nil {
+				return fmt.Errorf("invalid --resumeAfter timestamp: %v", err)
+			}
+		}
+	} else if exp.InputOpts != nil && (exp.InputOpts.ResumeAfter != "" || exp.InputOpts.StateFile != "") {
+		return fmt.Errorf("--resumeAfter and --stateFile can only be used with --follow")
+	}
+
+	if exp.InputOpts != nil {
+		if exp.InputOpts.Explain && (exp.InputOpts.Follow || exp.InputOpts.BSONFile != "" || exp.OutputOpts.Profile) {
+			return fmt.Errorf("--explain cannot be used with --follow, --bsonFile or --profile")
+		}
+		if exp.InputOpts.MaxCollScanDocs < 0 {
+			return fmt.Errorf("--maxCollScanDocs cannot be negative")
+		}
+		if exp.InputOpts.AllowCollScan && exp.InputOpts.MaxCollScanDocs == 0 {
+			return fmt.Errorf("--allowCollScan can only be used with --maxCollScanDocs")
+		}
+	}
+
+	if exp.OutputOpts.Transform != "" {
+		// fields refer to the transformed document, so they can only pick
+		// the CSV columns, not project the stored documents
+		if exp.OutputOpts.Type != CSV && exp.OutputOpts.Fields != "" {
+			return fmt.Errorf("--fields can only be used with --transform for --type=csv")
+		}
+		transformer, err := transform.NewFromFile(exp.OutputOpts.Transform)
+		if err != nil {
+			return err
+		}
+		exp.transformer = transformer.Reverse()
+	}
 	return nil
 }
 
 // GetOutputWriter opens and returns an io.WriteCloser for the output
 // options or nil if none is set. The caller is responsible for closing it.
+// If a compressor is set, the returned writer compresses the output, writing
+// to stdout if no output file is set, and closing it flushes the compressed
+// data.
 func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
 	if exp.OutputOpts.OutputFile != "" {
 		// If the directory in which the output file is to be
@@ -125,12 +310,30 @@ func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
 		if err != nil {
 			return nil, err
 		}
-		return file, err
+		return exp.compressOutput(file)
+	}
+	if exp.OutputOpts.Compressor != "" && exp.OutputOpts.Compressor != util.NoCompressor {
+		return exp.compressOutput(&nopCloseWriter{os.Stdout})
 	}
 	// No writer, so caller should assume Stdout (or some other reasonable default)
 	return nil, nil
 }
 
+// compressOutput wraps out with the compressor from the output options, if
+// any. out is closed if this fails.
+func (exp *MongoExport) compressOutput(out io.WriteCloser) (io.WriteCloser, error) {
+	compressor := exp.OutputOpts.Compressor
+	if compressor == "" {
+		compressor = util.NoCompressor
+	}
+	writer, err := util.NewCompressingWriter(out, compressor)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return writer, nil
+}
+
 // Take a comma-delimited set of field names and build a selector doc for query projection.
 // For fields containing a dot '.', we project the entire top-level portion.
 // e.g. "a,b,c.d.e,f.$" -> {a:1, b:1, "c":1, "f.$": 1}.
@@ -157,17 +360,66 @@ func makeFieldSelector(fields string) bson.M {
 // to export, based on the options given to mongoexport. Also returns the
 // associated session, so that it can be closed once the cursor is used up.
 func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
+	if exp.InputOpts != nil && exp.InputOpts.Pipeline != "" {
+		return exp.getPipelineCursor()
+	}
+	return exp.getRangeCursor(nil)
+}
+
+// getRangeCursor is like getCursor, but if idRange is non-nil, only documents
+// whose _id matches it - e.g. bson.M{"$gte": 10, "$lt": 20} - are returned.
+func (exp *MongoExport) getRangeCursor(idRange bson.M) (*mgo.Iter, *mgo.Session, error) {
+	find, err := exp.getFindQuery(idRange)
+	if err != nil {
+		return nil, nil, err
+	}
+	sortFields, err := bsonutil.MakeSortString(find.Sort)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flags := 0
+	if find.Snapshot {
+		flags = flags | db.Snapshot
+	}
 
-	sortFields := []string{}
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	session.SetSocketTimeout(0)
+
+	if exp.InputOpts.SlaveOk {
+		session.SetMode(mgo.Monotonic, true)
+	}
+
+	// build the query
+	q := session.DB(exp.ToolOptions.Namespace.DB).
+		C(exp.ToolOptions.Namespace.Collection).Find(find.Filter).Sort(sortFields...).
+		Skip(find.Skip).Limit(find.Limit)
+
+	// fields refer to the transformed document when a transform is
+	// given, so they can't be used to project the stored documents
+	if len(exp.OutputOpts.Fields) > 0 && exp.transformer == nil {
+		q.Select(makeFieldSelector(exp.OutputOpts.Fields))
+	}
+
+	q = db.ApplyFlags(q, session, flags)
+
+	return q.Iter(), session, nil
+
+}
+
+// getFindQuery returns the filter, sort, skip, limit and snapshot mode of
+// the find run by getRangeCursor.
+func (exp *MongoExport) getFindQuery(idRange bson.M) (db.FindQuery, error) {
+	find := db.FindQuery{}
 	if exp.InputOpts != nil && exp.InputOpts.Sort != "" {
 		sortD, err := getSortFromArg(exp.InputOpts.Sort)
 		if err != nil {
-			return nil, nil, err
-		}
-		sortFields, err = bsonutil.MakeSortString(sortD)
-		if err != nil {
-			return nil, nil, err
+			return find, err
 		}
+		find.Sort = sortD
 	}
 
 	query := map[string]interface{}{}
@@ -175,14 +427,36 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		var err error
 		query, err = getObjectFromArg(exp.InputOpts.Query)
 		if err != nil {
-			return nil, nil, err
+			return find, err
+		}
+	}
+	if idRange != nil {
+		if len(query) == 0 {
+			query = bson.M{"_id": idRange}
+		} else {
+			query = bson.M{"$and": []interface{}{query, bson.M{"_id": idRange}}}
 		}
 	}
+	find.Filter = query
 
-	flags := 0
 	if len(query) == 0 && exp.InputOpts != nil &&
 		exp.InputOpts.ForceTableScan != true && exp.InputOpts.Sort == "" {
-		flags = flags | db.Snapshot
+		find.Snapshot = true
+	}
+
+	if exp.InputOpts != nil {
+		find.Skip = exp.InputOpts.Skip
+		find.Limit = exp.InputOpts.Limit
+	}
+	return find, nil
+}
+
+// getPipelineCursor returns a cursor over the results of the aggregation
+// pipeline given with --pipeline, along with its session.
+func (exp *MongoExport) getPipelineCursor() (*mgo.Iter, *mgo.Session, error) {
+	pipeline, err := getPipelineFromArg(exp.InputOpts.Pipeline)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	session, err := exp.SessionProvider.GetSession()
@@ -195,33 +469,25 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		session.SetMode(mgo.Monotonic, true)
 	}
 
-	skip := 0
-	if exp.InputOpts != nil {
-		skip = exp.InputOpts.Skip
-	}
-	limit := 0
-	if exp.InputOpts != nil {
-		limit = exp.InputOpts.Limit
-	}
-
-	// build the query
-	q := session.DB(exp.ToolOptions.Namespace.DB).
-		C(exp.ToolOptions.Namespace.Collection).Find(query).Sort(sortFields...).
-		Skip(skip).Limit(limit)
-
-	if len(exp.OutputOpts.Fields) > 0 {
-		q.Select(makeFieldSelector(exp.OutputOpts.Fields))
-	}
-
-	q = db.ApplyFlags(q, session, flags)
-
-	return q.Iter(), session, nil
+	// the pipeline decides the shape of the exported documents, so fields
+	// are only used to pick the CSV columns rather than as a projection
+	pipe := session.DB(exp.ToolOptions.Namespace.DB).
+		C(exp.ToolOptions.Namespace.Collection).Pipe(pipeline).AllowDiskUse()
 
+	return pipe.Iter(), session, nil
 }
 
 // Internal function that handles exporting to the given writer. Used primarily
 // for testing, because it bypasses writing to the file system.
 func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
+	if err := exp.checkQueryPlan(); err != nil {
+		return 0, err
+	}
+
+	if exp.OutputOpts.Type == Archive {
+		return exp.exportArchive(out)
+	}
+
 	exportOutput, err := exp.getExportOutput(out)
 	if err != nil {
 		return 0, err
@@ -255,6 +521,11 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 
 	// Write document content
 	for cursor.Next(&result) {
+		if exp.transformer != nil {
+			if result, err = exp.transformer.ApplyMap(result); err != nil {
+				return docsCount, fmt.Errorf("error transforming document: %v", err)
+			}
+		}
 		err := exportOutput.ExportDocument(result)
 		if err != nil {
 			return docsCount, err
@@ -278,6 +549,9 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 // of documents successfully exported, and a non-nil error if something went wrong
 // during the export operation.
 func (exp *MongoExport) Export(out io.Writer) (int64, error) {
+	if exp.InputOpts != nil && exp.InputOpts.Follow {
+		return exp.exportAndFollow(out)
+	}
 	count, err := exp.exportInternal(out)
 	return count, err
 }
@@ -287,32 +561,72 @@ func (exp *MongoExport) Export(out io.Writer) (int64, error) {
 // them to an output stream.
 func (exp *MongoExport) getExportOutput(out io.Writer) (ExportOutput, error) {
 	if exp.OutputOpts.Type == CSV {
-		// TODO what if user specifies *both* --fields and --fieldFile?
-		var fields []string
-		var err error
-		if len(exp.OutputOpts.Fields) > 0 {
-			fields = strings.Split(exp.OutputOpts.Fields, ",")
-		} else if exp.OutputOpts.FieldFile != "" {
-			fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, fmt.Errorf("CSV mode requires a field list")
+		fields, err := exp.getCSVFields()
+		if err != nil {
+			return nil, err
 		}
+		return exp.newCSVExportOutput(fields, out), nil
+	}
+	return exp.newJSONExportOutput(out), nil
+}
 
-		exportFields := make([]string, 0, len(fields))
-		for _, field := range fields {
-			// for '$' field projections, exclude '.$' from the field name
-			if i := strings.LastIndex(field, "."); i != -1 && field[i+1:] == "$" {
-				exportFields = append(exportFields, field[:i])
-			} else {
-				exportFields = append(exportFields, field)
-			}
+// newCSVExportOutput returns a CSVExportOutput for the output options, which
+// writes the CSV dialect and encoding they select.
+func (exp *MongoExport) newCSVExportOutput(fields []string, out io.Writer) *CSVExportOutput {
+	if exp.OutputOpts.Encoding != "" {
+		out = text.NewEncodingWriter(out, exp.OutputOpts.Encoding, exp.OutputOpts.BOM)
+	}
+	csvOutput := NewCSVExportOutput(fields, out)
+	if exp.csvDialect != (csv.Dialect{}) {
+		csvOutput.csvWriter.Comma = exp.csvDialect.Comma
+		csvOutput.csvWriter.Quote = exp.csvDialect.Quote
+		csvOutput.csvWriter.Escape = exp.csvDialect.Escape
+	}
+	csvOutput.NullValue = exp.OutputOpts.NullValue
+	return csvOutput
+}
+
+// newJSONExportOutput returns a JSONExportOutput for the output options.
+func (exp *MongoExport) newJSONExportOutput(out io.Writer) *JSONExportOutput {
+	jsonOutput := NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out)
+	if exp.OutputOpts.JSONFormat != "" {
+		jsonOutput.JSONFormat = exp.OutputOpts.JSONFormat
+	}
+	return jsonOutput
+}
+
+// getCSVFields returns the fields to export in CSV mode, from --fields,
+// --fieldFile or --autoFields.
+func (exp *MongoExport) getCSVFields() ([]string, error) {
+	// TODO what if user specifies *both* --fields and --fieldFile?
+	var fields []string
+	var err error
+	if len(exp.OutputOpts.Fields) > 0 {
+		fields = strings.Split(exp.OutputOpts.Fields, ",")
+	} else if exp.OutputOpts.FieldFile != "" {
+		fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
+		if err != nil {
+			return nil, err
+		}
+	} else if exp.OutputOpts.AutoFields {
+		fields, err = exp.discoverFields()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("CSV mode requires a field list")
+	}
+
+	exportFields := make([]string, 0, len(fields))
+	for _, field := range fields {
+		// for '$' field projections, exclude '.$' from the field name
+		if i := strings.LastIndex(field, "."); i != -1 && field[i+1:] == "$" {
+			exportFields = append(exportFields, field[:i])
+		} else {
+			exportFields = append(exportFields, field)
 		}
-		return NewCSVExportOutput(exportFields, out), nil
 	}
-	return NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out), nil
+	return exportFields, nil
 }
 
 // getObjectFromArg takes an object in extended JSON, and converts it to an object that
@@ -332,6 +646,44 @@ func getObjectFromArg(queryRaw string) (map[string]interface{}, error) {
 	return parsedJSON, nil
 }
 
+// getPipelineFromArg takes an aggregation pipeline - either as a JSON array or
+// the name of a file containing one - and returns its stages with the order
+// of their keys preserved.
+func getPipelineFromArg(pipelineRaw string) ([]bson.D, error) {
+	source := "pipeline"
+	data := []byte(pipelineRaw)
+	if !strings.HasPrefix(strings.TrimSpace(pipelineRaw), "[") {
+		var err error
+		data, err = ioutil.ReadFile(util.ToUniversalPath(pipelineRaw))
+		if err != nil {
+			return nil, fmt.Errorf("error reading pipeline file: %v", err)
+		}
+		source = fmt.Sprintf("pipeline file '%v'", pipelineRaw)
+	}
+
+	parsedJSON, err := json.UnmarshalOrdered(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v is not valid JSON: %v", source, err)
+	}
+	stages, ok := parsedJSON.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v must be an array of stages", source)
+	}
+
+	pipeline := make([]bson.D, 0, len(stages))
+	for i, stage := range stages {
+		stageDoc, ok := stage.(bson.D)
+		if !ok || len(stageDoc) != 1 {
+			return nil, fmt.Errorf("stage %v of the %v must be a document with a single field", i, source)
+		}
+		if _, err = bsonutil.ConvertJSONValueToBSON(stageDoc); err != nil {
+			return nil, fmt.Errorf("error parsing stage %v of the %v: %v", i, source, err)
+		}
+		pipeline = append(pipeline, stageDoc)
+	}
+	return pipeline, nil
+}
+
 // getSortFromArg takes a sort specification in JSON and returns it as a bson.D
 // object which preserves the ordering of the keys as they appear in the input.
 func getSortFromArg(queryRaw string) (bson.D, error) {
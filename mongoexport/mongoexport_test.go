@@ -3,6 +3,7 @@ package mongoexport
 import (
 	"encoding/json"
 	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -42,3 +43,94 @@ func TestFieldSelect(t *testing.T) {
 		So(makeFieldSelector("x,foo.baz"), ShouldResemble, bson.M{"_id": 1, "foo": 1, "x": 1})
 	})
 }
+
+func TestPipelineArg(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Using getPipelineFromArg", t, func() {
+		Convey("a JSON array should be parsed into ordered stages", func() {
+			pipeline, err := getPipelineFromArg(
+				`[{"$match": {"_id": ObjectId("5437e5e3d4e63d1ad3d2e1e4")}}, {"$sort": {"b": 1, "a": -1}}]`)
+			So(err, ShouldBeNil)
+			So(pipeline, ShouldResemble, []bson.D{
+				{{"$match", bson.D{{"_id", bson.ObjectIdHex("5437e5e3d4e63d1ad3d2e1e4")}}}},
+				{{"$sort", bson.D{{"b", int32(1)}, {"a", int32(-1)}}}},
+			})
+		})
+
+		Convey("a pipeline should be read from a file", func() {
+			pipeline, err := getPipelineFromArg("testdata/pipeline.json")
+			So(err, ShouldBeNil)
+			So(len(pipeline), ShouldEqual, 2)
+			So(pipeline[1][0].Name, ShouldEqual, "$group")
+		})
+
+		Convey("anything but an array of single field stages should be rejected", func() {
+			_, err := getPipelineFromArg(`[{"$match": {}, "$limit": 1}]`)
+			So(err, ShouldNotBeNil)
+			_, err = getPipelineFromArg(`[1]`)
+			So(err, ShouldNotBeNil)
+			_, err = getPipelineFromArg(`[{"$match": `)
+			So(err, ShouldNotBeNil)
+			_, err = getPipelineFromArg("testdata/does_not_exist.json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFieldsValidation(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating --fields with a JSON export", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: JSON, Fields: "fullName"},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("--transform should only be used with CSV output", func() {
+			export.OutputOpts.Transform = "testdata/transform.json"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.OutputOpts.Type = CSV
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+
+		Convey("--pipeline should only be used with CSV output", func() {
+			export.InputOpts.Pipeline = `[{"$match": {}}]`
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.OutputOpts.Type = CSV
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+	})
+}
+
+func TestJSONFormatValidation(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating --jsonFormat", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: JSON, JSONFormat: "Canonical"},
+			InputOpts:  &InputOptions{},
+		}
+
+		Convey("the format should be normalized for JSON output", func() {
+			So(export.ValidateSettings(), ShouldBeNil)
+			So(export.OutputOpts.JSONFormat, ShouldEqual, "canonical")
+		})
+
+		Convey("a format other than legacy should be rejected for CSV output", func() {
+			export.OutputOpts.Type = CSV
+			export.OutputOpts.Fields = "a"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+			export.OutputOpts.JSONFormat = "legacy"
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+	})
+}
@@ -11,20 +11,74 @@ type OutputFormatOptions struct {
 	// Fields is an option to directly specify comma-separated fields to export to CSV.
 	Fields string `long:"fields" short:"f" description:"comma separated list of field names (required for exporting CSV) e.g. -f \"name,age\" "`
 
+	// AutoFields derives the CSV field list from a sample of the documents to export.
+	AutoFields bool `long:"autoFields" description:"derive the CSV field list from a sample of the documents, expanding subdocuments and arrays into dotted paths"`
+
+	// ArrayWidth is the number of array elements given their own fields with --autoFields.
+	ArrayWidth int `long:"arrayWidth" default:"3" default-mask:"-" description:"number of elements of each array to export as separate fields with --autoFields, e.g. 'arr.0.x'; 0 exports arrays whole (defaults to 3)"`
+
+	// JSONCells exports values that can't be fully flattened by --autoFields as JSON in a single field.
+	JSONCells bool `long:"jsonCells" description:"with --autoFields, export arrays longer than --arrayWidth and fields of mixed types whole, as JSON in a single field"`
+
+	// Delimiter is the character that separates the fields of CSV output.
+	Delimiter string `long:"delimiter" default:"," default-mask:"-" description:"the character that separates CSV fields, e.g. ';'; a tab can be given as '\\t' or tab (defaults to ',')"`
+
+	// Quote is the character that encloses quoted fields of CSV output.
+	Quote string `long:"quote" default:"\"" default-mask:"-" description:"the character that encloses quoted CSV fields (defaults to '\"')"`
+
+	// Escape is the character written before quote and escape characters within quoted fields of CSV output.
+	Escape string `long:"escape" description:"the character to write before quote and escape characters within quoted CSV fields, e.g. '\\'; if not specified, quote characters are doubled"`
+
+	// Encoding is the character encoding of CSV output.
+	Encoding string `long:"encoding" default:"utf-8" default-mask:"-" description:"the character encoding of CSV output, either utf-8, utf-16, utf-16le, utf-16be or latin1; utf-16 is written little-endian with a byte order mark, as Excel expects (defaults to 'utf-8')"`
+
+	// BOM writes a byte order mark at the start of CSV output.
+	BOM bool `long:"bom" description:"start CSV output with a byte order mark, which Excel uses to detect utf-8"`
+
+	// NullValue is written in CSV output for null values.
+	NullValue string `long:"nullValue" description:"CSV field value to write for null values, e.g. NULL or \\N; if not specified, they are left empty"`
+
 	// FieldFile is a filename that refers to a list of fields to export, 1 per line.
 	FieldFile string `long:"fieldFile" description:"file with field names - 1 per line"`
 
-	// Type selects the type of output to export as (json or csv).
-	Type string `long:"type" default:"json" default-mask:"-" description:"the output format, either json or csv (defaults to 'json')"`
+	// Type selects the type of output to export as (json, csv or archive).
+	Type string `long:"type" default:"json" default-mask:"-" description:"the output format, either json, csv or archive; an archive holds the collection's options and indexes and can be restored with mongorestore --archive (defaults to 'json')"`
 
 	// OutputFile specifies an output file path.
 	OutputFile string `long:"out" short:"o" description:"output file; if not specified, stdout is used"`
 
+	// Gzip compresses the output with gzip; it is the same as --compressor=gzip.
+	Gzip bool `long:"gzip" description:"compress the output with gzip, same as --compressor=gzip"`
+
+	// Compressor selects the compression applied to the output.
+	Compressor string `long:"compressor" default:"none" default-mask:"-" description:"compress the output with the given compressor, either none, gzip or zstd (defaults to 'none')"`
+
+	// OutDir is a directory to export numbered files and a manifest into, instead of a single output.
+	OutDir string `long:"outDir" description:"directory to write numbered output files (part-0000.json, ...) and a manifest of their counts into"`
+
+	// MaxFileDocs is the maximum number of documents written to each file in --outDir.
+	MaxFileDocs int64 `long:"maxFileDocs" description:"with --outDir, start a new file after this many documents"`
+
+	// MaxFileSize is the approximate maximum size, in megabytes, of each file in --outDir.
+	MaxFileSize int64 `long:"maxFileSize" description:"with --outDir, start a new file once a file reaches approximately this many megabytes"`
+
 	// JSONArray if set will export the documents an array of JSON documents.
 	JSONArray bool `long:"jsonArray" description:"output to a JSON array rather than one object per line"`
 
+	// JSONFormat is the Extended JSON format of JSON output.
+	JSONFormat string `long:"jsonFormat" default:"legacy" default-mask:"-" description:"the Extended JSON format to output, either legacy, canonical or relaxed; Decimal128 values ($numberDecimal) are not supported (defaults to 'legacy')"`
+
 	// Pretty displays JSON data in a human-readable form.
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
+
+	// Transform is a mongoimport transform file whose steps are applied in reverse to each exported document.
+	Transform string `long:"transform" description:"mongoimport transform file to apply in reverse to each document, e.g. to restore renamed fields"`
+
+	// Profile reports the fields found in a sample of documents instead of exporting them.
+	Profile bool `long:"profile" description:"instead of exporting, report the fields found in a sample of documents along with their types and ranges"`
+
+	// ProfileFormat selects the format of the profile report (text, json or fields).
+	ProfileFormat string `long:"profileFormat" default:"text" default-mask:"-" description:"the profile report format, either text, json or fields - one field name per line, for use with --fieldFile (defaults to 'text')"`
 }
 
 // Name returns a human-readable group name for output format options.
@@ -34,12 +88,22 @@ func (*OutputFormatOptions) Name() string {
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	SlaveOk        bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available (default true)" default:"true" default-mask:"-"`
-	ForceTableScan bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot)"`
-	Skip           int    `long:"skip" description:"number of documents to skip"`
-	Limit          int    `long:"limit" description:"limit the number of documents to export"`
-	Sort           string `long:"sort" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+	Query           string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	SlaveOk         bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available (default true)" default:"true" default-mask:"-"`
+	ForceTableScan  bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot)"`
+	Skip            int    `long:"skip" description:"number of documents to skip"`
+	Limit           int    `long:"limit" description:"limit the number of documents to export"`
+	Sort            string `long:"sort" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+	NumParallel     int    `long:"numParallel" default:"1" default-mask:"-" description:"with --outDir, number of ranges of _id values to export concurrently, each into its own files (defaults to 1)"`
+	Pipeline        string `long:"pipeline" description:"aggregation pipeline to export the results of, as a JSON array or the name of a file containing one, e.g. '[{$match:{x:1}},{$group:{_id:\"$y\"}}]'"`
+	SampleSize      int    `long:"sampleSize" default:"1000" default-mask:"-" description:"number of documents to sample with --profile or --autoFields; 0 samples every document (defaults to 1000)"`
+	BSONFile        string `long:"bsonFile" description:"profile the documents in a .bson file, e.g. from mongodump, instead of a collection"`
+	Follow          bool   `long:"follow" description:"after exporting, tail the oplog and write each insert, update and delete of the collection as a JSON event with its oplog timestamp, until interrupted"`
+	ResumeAfter     string `long:"resumeAfter" description:"with --follow, skip the export and write the events after this oplog timestamp, in the form <seconds>[:<increment>]"`
+	StateFile       string `long:"stateFile" description:"with --follow, file to record the timestamp of the last event written in; if it exists, the export is skipped and the events after that timestamp are written"`
+	Explain         bool   `long:"explain" description:"instead of exporting, report the winning plan of the query or pipeline, the indexes it uses and the estimated number of documents it examines"`
+	MaxCollScanDocs int64  `long:"maxCollScanDocs" description:"refuse to export if the query scans the whole collection and is estimated to examine more than this many documents"`
+	AllowCollScan   bool   `long:"allowCollScan" description:"export even if the query is a collection scan over --maxCollScanDocs"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -0,0 +1,392 @@
+package mongoexport
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ManifestFile is the name of the summary written to --outDir.
+const ManifestFile = "manifest.json"
+
+// idSamplesPerRange is the number of _id values sampled for each range of
+// documents exported in parallel.
+const idSamplesPerRange = 100
+
+// exportPart describes one of the files written to --outDir.
+type exportPart struct {
+	File      string `json:"file"`
+	Partition int    `json:"partition"`
+	Documents int64  `json:"documents"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// exportManifest is the format of the manifest written to --outDir.
+type exportManifest struct {
+	Namespace string       `json:"ns"`
+	Type      string       `json:"type"`
+	Documents int64        `json:"documents"`
+	Parts     []exportPart `json:"parts"`
+}
+
+// documentSource is the part of a cursor used to read exported documents.
+type documentSource interface {
+	Next(result interface{}) bool
+	Err() error
+}
+
+// partFiles hands out the names of the files written to --outDir and keeps
+// track of the finished ones. It is shared by all partitions.
+type partFiles struct {
+	dir, extension string
+
+	// maxDocs and maxBytes, if non-zero, limit the size of each file
+	maxDocs, maxBytes int64
+
+	next  int
+	parts []exportPart
+	lock  sync.Mutex
+}
+
+func (pf *partFiles) create() (string, *os.File, error) {
+	pf.lock.Lock()
+	name := fmt.Sprintf("part-%04d%v", pf.next, pf.extension)
+	pf.next++
+	pf.lock.Unlock()
+
+	file, err := os.Create(filepath.Join(pf.dir, name))
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	return name, file, nil
+}
+
+func (pf *partFiles) record(part exportPart) {
+	pf.lock.Lock()
+	defer pf.lock.Unlock()
+	pf.parts = append(pf.parts, part)
+}
+
+// byFile sorts parts by file name.
+type byFile []exportPart
+
+func (parts byFile) Len() int           { return len(parts) }
+func (parts byFile) Swap(i, j int)      { parts[i], parts[j] = parts[j], parts[i] }
+func (parts byFile) Less(i, j int) bool { return parts[i].File < parts[j].File }
+
+// countingWriter counts the bytes written through it to a file.
+type countingWriter struct {
+	file    *os.File
+	written int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.file.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// partOutput is an ExportOutput writing to one of the files in --outDir.
+type partOutput struct {
+	ExportOutput
+	part   exportPart
+	writer *countingWriter
+
+	// compressor compresses the output before it's written to the file
+	compressor io.WriteCloser
+}
+
+// full returns true if the file has reached the size limits. Since output
+// is buffered, and compressed files are measured on their compressed size,
+// the size limit is approximate.
+func (po *partOutput) full(files *partFiles) bool {
+	return (files.maxDocs > 0 && po.part.Documents >= files.maxDocs) ||
+		(files.maxBytes > 0 && po.writer.written >= files.maxBytes)
+}
+
+// ExportParts exports the documents into numbered files in --outDir, split
+// into --numParallel ranges of _id values that are exported concurrently,
+// and writes a manifest of the files. It returns the number of documents
+// exported.
+func (exp *MongoExport) ExportParts() (int64, error) {
+	if err := exp.checkQueryPlan(); err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(exp.OutputOpts.OutDir, 0750); err != nil {
+		return 0, fmt.Errorf("error creating output directory: %v", err)
+	}
+
+	var fields []string
+	if exp.OutputOpts.Type == CSV {
+		// get the fields once, rather than once per file
+		var err error
+		if fields, err = exp.getCSVFields(); err != nil {
+			return 0, err
+		}
+	}
+
+	ranges, err := exp.getIDRanges(exp.InputOpts.NumParallel)
+	if err != nil {
+		return 0, err
+	}
+	log.Logf(log.Info, "exporting %v partition(s) to %v", len(ranges), exp.OutputOpts.OutDir)
+
+	files := &partFiles{
+		dir:       exp.OutputOpts.OutDir,
+		extension: "." + exp.OutputOpts.Type + util.CompressorExtension(exp.OutputOpts.Compressor),
+		maxDocs:   exp.OutputOpts.MaxFileDocs,
+		maxBytes:  exp.OutputOpts.MaxFileSize * 1024 * 1024,
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(ranges))
+	for i, idRange := range ranges {
+		wg.Add(1)
+		go func(partition int, idRange bson.M) {
+			defer wg.Done()
+			// a single partition covers the whole export, which may be a
+			// --pipeline rather than a find
+			var cursor *mgo.Iter
+			var session *mgo.Session
+			var err error
+			if idRange == nil {
+				cursor, session, err = exp.getCursor()
+			} else {
+				cursor, session, err = exp.getRangeCursor(idRange)
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer session.Close()
+			defer cursor.Close()
+			if err = exp.writeParts(partition, cursor, fields, files); err != nil {
+				errs <- fmt.Errorf("error exporting partition %v: %v", partition, err)
+			}
+		}(i, idRange)
+	}
+	wg.Wait()
+	close(errs)
+	if err = <-errs; err != nil {
+		return 0, err
+	}
+
+	sort.Sort(byFile(files.parts))
+	manifest := exportManifest{
+		Namespace: exp.ToolOptions.Namespace.DB + "." + exp.ToolOptions.Namespace.Collection,
+		Type:      exp.OutputOpts.Type,
+		Parts:     files.parts,
+	}
+	for _, part := range files.parts {
+		manifest.Documents += part.Documents
+	}
+	data, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return manifest.Documents, fmt.Errorf("error converting manifest to JSON: %v", err)
+	}
+	manifestPath := filepath.Join(exp.OutputOpts.OutDir, ManifestFile)
+	if err = ioutil.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return manifest.Documents, fmt.Errorf("error writing manifest: %v", err)
+	}
+	return manifest.Documents, nil
+}
+
+// writeParts exports the documents from source into as many files as the
+// size limits require.
+func (exp *MongoExport) writeParts(partition int, source documentSource, fields []string, files *partFiles) error {
+	var output *partOutput
+	var result bson.M
+	var err error
+	for source.Next(&result) {
+		if output == nil || output.full(files) {
+			if err = exp.closePart(output, files); err != nil {
+				return err
+			}
+			if output, err = exp.openPart(partition, fields, files); err != nil {
+				return err
+			}
+		}
+		if exp.transformer != nil {
+			if result, err = exp.transformer.ApplyMap(result); err != nil {
+				exp.closePart(output, files)
+				return fmt.Errorf("error transforming document: %v", err)
+			}
+		}
+		if err = output.ExportDocument(result); err != nil {
+			exp.closePart(output, files)
+			return err
+		}
+		output.part.Documents++
+		result = nil
+	}
+	if err = source.Err(); err != nil {
+		exp.closePart(output, files)
+		return err
+	}
+	return exp.closePart(output, files)
+}
+
+func (exp *MongoExport) openPart(partition int, fields []string, files *partFiles) (*partOutput, error) {
+	name, file, err := files.create()
+	if err != nil {
+		return nil, err
+	}
+	writer := &countingWriter{file: file}
+	compressor, err := exp.compressOutput(&nopCloseWriter{writer})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	output := &partOutput{
+		part:       exportPart{File: name, Partition: partition},
+		writer:     writer,
+		compressor: compressor,
+	}
+	if exp.OutputOpts.Type == CSV {
+		output.ExportOutput = exp.newCSVExportOutput(fields, compressor)
+	} else {
+		output.ExportOutput = exp.newJSONExportOutput(compressor)
+	}
+	if err = output.WriteHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return output, nil
+}
+
+// closePart finishes the file written by output, if any, and records it in
+// the manifest.
+func (exp *MongoExport) closePart(output *partOutput, files *partFiles) error {
+	if output == nil {
+		return nil
+	}
+	err := output.WriteFooter()
+	if err == nil {
+		err = output.Flush()
+	}
+	if err == nil {
+		err = output.compressor.Close()
+	}
+	if closeErr := output.writer.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %v: %v", output.part.File, err)
+	}
+	output.part.Bytes = output.writer.written
+	files.record(output.part)
+	log.Logf(log.DebugLow, "wrote %v document(s) to %v", output.part.Documents, output.part.File)
+	return nil
+}
+
+// getIDRanges splits the documents to export into at most numRanges ranges
+// of _id values holding roughly the same number of documents. A nil range
+// matches every document.
+func (exp *MongoExport) getIDRanges(numRanges int) ([]bson.M, error) {
+	if numRanges <= 1 {
+		return []bson.M{nil}, nil
+	}
+
+	query := map[string]interface{}{}
+	if exp.InputOpts.Query != "" {
+		var err error
+		if query, err = getObjectFromArg(exp.InputOpts.Query); err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+	session.SetSocketTimeout(0)
+	if exp.InputOpts.SlaveOk {
+		session.SetMode(mgo.Monotonic, true)
+	}
+	collection := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection)
+
+	count, err := collection.Find(query).Count()
+	if err != nil {
+		return nil, fmt.Errorf("error counting documents: %v", err)
+	}
+	if count < numRanges {
+		return []bson.M{nil}, nil
+	}
+
+	// ranges of _id values only match values of the same type, so
+	// collections with _ids of mixed types can't be split
+	var first, last bson.M
+	if err = collection.Find(query).Select(bson.M{"_id": 1}).Sort("_id").One(&first); err != nil {
+		return nil, fmt.Errorf("error finding the smallest _id: %v", err)
+	}
+	if err = collection.Find(query).Select(bson.M{"_id": 1}).Sort("-_id").One(&last); err != nil {
+		return nil, fmt.Errorf("error finding the largest _id: %v", err)
+	}
+	if !isOrderable(first["_id"]) || idBracket(first["_id"]) != idBracket(last["_id"]) {
+		log.Logf(log.Always, "cannot partition documents with _id values of this type or of "+
+			"different types; exporting serially")
+		return []bson.M{nil}, nil
+	}
+
+	// pick the boundaries from a sorted random sample of the _id values,
+	// rather than skipping through the _id index once per boundary
+	sampleSize := numRanges * idSamplesPerRange
+	if sampleSize > count {
+		sampleSize = count
+	}
+	var pipeline []bson.M
+	if len(query) > 0 {
+		pipeline = append(pipeline, bson.M{"$match": query})
+	}
+	pipeline = append(pipeline,
+		bson.M{"$sample": bson.M{"size": sampleSize}},
+		bson.M{"$project": bson.M{"_id": 1}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	)
+	var samples []bson.M
+	if err = collection.Pipe(pipeline).AllowDiskUse().All(&samples); err != nil {
+		log.Logf(log.Always, "cannot sample _id values to partition documents (%v); "+
+			"exporting serially", err)
+		return []bson.M{nil}, nil
+	}
+	if len(samples) < numRanges {
+		return []bson.M{nil}, nil
+	}
+
+	var bounds []interface{}
+	for i := 1; i < numRanges; i++ {
+		boundary := samples[i*len(samples)/numRanges]["_id"]
+		// skip duplicate boundaries, which would make empty ranges
+		if len(bounds) == 0 || boundary != bounds[len(bounds)-1] {
+			bounds = append(bounds, boundary)
+		}
+	}
+
+	ranges := []bson.M{{"$lt": bounds[0]}}
+	for i := 1; i < len(bounds); i++ {
+		ranges = append(ranges, bson.M{"$gte": bounds[i-1], "$lt": bounds[i]})
+	}
+	ranges = append(ranges, bson.M{"$gte": bounds[len(bounds)-1]})
+	return ranges, nil
+}
+
+// idBracket returns the name of the group of types whose values can be
+// matched by a single range query; all numeric types are compared together.
+func idBracket(id interface{}) string {
+	switch id.(type) {
+	case int, int32, int64, float64:
+		return "number"
+	}
+	return bsonTypeName(id)
+}
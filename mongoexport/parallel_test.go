@@ -0,0 +1,127 @@
+package mongoexport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	"github.com/dezmodue/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sliceSource is a documentSource reading from a slice.
+type sliceSource struct {
+	documents []bson.M
+}
+
+func (ss *sliceSource) Next(result interface{}) bool {
+	if len(ss.documents) == 0 {
+		return false
+	}
+	*result.(*bson.M) = ss.documents[0]
+	ss.documents = ss.documents[1:]
+	return true
+}
+
+func (ss *sliceSource) Err() error {
+	return nil
+}
+
+func TestWriteParts(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an export into a directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_parts")
+		So(err, ShouldBeNil)
+		export := MongoExport{OutputOpts: &OutputFormatOptions{Type: JSON}}
+		source := &sliceSource{}
+		for i := 0; i < 5; i++ {
+			source.documents = append(source.documents, bson.M{"_id": i})
+		}
+
+		Convey("files should be rolled after the maximum number of documents", func() {
+			files := &partFiles{dir: dir, extension: ".json", maxDocs: 2}
+			So(export.writeParts(3, source, nil, files), ShouldBeNil)
+			So(files.parts, ShouldResemble, []exportPart{
+				{"part-0000.json", 3, 2, 20},
+				{"part-0001.json", 3, 2, 20},
+				{"part-0002.json", 3, 1, 10},
+			})
+			contents, err := ioutil.ReadFile(filepath.Join(dir, "part-0002.json"))
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "{\"_id\":4}\n")
+		})
+
+		Convey("without limits everything should go into one file", func() {
+			files := &partFiles{dir: dir, extension: ".json"}
+			So(export.writeParts(0, source, nil, files), ShouldBeNil)
+			So(files.parts, ShouldResemble, []exportPart{{"part-0000.json", 0, 5, 50}})
+		})
+
+		Convey("compressed files should hold the compressed output", func() {
+			export.OutputOpts.Compressor = util.GzipCompressor
+			files := &partFiles{dir: dir, extension: ".json.gz"}
+			So(export.writeParts(0, source, nil, files), ShouldBeNil)
+			So(len(files.parts), ShouldEqual, 1)
+			file, err := os.Open(filepath.Join(dir, "part-0000.json.gz"))
+			So(err, ShouldBeNil)
+			reader, err := util.NewDecompressingReader(file, util.GzipCompressor)
+			So(err, ShouldBeNil)
+			contents, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(reader.Close(), ShouldBeNil)
+			So(len(contents), ShouldEqual, 50)
+			stat, err := os.Stat(filepath.Join(dir, "part-0000.json.gz"))
+			So(err, ShouldBeNil)
+			So(files.parts[0].Bytes, ShouldEqual, stat.Size())
+		})
+
+		Convey("an empty partition should not create a file", func() {
+			files := &partFiles{dir: dir, extension: ".json"}
+			So(export.writeParts(0, &sliceSource{}, nil, files), ShouldBeNil)
+			So(files.parts, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
+
+func TestPartitionedExportSettings(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating a partitioned export", t, func() {
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{
+				Namespace:     &options.Namespace{Collection: "test"},
+				HiddenOptions: &options.HiddenOptions{},
+			},
+			OutputOpts: &OutputFormatOptions{Type: JSON, OutDir: "out", MaxFileDocs: 10},
+			InputOpts:  &InputOptions{NumParallel: 4},
+		}
+
+		Convey("an output directory with limits should be accepted", func() {
+			So(export.ValidateSettings(), ShouldBeNil)
+		})
+
+		Convey("--numParallel should require --outDir", func() {
+			export.OutputOpts.OutDir = ""
+			export.OutputOpts.MaxFileDocs = 0
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--outDir should not be used with --out", func() {
+			export.OutputOpts.OutputFile = "out.json"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--numParallel should not be used with --sort", func() {
+			export.InputOpts.Sort = "{a: 1}"
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+	})
+}
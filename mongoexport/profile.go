@@ -0,0 +1,491 @@
+package mongoexport
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/text"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report formats supported by --profileFormat.
+const (
+	ProfileText   = "text"
+	ProfileJSON   = "json"
+	ProfileFields = "fields"
+)
+
+// arrayElementSuffix is appended to the path of an array field to name the
+// path of its elements, e.g. "tags[]" or "addresses[].city".
+const arrayElementSuffix = "[]"
+
+// Profiler accumulates statistics about the fields found in a stream of
+// documents, such as their types, how often they are set and their ranges.
+type Profiler struct {
+	// NumDocuments is the number of documents profiled so far
+	NumDocuments int64
+
+	fields map[string]*FieldProfile
+
+	// order keeps the paths in the order in which they were first seen
+	order []string
+}
+
+// FieldProfile summarizes the values found at a single field path.
+type FieldProfile struct {
+	// Path is the dotted path of the field
+	Path string `json:"path"`
+
+	// Count is the number of values found at the path
+	Count int64 `json:"count"`
+
+	// Types breaks the values down by BSON type, in the order the types
+	// were first seen
+	Types []*TypeProfile `json:"types"`
+
+	// Distinct estimates the number of distinct scalar values
+	Distinct uint64 `json:"distinct"`
+
+	distinct *hyperLogLog
+}
+
+// TypeProfile summarizes the values of a single BSON type found at a path.
+type TypeProfile struct {
+	// Type is the BSON type name, e.g. "string" or "objectId"
+	Type string `json:"type"`
+
+	// Count is the number of values of this type
+	Count int64 `json:"count"`
+
+	// Min and Max are the smallest and largest values of this type, for
+	// types that can be ordered
+	Min interface{} `json:"min,omitempty"`
+	Max interface{} `json:"max,omitempty"`
+}
+
+// profileReport is the format of the JSON profile report.
+type profileReport struct {
+	Documents int64           `json:"documents"`
+	Fields    []*FieldProfile `json:"fields"`
+}
+
+// NewProfiler returns an empty Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{fields: map[string]*FieldProfile{}}
+}
+
+// AddDocument records the fields of a document in the profile.
+func (p *Profiler) AddDocument(document bson.D) {
+	p.NumDocuments++
+	p.addDocument("", document)
+}
+
+func (p *Profiler) addDocument(prefix string, document bson.D) {
+	for _, elem := range document {
+		p.addValue(prefix+elem.Name, elem.Value)
+	}
+}
+
+func (p *Profiler) addValue(path string, value interface{}) {
+	field, ok := p.fields[path]
+	if !ok {
+		field = &FieldProfile{Path: path, distinct: &hyperLogLog{}}
+		p.fields[path] = field
+		p.order = append(p.order, path)
+	}
+	field.Count++
+	typeName := bsonTypeName(value)
+	typeProfile := field.typeProfile(typeName)
+	typeProfile.Count++
+
+	switch v := value.(type) {
+	case bson.D:
+		p.addDocument(path+".", v)
+		return
+	case bson.M:
+		p.addDocument(path+".", mapToD(v))
+		return
+	case []interface{}:
+		for _, elem := range v {
+			p.addValue(path+arrayElementSuffix, elem)
+		}
+		return
+	}
+	field.distinct.add(typeName + ":" + fmt.Sprintf("%v", value))
+	if !isOrderable(value) {
+		return
+	}
+	if typeProfile.Min == nil || compareValues(value, typeProfile.Min) < 0 {
+		typeProfile.Min = value
+	}
+	if typeProfile.Max == nil || compareValues(value, typeProfile.Max) > 0 {
+		typeProfile.Max = value
+	}
+}
+
+func (field *FieldProfile) typeProfile(typeName string) *TypeProfile {
+	for _, typeProfile := range field.Types {
+		if typeProfile.Type == typeName {
+			return typeProfile
+		}
+	}
+	typeProfile := &TypeProfile{Type: typeName}
+	field.Types = append(field.Types, typeProfile)
+	return typeProfile
+}
+
+// Fields returns the profile of every field path, in the order in which the
+// paths were first seen.
+func (p *Profiler) Fields() []*FieldProfile {
+	fields := make([]*FieldProfile, 0, len(p.order))
+	for _, path := range p.order {
+		field := p.fields[path]
+		field.Distinct = field.distinct.estimate()
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// FieldNames returns the paths of the fields that hold values which are not
+// subdocuments, suitable for use as a --fields list for CSV exports. Arrays
+// are listed as a whole rather than by element.
+func (p *Profiler) FieldNames() []string {
+	var names []string
+	for _, path := range p.order {
+		if strings.Contains(path, arrayElementSuffix) {
+			continue
+		}
+		field := p.fields[path]
+		if len(field.Types) == 1 && field.Types[0].Type == "object" {
+			continue
+		}
+		names = append(names, path)
+	}
+	return names
+}
+
+// WriteReport writes the profile to out in the given format.
+func (p *Profiler) WriteReport(out io.Writer, format string) error {
+	switch format {
+	case ProfileJSON:
+		return p.writeJSON(out)
+	case ProfileFields:
+		for _, name := range p.FieldNames() {
+			if _, err := fmt.Fprintln(out, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return p.writeText(out)
+}
+
+func (p *Profiler) writeText(out io.Writer) error {
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("field", "present", "types", "min", "max", "distinct")
+	grid.EndRow()
+	for _, field := range p.Fields() {
+		var types, mins, maxes []string
+		for _, typeProfile := range field.Types {
+			types = append(types, fmt.Sprintf("%v(%v)", typeProfile.Type, typeProfile.Count))
+			if typeProfile.Min != nil {
+				mins = append(mins, formatProfileValue(typeProfile.Min))
+				maxes = append(maxes, formatProfileValue(typeProfile.Max))
+			}
+		}
+		present := fmt.Sprintf("%v", field.Count)
+		if !strings.Contains(field.Path, arrayElementSuffix) && p.NumDocuments > 0 {
+			present = fmt.Sprintf("%.1f%%", 100*float64(field.Count)/float64(p.NumDocuments))
+		}
+		grid.WriteCells(field.Path, present, strings.Join(types, " "),
+			strings.Join(mins, " "), strings.Join(maxes, " "))
+		if field.Distinct > 0 {
+			grid.WriteCell(fmt.Sprintf("~%v", field.Distinct))
+		} else {
+			grid.WriteCell("")
+		}
+		grid.EndRow()
+	}
+	buf := &bytes.Buffer{}
+	grid.Flush(buf)
+	if _, err := fmt.Fprintf(out, "%v documents sampled\n", p.NumDocuments); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+func (p *Profiler) writeJSON(out io.Writer) error {
+	report := profileReport{Documents: p.NumDocuments}
+	for _, field := range p.Fields() {
+		// convert the ranges to extended JSON on a copy, so that the
+		// profile can still be added to afterwards
+		reportField := *field
+		reportField.Types = make([]*TypeProfile, 0, len(field.Types))
+		for _, typeProfile := range field.Types {
+			reportType := *typeProfile
+			var err error
+			if reportType.Min, err = bsonutil.ConvertBSONValueToJSON(typeProfile.Min); err != nil {
+				return err
+			}
+			if reportType.Max, err = bsonutil.ConvertBSONValueToJSON(typeProfile.Max); err != nil {
+				return err
+			}
+			reportField.Types = append(reportField.Types, &reportType)
+		}
+		report.Fields = append(report.Fields, &reportField)
+	}
+	data, err := json.MarshalIndent(report, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error converting profile to JSON: %v", err)
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+// Profile samples the documents that would be exported - or those in the
+// --bsonFile, if given - and writes a report of the fields found in them to
+// out. It returns the number of documents sampled.
+func (exp *MongoExport) Profile(out io.Writer) (int64, error) {
+	sampleSize := 0
+	if exp.InputOpts != nil {
+		sampleSize = exp.InputOpts.SampleSize
+	}
+	profiler := NewProfiler()
+
+	var err error
+	if exp.InputOpts != nil && exp.InputOpts.BSONFile != "" {
+		err = exp.sampleBSONFile(profiler, sampleSize)
+	} else {
+		err = exp.sampleCollection(profiler, sampleSize)
+	}
+	if err != nil {
+		return profiler.NumDocuments, err
+	}
+	return profiler.NumDocuments, profiler.WriteReport(out, exp.OutputOpts.ProfileFormat)
+}
+
+func (exp *MongoExport) sampleCollection(profiler *Profiler, sampleSize int) error {
+	cursor, session, err := exp.getCursor()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	defer cursor.Close()
+
+	for sampleSize == 0 || profiler.NumDocuments < int64(sampleSize) {
+		document := bson.D{}
+		if !cursor.Next(&document) {
+			break
+		}
+		profiler.AddDocument(document)
+	}
+	return cursor.Err()
+}
+
+func (exp *MongoExport) sampleBSONFile(profiler *Profiler, sampleSize int) error {
+	file, err := os.Open(exp.InputOpts.BSONFile)
+	if err != nil {
+		return fmt.Errorf("error opening BSON file: %v", err)
+	}
+	source := db.NewDecodedBSONSource(db.NewBSONSource(file))
+	defer source.Close()
+
+	for sampleSize == 0 || profiler.NumDocuments < int64(sampleSize) {
+		document := bson.D{}
+		if !source.Next(&document) {
+			break
+		}
+		profiler.AddDocument(document)
+	}
+	if err = source.Err(); err != nil {
+		return fmt.Errorf("error reading BSON file: %v", err)
+	}
+	return nil
+}
+
+// formatProfileValue returns a short string representation of a value for
+// the text report.
+func formatProfileValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if len(v) > 24 {
+			v = v[:21] + "..."
+		}
+		return fmt.Sprintf("%q", v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case bson.ObjectId:
+		return v.Hex()
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// bsonTypeName returns the name of the BSON type a decoded value came from.
+func bsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case bson.D, bson.M:
+		return "object"
+	case []interface{}:
+		return "array"
+	case []byte, bson.Binary:
+		return "binData"
+	case bson.ObjectId:
+		return "objectId"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case bson.RegEx:
+		return "regex"
+	case bson.DBPointer:
+		return "dbPointer"
+	case mgo.DBRef:
+		return "dbRef"
+	case bson.JavaScript:
+		if v.Scope != nil {
+			return "javascriptWithScope"
+		}
+		return "javascript"
+	case bson.Symbol:
+		return "symbol"
+	case int, int32:
+		return "int"
+	case bson.MongoTimestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	}
+	switch value {
+	case bson.Undefined:
+		return "undefined"
+	case bson.MinKey:
+		return "minKey"
+	case bson.MaxKey:
+		return "maxKey"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// isOrderable returns true for the types whose range is tracked.
+func isOrderable(value interface{}) bool {
+	switch value.(type) {
+	case int, int32, int64, float64, string, time.Time, bson.ObjectId, bson.MongoTimestamp:
+		return true
+	}
+	return false
+}
+
+// compareValues orders two values of the same orderable BSON type.
+func compareValues(a, b interface{}) int {
+	var less, greater bool
+	switch v := a.(type) {
+	case int:
+		less, greater = v < b.(int), v > b.(int)
+	case int32:
+		less, greater = v < b.(int32), v > b.(int32)
+	case int64:
+		less, greater = v < b.(int64), v > b.(int64)
+	case float64:
+		less, greater = v < b.(float64), v > b.(float64)
+	case string:
+		less, greater = v < b.(string), v > b.(string)
+	case bson.ObjectId:
+		less, greater = v < b.(bson.ObjectId), v > b.(bson.ObjectId)
+	case bson.MongoTimestamp:
+		less, greater = v < b.(bson.MongoTimestamp), v > b.(bson.MongoTimestamp)
+	case time.Time:
+		less, greater = v.Before(b.(time.Time)), v.After(b.(time.Time))
+	}
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+// mapToD converts an unordered document to a bson.D with sorted keys.
+func mapToD(document bson.M) bson.D {
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ordered := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		ordered = append(ordered, bson.DocElem{key, document[key]})
+	}
+	return ordered
+}
+
+// hyperLogLog estimates the number of distinct keys added to it using a
+// fixed amount of memory.
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+const (
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+func (h *hyperLogLog) add(key string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	// FNV's output is poorly mixed for short keys, so finish it with the
+	// MurmurHash3 finalizer
+	x := hasher.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+
+	index := x >> (64 - hllPrecision)
+	rank := uint8(1)
+	for remaining := x << hllPrecision; remaining&(1<<63) == 0 && rank <= 64-hllPrecision; remaining <<= 1 {
+		rank++
+	}
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+	if zeros == hllRegisters {
+		return 0
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// use linear counting for small cardinalities, where it is more accurate
+	if estimate <= 2.5*m && zeros != 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
@@ -0,0 +1,142 @@
+package mongoexport
+
+import (
+	"bytes"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a profiler fed a few documents", t, func() {
+		profiler := NewProfiler()
+		profiler.AddDocument(bson.D{
+			{"_id", 1},
+			{"name", bson.D{{"first", "Ada"}, {"last", "Lovelace"}}},
+			{"tags", []interface{}{"a", "b"}},
+		})
+		profiler.AddDocument(bson.D{
+			{"_id", 2},
+			{"name", bson.D{{"first", "Alan"}}},
+			{"tags", []interface{}{bson.D{{"x", 1}}}},
+			{"age", nil},
+		})
+		profiler.AddDocument(bson.D{
+			{"_id", "three"},
+			{"name", "Grace"},
+		})
+
+		Convey("every path should be profiled in the order first seen", func() {
+			var paths []string
+			for _, field := range profiler.Fields() {
+				paths = append(paths, field.Path)
+			}
+			So(paths, ShouldResemble, []string{"_id", "name", "name.first",
+				"name.last", "tags", "tags[]", "tags[].x", "age"})
+			So(profiler.NumDocuments, ShouldEqual, 3)
+		})
+
+		Convey("types, counts and ranges should be tracked per type", func() {
+			id := profiler.Fields()[0]
+			So(id.Count, ShouldEqual, 3)
+			So(len(id.Types), ShouldEqual, 2)
+			So(*id.Types[0], ShouldResemble, TypeProfile{"int", 2, 1, 2})
+			So(*id.Types[1], ShouldResemble, TypeProfile{"string", 1, "three", "three"})
+			So(id.Distinct, ShouldEqual, 3)
+
+			tagElements := profiler.Fields()[5]
+			So(tagElements.Count, ShouldEqual, 3)
+			So(tagElements.Types[0].Type, ShouldEqual, "string")
+			So(tagElements.Types[1].Type, ShouldEqual, "object")
+		})
+
+		Convey("field names should exclude subdocuments and array elements", func() {
+			So(profiler.FieldNames(), ShouldResemble, []string{"_id", "name",
+				"name.first", "name.last", "tags", "age"})
+		})
+
+		Convey("the fields report should list one field per line", func() {
+			out := &bytes.Buffer{}
+			So(profiler.WriteReport(out, ProfileFields), ShouldBeNil)
+			So(out.String(), ShouldEqual, "_id\nname\nname.first\nname.last\ntags\nage\n")
+		})
+
+		Convey("the text report should have a row per field", func() {
+			out := &bytes.Buffer{}
+			So(profiler.WriteReport(out, ProfileText), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(lines[0], ShouldEqual, "3 documents sampled")
+			So(len(lines), ShouldEqual, 10)
+			So(strings.TrimSpace(lines[2]), ShouldStartWith, "_id")
+			So(lines[2], ShouldContainSubstring, "100.0%")
+			So(lines[2], ShouldContainSubstring, "int(2) string(1)")
+		})
+
+		Convey("the JSON report should be valid JSON and leave the profile intact", func() {
+			out := &bytes.Buffer{}
+			So(profiler.WriteReport(out, ProfileJSON), ShouldBeNil)
+			report := map[string]interface{}{}
+			So(json.Unmarshal(out.Bytes(), &report), ShouldBeNil)
+			So(report["documents"], ShouldEqual, 3)
+			So(len(report["fields"].([]interface{})), ShouldEqual, 8)
+			So(profiler.Fields()[0].Types[0].Min, ShouldEqual, 1)
+		})
+	})
+
+	Convey("The distinct estimate should be close for larger cardinalities", t, func() {
+		profiler := NewProfiler()
+		for i := 0; i < 20000; i++ {
+			profiler.AddDocument(bson.D{{"n", i % 5000}})
+		}
+		distinct := float64(profiler.Fields()[0].Distinct)
+		So(distinct, ShouldBeBetween, 5000*0.9, 5000*1.1)
+	})
+}
+
+func TestProfileBSONFile(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a BSON file of documents", t, func() {
+		file, err := ioutil.TempFile("", "mongoexport_profile")
+		So(err, ShouldBeNil)
+		for i := 0; i < 5; i++ {
+			raw, err := bson.Marshal(bson.D{{"_id", i}, {"x", "y"}})
+			So(err, ShouldBeNil)
+			_, err = file.Write(raw)
+			So(err, ShouldBeNil)
+		}
+		So(file.Close(), ShouldBeNil)
+
+		export := MongoExport{
+			ToolOptions: options.ToolOptions{Namespace: &options.Namespace{}, HiddenOptions: &options.HiddenOptions{}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, Profile: true, ProfileFormat: ProfileFields},
+			InputOpts:   &InputOptions{BSONFile: file.Name(), SampleSize: 3},
+		}
+		So(export.ValidateSettings(), ShouldBeNil)
+
+		Convey("only the sample size should be profiled", func() {
+			out := &bytes.Buffer{}
+			numDocs, err := export.Profile(out)
+			So(err, ShouldBeNil)
+			So(numDocs, ShouldEqual, 3)
+			So(out.String(), ShouldEqual, "_id\nx\n")
+		})
+
+		Convey("--bsonFile without --profile should be rejected", func() {
+			export.OutputOpts.Profile = false
+			So(export.ValidateSettings(), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.Remove(file.Name())
+		})
+	})
+}
@@ -0,0 +1,200 @@
+package mongofiles
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+)
+
+// copyTarget returns the database and GridFS prefix that copy writes to.
+func (mf *MongoFiles) copyTarget() (string, string) {
+	toDB, toPrefix := mf.StorageOptions.ToDB, mf.StorageOptions.ToPrefix
+	if toDB == "" {
+		toDB = mf.StorageOptions.DB
+	}
+	if toPrefix == "" {
+		toPrefix = mf.StorageOptions.GridFSPrefix
+	}
+	return toDB, toPrefix
+}
+
+// CopyToolOptions returns the options to connect to the --to host with: those
+// of the source, with the --to host and, if --toUsername is given, its own
+// credentials rather than the source's.
+func (mf *MongoFiles) CopyToolOptions() options.ToolOptions {
+	toOpts := *mf.ToolOptions
+	toOpts.Connection = &options.Connection{Host: mf.StorageOptions.To}
+	_, setName := util.ParseConnectionString(mf.StorageOptions.To)
+	toOpts.Direct = (setName == "")
+	toOpts.ReplicaSetName = setName
+	if mf.StorageOptions.ToUsername != "" {
+		toOpts.Auth = &options.Auth{
+			Username: mf.StorageOptions.ToUsername,
+			Password: mf.StorageOptions.ToPassword,
+			Source:   mf.StorageOptions.ToAuthSource,
+		}
+		if mf.ToolOptions.Auth != nil {
+			toOpts.Auth.Mechanism = mf.ToolOptions.Auth.Mechanism
+		}
+	}
+	return toOpts
+}
+
+// validateCopyOptions checks that copy has somewhere to copy to other than
+// the bucket it reads from.
+func (mf *MongoFiles) validateCopyOptions(command string) error {
+	opts := mf.StorageOptions
+	toAuth := opts.ToUsername != "" || opts.ToPassword != "" || opts.ToAuthSource != ""
+	if command != Copy {
+		if opts.To != "" || opts.ToDB != "" || opts.ToPrefix != "" || toAuth {
+			return fmt.Errorf("--to, --toDB, --toPrefix and their credentials can only be used with copy")
+		}
+		return nil
+	}
+	if toAuth && (opts.To == "" || opts.ToUsername == "") {
+		return fmt.Errorf("--toPassword and --toAuthenticationDatabase need --toUsername, " +
+			"and the credentials need --to")
+	}
+	toDB, toPrefix := mf.copyTarget()
+	if opts.To == "" && toDB == opts.DB && toPrefix == opts.GridFSPrefix {
+		return fmt.Errorf("'%v' needs --to, --toDB or --toPrefix to name a different GridFS bucket", command)
+	}
+	return nil
+}
+
+// copyQuery returns the query selecting the files to copy: those matching
+// --filter whose names begin with the prefix given on the command line.
+func (mf *MongoFiles) copyQuery() (bson.D, error) {
+	query := bson.D{}
+	if mf.StorageOptions.Filter != "" {
+		filter, err := parseJSONDocument("--filter", mf.StorageOptions.Filter)
+		if err != nil {
+			return nil, err
+		}
+		query = append(query, bson.DocElem{"$and", []interface{}{filter}})
+	}
+	if mf.FileName != "" {
+		query = append(query, bson.DocElem{"filename", bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}})
+	}
+	return query, nil
+}
+
+// getTargetSession connects to the server that copy writes to, configured
+// with the same write concern rules as the source session.
+func (mf *MongoFiles) getTargetSession(session *mgo.Session) (*mgo.Session, error) {
+	provider := mf.SessionProviderTo
+	if provider == nil {
+		return session.Copy(), nil
+	}
+	targetSession, err := provider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %v: %v", mf.StorageOptions.To, err)
+	}
+	nodeType, err := provider.GetNodeType()
+	if err != nil {
+		targetSession.Close()
+		return nil, fmt.Errorf("error determining type of node connected to with --to: %v", err)
+	}
+	safety, err := db.BuildWriteConcern(mf.StorageOptions.WriteConcern, nodeType)
+	if err != nil {
+		targetSession.Close()
+		return nil, fmt.Errorf("error parsing write concern: %v", err)
+	}
+	targetSession.SetSafe(safety)
+	targetSession.SetSocketTimeout(0)
+	return targetSession, nil
+}
+
+// copyFile copies the chunks of a file and then its files document, both
+// unchanged, so the copy keeps the _id, uploadDate, md5, metadata and aliases
+// of the original. Readers of the target never see a partial file, since the
+// files document is written last.
+func copyFile(source, target *mgo.GridFS, fileDoc bson.D, id interface{}) error {
+	// chunks without a files document are left over from an interrupted copy
+	if _, err := target.Chunks.RemoveAll(bson.M{"files_id": id}); err != nil {
+		return fmt.Errorf("error removing partially copied chunks: %v", err)
+	}
+
+	chunks := source.Chunks.Find(bson.M{"files_id": id}).Sort("n").Iter()
+	var chunk bson.Raw
+	for chunks.Next(&chunk) {
+		if err := target.Chunks.Insert(chunk); err != nil {
+			chunks.Close()
+			return fmt.Errorf("error writing chunk: %v", err)
+		}
+	}
+	if err := chunks.Close(); err != nil {
+		return fmt.Errorf("error reading chunks: %v", err)
+	}
+	if err := target.Files.Insert(fileDoc); err != nil {
+		return fmt.Errorf("error writing files document: %v", err)
+	}
+	return nil
+}
+
+// handle logic for 'copy' command
+func (mf *MongoFiles) handleCopy(session *mgo.Session) (string, error) {
+	query, err := mf.copyQuery()
+	if err != nil {
+		return "", err
+	}
+
+	toDB, toPrefix := mf.copyTarget()
+	if err = util.ValidateFullNamespace(fmt.Sprintf("%s.%s.chunks", toDB, toPrefix)); err != nil {
+		return "", err
+	}
+	targetSession, err := mf.getTargetSession(session)
+	if err != nil {
+		return "", err
+	}
+	defer targetSession.Close()
+	source := mf.gridFS(session)
+	target := targetSession.DB(toDB).GridFS(toPrefix)
+
+	cursor := source.Files.Find(query).Sort("_id").Iter()
+	defer cursor.Close()
+	copied, skipped := 0, 0
+	for {
+		var fileDoc bson.D
+		if !cursor.Next(&fileDoc) {
+			break
+		}
+		fields := fileDoc.Map()
+		id := fields["_id"]
+
+		// the copy keeps the _id, so files already in the target were
+		// copied by an earlier run
+		count, err := target.Files.FindId(id).Count()
+		if err != nil {
+			return "", fmt.Errorf("error checking for GridFS file with _id %v in target: %v", id, err)
+		}
+		if count > 0 {
+			log.Logf(log.Info, "skipping '%v', which is already in the target", fields["filename"])
+			skipped++
+			continue
+		}
+
+		if err = copyFile(source, target, fileDoc, id); err != nil {
+			return "", fmt.Errorf("error copying GridFS file '%v': %v", fields["filename"], err)
+		}
+		log.Logf(log.DebugLow, "copied GridFS file '%v'", fields["filename"])
+		copied++
+	}
+	if err = cursor.Err(); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	if copied > 0 {
+		target.Chunks.EnsureIndexKey("files_id", "n")
+	}
+
+	destination := fmt.Sprintf("%v.%v", toDB, toPrefix)
+	if mf.StorageOptions.To != "" {
+		destination = fmt.Sprintf("%v on %v", destination, mf.StorageOptions.To)
+	}
+	return fmt.Sprintf("copied %v file(s) to %v, skipped %v already there\n", copied, destination, skipped), nil
+}
@@ -0,0 +1,138 @@
+package mongofiles
+
+import (
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/options"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestCopyOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"copy", ""})
+		So(err, ShouldBeNil)
+
+		Convey("copy needs a different target bucket", func() {
+			So(mf.ValidateCommand([]string{Copy}), ShouldNotBeNil)
+			mf.StorageOptions.ToPrefix = "fs"
+			So(mf.ValidateCommand([]string{Copy}), ShouldNotBeNil)
+			mf.StorageOptions.ToPrefix = "archive"
+			So(mf.ValidateCommand([]string{Copy, "img/"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+		})
+
+		Convey("the target defaults to the source database and prefix", func() {
+			mf.StorageOptions.To = "otherhost:27017"
+			toDB, toPrefix := mf.copyTarget()
+			So(toDB, ShouldEqual, testDB)
+			So(toPrefix, ShouldEqual, "fs")
+			So(mf.ValidateCommand([]string{Copy}), ShouldBeNil)
+
+			mf.StorageOptions.ToDB = "assets"
+			toDB, _ = mf.copyTarget()
+			So(toDB, ShouldEqual, "assets")
+		})
+
+		Convey("the --to host uses the source credentials unless --toUsername is given", func() {
+			sourceOpts := *mf.ToolOptions
+			sourceOpts.Auth = &options.Auth{Username: "reader", Password: "secret"}
+			mf.ToolOptions = &sourceOpts
+			mf.StorageOptions.To = "backup/otherhost:27017"
+			toOpts := mf.CopyToolOptions()
+			So(toOpts.Host, ShouldEqual, "backup/otherhost:27017")
+			So(toOpts.ReplicaSetName, ShouldEqual, "backup")
+			So(toOpts.Username, ShouldEqual, "reader")
+
+			mf.StorageOptions.ToUsername = "writer"
+			mf.StorageOptions.ToPassword = "other"
+			mf.StorageOptions.ToAuthSource = "admin"
+			So(mf.ValidateCommand([]string{Copy}), ShouldBeNil)
+			toOpts = mf.CopyToolOptions()
+			So(toOpts.Username, ShouldEqual, "writer")
+			So(toOpts.Password, ShouldEqual, "other")
+			So(toOpts.Source, ShouldEqual, "admin")
+			So(mf.ToolOptions.Username, ShouldEqual, "reader")
+		})
+
+		Convey("--to credentials need --toUsername and --to", func() {
+			mf.StorageOptions.ToPrefix = "archive"
+			mf.StorageOptions.ToPassword = "other"
+			So(mf.ValidateCommand([]string{Copy}), ShouldNotBeNil)
+			mf.StorageOptions.ToUsername = "writer"
+			So(mf.ValidateCommand([]string{Copy}), ShouldNotBeNil)
+			mf.StorageOptions.To = "otherhost"
+			So(mf.ValidateCommand([]string{Copy}), ShouldBeNil)
+		})
+
+		Convey("files are selected by name prefix and --filter", func() {
+			mf.FileName = "img/"
+			mf.StorageOptions.Filter = `{"metadata.owner": "web"}`
+			query, err := mf.copyQuery()
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.D{
+				{"$and", []interface{}{bson.D{{"metadata.owner", "web"}}}},
+				{"filename", bson.M{"$regex": "^img/"}},
+			})
+		})
+	})
+}
+
+func TestCopy(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With files in GridFS", t, func() {
+		_, err := setUpGridFSTestData()
+		So(err, ShouldBeNil)
+
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		source := session.DB(testDB).GridFS("fs")
+		So(source.Files.Update(bson.M{"filename": "testfile2"},
+			bson.M{"$set": bson.M{"metadata": bson.M{"owner": "web"}, "aliases": []string{"second"}}}), ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstance([]string{Copy, ""})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.ToPrefix = "copied"
+
+		Convey("copy writes identical files to the target bucket", func() {
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "copied 3 file(s) to "+testDB+".copied, skipped 0 already there\n")
+
+			var original, copied bson.M
+			So(source.Files.Find(bson.M{"filename": "testfile2"}).One(&original), ShouldBeNil)
+			target := session.DB(testDB).GridFS("copied")
+			So(target.Files.FindId(original["_id"]).One(&copied), ShouldBeNil)
+			So(copied, ShouldResemble, original)
+
+			gFile, err := target.Open("testfile2")
+			So(err, ShouldBeNil)
+			defer gFile.Close()
+			So(gFile.Size(), ShouldEqual, 10)
+
+			Convey("and skips them when run again", func() {
+				output, err := mf.Run(false)
+				So(err, ShouldBeNil)
+				So(output, ShouldEqual, "copied 0 file(s) to "+testDB+".copied, skipped 3 already there\n")
+			})
+		})
+
+		Convey("copy only copies the selected files", func() {
+			mf.StorageOptions.Filter = `{"metadata.owner": "web"}`
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldStartWith, "copied 1 file(s)")
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,387 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// localFile is a regular file found while walking a local directory.
+type localFile struct {
+	// Path is the location of the file on disk
+	Path string
+	// Name is the GridFS filename the file maps to
+	Name string
+	Size int64
+}
+
+// gridFSName maps the path of a file relative to the directory being
+// uploaded to its GridFS filename under remoteDir.
+func gridFSName(remoteDir, relPath string) string {
+	name := filepath.ToSlash(relPath)
+	if remoteDir == "" {
+		return name
+	}
+	return path.Join(remoteDir, name)
+}
+
+// localPath maps a GridFS filename beginning with prefix to a path inside
+// localDir. It errors if the name would resolve to a path outside localDir.
+func localPath(localDir, prefix, name string) (string, error) {
+	relPath := strings.TrimLeft(strings.TrimPrefix(name, prefix), "/")
+	if relPath == "" {
+		return "", fmt.Errorf("GridFS file '%v' has no name below prefix '%v'", name, prefix)
+	}
+	relPath = filepath.Clean(filepath.FromSlash(relPath))
+	if filepath.IsAbs(relPath) || relPath == ".." ||
+		strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("GridFS file '%v' maps to a path outside of '%v'", name, localDir)
+	}
+	return filepath.Join(localDir, relPath), nil
+}
+
+// listLocalFiles walks dir and returns the regular files in it, sorted by
+// GridFS filename. Symbolic links and other special files are skipped.
+func listLocalFiles(dir, remoteDir string) ([]localFile, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading local directory '%v': %v", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("'%v' is not a directory", dir)
+	}
+
+	files := []localFile{}
+	err = filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			log.Logf(log.Info, "skipping '%v', which is not a regular file", filePath)
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, localFile{
+			Path: filePath,
+			Name: gridFSName(remoteDir, relPath),
+			Size: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading local directory '%v': %v", dir, err)
+	}
+	sort.Sort(byName(files))
+	return files, nil
+}
+
+// byName sorts local files by GridFS filename.
+type byName []localFile
+
+func (files byName) Len() int           { return len(files) }
+func (files byName) Swap(i, j int)      { files[i], files[j] = files[j], files[i] }
+func (files byName) Less(i, j int) bool { return files[i].Name < files[j].Name }
+
+// fileMD5 returns the hex-encoded MD5 checksum of a local file, in the same
+// format GridFS stores.
+func fileMD5(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// findLatest returns the most recently uploaded GridFS file for each
+// filename beginning with prefix.
+func findLatest(gfs *mgo.GridFS, prefix string) (map[string]GFSFile, error) {
+	query := bson.M{}
+	if prefix != "" {
+		query["filename"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	cursor := gfs.Find(query).Sort("uploadDate").Iter()
+	defer cursor.Close()
+
+	latest := map[string]GFSFile{}
+	var file GFSFile
+	for cursor.Next(&file) {
+		latest[file.Name] = file
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	return latest, nil
+}
+
+// syncPlan lists the work needed to make GridFS match a local directory.
+type syncPlan struct {
+	Upload    []localFile
+	Unchanged int
+	Delete    []string
+}
+
+// planSync compares local files with the latest remote file of each name.
+// A local file is uploaded if there is no remote file with its name or if
+// the size or MD5 differ; remote files with no local counterpart are only
+// deleted if deleteMissing is set.
+func planSync(local []localFile, remote map[string]GFSFile, deleteMissing bool,
+	checksum func(filePath string) (string, error)) (*syncPlan, error) {
+
+	plan := &syncPlan{}
+	seen := map[string]bool{}
+	for _, file := range local {
+		seen[file.Name] = true
+		remoteFile, ok := remote[file.Name]
+		if ok && remoteFile.Length == file.Size && remoteFile.Md5 != "" {
+			sum, err := checksum(file.Path)
+			if err != nil {
+				return nil, fmt.Errorf("error computing MD5 of '%v': %v", file.Path, err)
+			}
+			if sum == remoteFile.Md5 {
+				plan.Unchanged++
+				continue
+			}
+		}
+		plan.Upload = append(plan.Upload, file)
+	}
+
+	if deleteMissing {
+		for name := range remote {
+			if !seen[name] {
+				plan.Delete = append(plan.Delete, name)
+			}
+		}
+		sort.Strings(plan.Delete)
+	}
+	return plan, nil
+}
+
+// runParallel calls work for each index below count, using up to
+// numParallel goroutines that each have their own copy of session. It stops
+// handing out work after the first error, which it returns.
+func (mf *MongoFiles) runParallel(session *mgo.Session, count int,
+	work func(gfs *mgo.GridFS, i int) error) error {
+
+	numParallel := mf.StorageOptions.NumParallel
+	if numParallel < 1 {
+		numParallel = 1
+	}
+	if numParallel > count {
+		numParallel = count
+	}
+
+	jobs := make(chan int)
+	errs := make(chan error, numParallel)
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < numParallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workerSession := session.Copy()
+			defer workerSession.Close()
+			gfs := mf.gridFS(workerSession)
+			for i := range jobs {
+				if err := work(gfs, i); err != nil {
+					errs <- err
+					failOnce.Do(func() { close(failed) })
+					return
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := 0; i < count; i++ {
+		select {
+		case jobs <- i:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// putLocalFile stores a local file in GridFS under its mapped name. If
+// replace is set, older files with the same name are removed once the new
+// one has been written.
+func (mf *MongoFiles) putLocalFile(gfs *mgo.GridFS, file localFile, metadata bson.D, replace bool) error {
+	localFile, err := os.Open(file.Path)
+	if err != nil {
+		return fmt.Errorf("error while opening local file '%v' : %v", file.Path, err)
+	}
+	defer localFile.Close()
+
+	id, err := mf.storeFile(gfs, file.Name, localFile, metadata)
+	if err != nil {
+		return fmt.Errorf("error while storing '%v' into GridFS: %v", file.Path, err)
+	}
+	log.Logf(log.DebugLow, "added file '%v' from local file '%v'", file.Name, file.Path)
+
+	if !replace {
+		return nil
+	}
+	query := bson.M{"filename": file.Name, "_id": bson.M{"$ne": id}}
+	cursor := gfs.Find(query).Select(bson.M{"_id": 1}).Iter()
+	defer cursor.Close()
+	var older struct {
+		Id interface{} `bson:"_id"`
+	}
+	for cursor.Next(&older) {
+		if err = gfs.RemoveId(older.Id); err != nil {
+			return fmt.Errorf("error while removing older versions of '%v' from GridFS: %v", file.Name, err)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error while removing older versions of '%v' from GridFS: %v", file.Name, err)
+	}
+	return nil
+}
+
+// getToLocalPath writes the latest GridFS file with the given name to
+// filePath, creating any missing parent directories.
+func getToLocalPath(gfs *mgo.GridFS, name, filePath string) error {
+	gFile, err := gfs.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening GridFS file '%s': %v", name, err)
+	}
+	defer gFile.Close()
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("error while creating local directory for '%v': %v", filePath, err)
+	}
+	localFile, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error while opening local file '%v': %v", filePath, err)
+	}
+	defer localFile.Close()
+	if _, err = io.Copy(localFile, gFile); err != nil {
+		return fmt.Errorf("error while writing data into local file '%v': %v", filePath, err)
+	}
+	log.Logf(log.DebugLow, "wrote GridFS file '%v' to '%v'", name, filePath)
+	return nil
+}
+
+// handle logic for 'put_dir' command
+func (mf *MongoFiles) handlePutDir(session *mgo.Session) (string, error) {
+	metadata, err := mf.getMetadata()
+	if err != nil {
+		return "", err
+	}
+	files, err := listLocalFiles(mf.FileName, mf.StorageOptions.RemoteDir)
+	if err != nil {
+		return "", err
+	}
+	err = mf.runParallel(session, len(files), func(gfs *mgo.GridFS, i int) error {
+		return mf.putLocalFile(gfs, files[i], metadata, mf.StorageOptions.Replace)
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("added %v file(s) from '%v'\n", len(files), mf.FileName), nil
+}
+
+// handle logic for 'get_dir' command
+func (mf *MongoFiles) handleGetDir(session *mgo.Session) (string, error) {
+	localDir := mf.StorageOptions.LocalFileName
+	if localDir == "" {
+		localDir = "."
+	}
+
+	remote, err := findLatest(mf.gridFS(session), mf.FileName)
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(remote))
+	paths := map[string]string{}
+	for name := range remote {
+		if paths[name], err = localPath(localDir, mf.FileName, name); err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	err = mf.runParallel(session, len(names), func(gfs *mgo.GridFS, i int) error {
+		return getToLocalPath(gfs, names[i], paths[names[i]])
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("finished writing %v file(s) to %v\n", len(names), localDir), nil
+}
+
+// handle logic for 'sync' command
+func (mf *MongoFiles) handleSync(session *mgo.Session) (string, error) {
+	metadata, err := mf.getMetadata()
+	if err != nil {
+		return "", err
+	}
+	files, err := listLocalFiles(mf.FileName, mf.StorageOptions.RemoteDir)
+	if err != nil {
+		return "", err
+	}
+
+	// only files under --remoteDir take part in the comparison, so that
+	// --delete leaves the rest of the bucket alone
+	prefix := mf.StorageOptions.RemoteDir
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	remote, err := findLatest(mf.gridFS(session), prefix)
+	if err != nil {
+		return "", err
+	}
+	plan, err := planSync(files, remote, mf.StorageOptions.Delete, fileMD5)
+	if err != nil {
+		return "", err
+	}
+	log.Logf(log.Info, "%v file(s) to upload, %v unchanged, %v to delete",
+		len(plan.Upload), plan.Unchanged, len(plan.Delete))
+
+	err = mf.runParallel(session, len(plan.Upload), func(gfs *mgo.GridFS, i int) error {
+		return mf.putLocalFile(gfs, plan.Upload[i], metadata, true)
+	})
+	if err != nil {
+		return "", err
+	}
+	err = mf.runParallel(session, len(plan.Delete), func(gfs *mgo.GridFS, i int) error {
+		if err := gfs.Remove(plan.Delete[i]); err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", plan.Delete[i], err)
+		}
+		log.Logf(log.DebugLow, "removed '%v' from GridFS", plan.Delete[i])
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("uploaded %v file(s), %v unchanged, deleted %v file(s)\n",
+		len(plan.Upload), plan.Unchanged, len(plan.Delete)), nil
+}
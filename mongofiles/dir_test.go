@@ -0,0 +1,225 @@
+package mongofiles
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestTree creates the given files, relative to dir.
+func writeTestTree(dir string, files map[string]string) error {
+	for name, contents := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filePath, []byte(contents), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestDirPathMapping(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With local paths mapped to GridFS names", t, func() {
+		Convey("relative paths use forward slashes under the remote directory", func() {
+			relPath := filepath.Join("img", "a.png")
+			So(gridFSName("", relPath), ShouldEqual, "img/a.png")
+			So(gridFSName("assets", relPath), ShouldEqual, "assets/img/a.png")
+			So(gridFSName("assets/", relPath), ShouldEqual, "assets/img/a.png")
+		})
+
+		Convey("GridFS names have the prefix removed below the local directory", func() {
+			filePath, err := localPath("out", "assets/", "assets/img/a.png")
+			So(err, ShouldBeNil)
+			So(filePath, ShouldEqual, filepath.Join("out", "img", "a.png"))
+
+			filePath, err = localPath("out", "assets", "assets/img/a.png")
+			So(err, ShouldBeNil)
+			So(filePath, ShouldEqual, filepath.Join("out", "img", "a.png"))
+		})
+
+		Convey("names that escape the local directory are rejected", func() {
+			_, err := localPath("out", "assets/", "assets/../../etc/passwd")
+			So(err, ShouldNotBeNil)
+			_, err = localPath("out", "assets/", "assets/")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestListLocalFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a local directory tree", t, func() {
+		dir, err := ioutil.TempDir("", "mongofiles_dir")
+		So(err, ShouldBeNil)
+		So(writeTestTree(dir, map[string]string{
+			"b.txt":         "bb",
+			"sub/a.txt":     "a",
+			"sub/deep/c.go": "ccc",
+		}), ShouldBeNil)
+
+		Convey("every regular file is listed, sorted by GridFS name", func() {
+			files, err := listLocalFiles(dir, "root")
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 3)
+			So(files[0].Name, ShouldEqual, "root/b.txt")
+			So(files[0].Size, ShouldEqual, 2)
+			So(files[1].Name, ShouldEqual, "root/sub/a.txt")
+			So(files[1].Path, ShouldEqual, filepath.Join(dir, "sub", "a.txt"))
+			So(files[2].Name, ShouldEqual, "root/sub/deep/c.go")
+		})
+
+		Convey("a file is not accepted as the directory", func() {
+			_, err := listLocalFiles(filepath.Join(dir, "b.txt"), "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
+
+func TestPlanSync(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With local files and the latest remote files", t, func() {
+		local := []localFile{
+			{Path: "same", Name: "same", Size: 3},
+			{Path: "changed", Name: "changed", Size: 3},
+			{Path: "resized", Name: "resized", Size: 4},
+			{Path: "new", Name: "new", Size: 1},
+		}
+		remote := map[string]GFSFile{
+			"same":    {Name: "same", Length: 3, Md5: "md5-same"},
+			"changed": {Name: "changed", Length: 3, Md5: "md5-old"},
+			"resized": {Name: "resized", Length: 3, Md5: "md5-resized"},
+			"gone":    {Name: "gone", Length: 5, Md5: "md5-gone"},
+		}
+		checksums := 0
+		checksum := func(filePath string) (string, error) {
+			checksums++
+			return "md5-" + filePath, nil
+		}
+
+		Convey("only new and differing files are uploaded", func() {
+			plan, err := planSync(local, remote, false, checksum)
+			So(err, ShouldBeNil)
+			So(plan.Unchanged, ShouldEqual, 1)
+			So(len(plan.Upload), ShouldEqual, 3)
+			So(plan.Upload[0].Name, ShouldEqual, "changed")
+			So(plan.Upload[1].Name, ShouldEqual, "resized")
+			So(plan.Upload[2].Name, ShouldEqual, "new")
+			So(plan.Delete, ShouldBeEmpty)
+
+			// files that differ in size don't need to be read
+			So(checksums, ShouldEqual, 2)
+		})
+
+		Convey("remote files missing locally are deleted with deleteMissing", func() {
+			plan, err := planSync(local, remote, true, checksum)
+			So(err, ShouldBeNil)
+			So(plan.Delete, ShouldResemble, []string{"gone"})
+		})
+
+		Convey("checksum errors are returned", func() {
+			_, err := planSync(local, remote, false, func(string) (string, error) {
+				return "", fmt.Errorf("unreadable")
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateDirCommands(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"sync", "dir"})
+		So(err, ShouldBeNil)
+
+		Convey("put_dir, get_dir and sync require an argument", func() {
+			for _, command := range []string{PutDir, GetDir, Sync} {
+				err := mf.ValidateCommand([]string{command})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, fmt.Sprintf("'%v' argument missing", command))
+				So(mf.ValidateCommand([]string{command, "dir"}), ShouldBeNil)
+			}
+		})
+
+		Convey("--delete is only accepted with sync", func() {
+			mf.StorageOptions.Delete = true
+			So(mf.ValidateCommand([]string{Sync, "dir"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{PutDir, "dir"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDirCommands(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a local directory tree", t, func() {
+		dir, err := ioutil.TempDir("", "mongofiles_dir")
+		So(err, ShouldBeNil)
+		src := filepath.Join(dir, "src")
+		So(writeTestTree(src, map[string]string{
+			"a.txt":     "aaaa",
+			"sub/b.txt": "bb",
+		}), ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstance([]string{PutDir, src})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.RemoteDir = "assets"
+		mf.StorageOptions.NumParallel = 2
+
+		Convey("put_dir and get_dir copy the tree through GridFS", func() {
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			out := filepath.Join(dir, "out")
+			mf.Command = GetDir
+			mf.FileName = "assets/"
+			mf.StorageOptions.LocalFileName = out
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			contents, err := ioutil.ReadFile(filepath.Join(out, "sub", "b.txt"))
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "bb")
+			contents, err = ioutil.ReadFile(filepath.Join(out, "a.txt"))
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "aaaa")
+		})
+
+		Convey("sync only uploads changes and deletes missing files", func() {
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			So(writeTestTree(src, map[string]string{"a.txt": "changed"}), ShouldBeNil)
+			So(os.Remove(filepath.Join(src, "sub", "b.txt")), ShouldBeNil)
+
+			mf.Command = Sync
+			mf.StorageOptions.Delete = true
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "uploaded 1 file(s), 0 unchanged, deleted 1 file(s)\n")
+
+			output, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "uploaded 0 file(s), 1 unchanged, deleted 0 file(s)\n")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
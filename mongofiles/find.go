@@ -0,0 +1,165 @@
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/text"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"time"
+)
+
+// parseJSONDocument parses an extended JSON object given for the named
+// option, keeping the order of its keys.
+func parseJSONDocument(option, raw string) (bson.D, error) {
+	parsedJSON, err := json.UnmarshalOrdered([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v as json: %v", option, err)
+	}
+	doc, ok := parsedJSON.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("%v must be a JSON object", option)
+	}
+	if _, err = bsonutil.ConvertJSONValueToBSON(doc); err != nil {
+		return nil, fmt.Errorf("error converting %v to bson: %v", option, err)
+	}
+	return doc, nil
+}
+
+// getMetadata returns the document given with --metadata, or nil if none was
+// given.
+func (mf *MongoFiles) getMetadata() (bson.D, error) {
+	if mf.StorageOptions.Metadata == "" {
+		return nil, nil
+	}
+	return parseJSONDocument("--metadata", mf.StorageOptions.Metadata)
+}
+
+// setFileAttributes sets the optional content type and metadata on a GridFS
+// file that is being written.
+func (mf *MongoFiles) setFileAttributes(gFile *mgo.GridFile, metadata bson.D) {
+	if mf.StorageOptions.ContentType != "" {
+		gFile.SetContentType(mf.StorageOptions.ContentType)
+	}
+	if metadata != nil {
+		gFile.SetMeta(metadata)
+	}
+}
+
+// setAliases stores the --alias values on a GridFS file once it has been
+// written. The driver has no way of including them when the file is created.
+func (mf *MongoFiles) setAliases(gfs *mgo.GridFS, id interface{}) error {
+	if len(mf.StorageOptions.Aliases) == 0 {
+		return nil
+	}
+	err := gfs.Files.UpdateId(id, bson.M{"$set": bson.M{"aliases": mf.StorageOptions.Aliases}})
+	if err != nil {
+		return fmt.Errorf("error while setting aliases on GridFS file with _id %v: %v", id, err)
+	}
+	return nil
+}
+
+// handle logic for 'find' command
+func (mf *MongoFiles) handleFind(gfs *mgo.GridFS) (string, error) {
+	query := bson.D{}
+	if mf.StorageOptions.Filter != "" {
+		var err error
+		if query, err = parseJSONDocument("--filter", mf.StorageOptions.Filter); err != nil {
+			return "", err
+		}
+	}
+
+	cursor := gfs.Find(query).Sort("filename", "uploadDate").Iter()
+	defer cursor.Close()
+
+	var raw bson.Raw
+	var files []bson.D
+	for cursor.Next(&raw) {
+		var file bson.D
+		if err := raw.Unmarshal(&file); err != nil {
+			return "", fmt.Errorf("error decoding GridFS file: %v", err)
+		}
+		files = append(files, file)
+	}
+	if err := cursor.Err(); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	if mf.StorageOptions.JSONOutput {
+		return formatFilesJSON(files)
+	}
+	return formatFilesTable(files)
+}
+
+// formatFilesJSON prints each GridFS file document as extended JSON on its own
+// line.
+func formatFilesJSON(files []bson.D) (string, error) {
+	output := &bytes.Buffer{}
+	for _, file := range files {
+		line, err := marshalJSONValue(file)
+		if err != nil {
+			return "", err
+		}
+		output.WriteString(line)
+		output.WriteByte('\n')
+	}
+	return output.String(), nil
+}
+
+// formatFilesTable prints the GridFS file documents as a table with a column
+// for each of the standard fields, and the metadata as extended JSON.
+func formatFilesTable(files []bson.D) (string, error) {
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("_id", "filename", "length", "uploadDate", "contentType", "aliases", "metadata")
+	grid.EndRow()
+	for _, file := range files {
+		fields := file.Map()
+		id, err := marshalJSONValue(fields["_id"])
+		if err != nil {
+			return "", err
+		}
+		grid.WriteCells(id, fmt.Sprintf("%v", fields["filename"]), fmt.Sprintf("%v", fields["length"]))
+		if uploadDate, ok := fields["uploadDate"].(time.Time); ok {
+			grid.WriteCell(uploadDate.UTC().Format(time.RFC3339))
+		} else {
+			grid.WriteCell("")
+		}
+		contentType, _ := fields["contentType"].(string)
+		grid.WriteCell(contentType)
+
+		var aliases []string
+		if values, ok := fields["aliases"].([]interface{}); ok {
+			for _, alias := range values {
+				aliases = append(aliases, fmt.Sprintf("%v", alias))
+			}
+		}
+		grid.WriteCell(strings.Join(aliases, ","))
+
+		metadata := ""
+		if fields["metadata"] != nil {
+			if metadata, err = marshalJSONValue(fields["metadata"]); err != nil {
+				return "", err
+			}
+		}
+		grid.Feed(metadata)
+	}
+	buf := &bytes.Buffer{}
+	grid.Flush(buf)
+	return buf.String(), nil
+}
+
+// marshalJSONValue converts a BSON value to a line of extended JSON.
+func marshalJSONValue(value interface{}) (string, error) {
+	extendedValue, err := bsonutil.ConvertBSONValueToJSON(value)
+	if err != nil {
+		return "", fmt.Errorf("error converting BSON to extended JSON: %v", err)
+	}
+	out, err := json.Marshal(extendedValue)
+	if err != nil {
+		return "", fmt.Errorf("error converting BSON to extended JSON: %v", err)
+	}
+	return string(out), nil
+}
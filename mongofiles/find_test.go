@@ -0,0 +1,135 @@
+package mongofiles
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing a JSON option", t, func() {
+		Convey("key order and extended JSON values are kept", func() {
+			doc, err := parseJSONDocument("--metadata", `{b: 1, a: {$date: 0}, c: {d: "x"}}`)
+			So(err, ShouldBeNil)
+			So(len(doc), ShouldEqual, 3)
+			So(doc[0].Name, ShouldEqual, "b")
+			So(doc[1].Name, ShouldEqual, "a")
+			So(doc[1].Value, ShouldHaveSameTypeAs, time.Time{})
+			So(doc[2].Value, ShouldResemble, bson.D{{"d", "x"}})
+		})
+
+		Convey("anything but an object is rejected", func() {
+			_, err := parseJSONDocument("--metadata", `[1, 2]`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--metadata must be a JSON object")
+			_, err = parseJSONDocument("--filter", `{a: `)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFormatFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With GridFS file documents", t, func() {
+		id := bson.ObjectIdHex("5566778899aabbccddeeff00")
+		files := []bson.D{
+			{
+				{"_id", id},
+				{"filename", "a.png"},
+				{"length", int64(10)},
+				{"uploadDate", time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+				{"contentType", "image/png"},
+				{"aliases", []interface{}{"logo", "icon"}},
+				{"metadata", bson.D{{"owner", "web"}}},
+			},
+			{
+				{"_id", 2},
+				{"filename", "b.txt"},
+				{"length", int64(3)},
+			},
+		}
+
+		Convey("the table has a row for each file", func() {
+			output, err := formatFilesTable(files)
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(strings.Fields(lines[0]), ShouldResemble, []string{
+				"_id", "filename", "length", "uploadDate", "contentType", "aliases", "metadata"})
+			So(strings.Fields(lines[1]), ShouldResemble, []string{
+				`{"$oid":"5566778899aabbccddeeff00"}`, "a.png", "10",
+				"2015-01-02T03:04:05Z", "image/png", "logo,icon", `{"owner":"web"}`})
+			So(strings.Fields(lines[2]), ShouldResemble, []string{"2", "b.txt", "3"})
+		})
+
+		Convey("JSON output has a document per line", func() {
+			output, err := formatFilesJSON(files[1:])
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, `{"_id":2,"filename":"b.txt","length":{"$numberLong":"3"}}`+"\n")
+		})
+	})
+}
+
+func TestValidateFindCommand(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"find", ""})
+		So(err, ShouldBeNil)
+
+		Convey("find takes no filename", func() {
+			So(mf.ValidateCommand([]string{Find}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{Find, "name"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPutMetadataAndFind(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a file put with metadata and aliases", t, func() {
+		dir, err := ioutil.TempDir("", "mongofiles_find")
+		So(err, ShouldBeNil)
+		localFileName := filepath.Join(dir, "report.txt")
+		So(ioutil.WriteFile(localFileName, []byte("report"), 0644), ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstance([]string{Put, "report.txt"})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = localFileName
+		mf.StorageOptions.Metadata = `{owner: "web", version: 2}`
+		mf.StorageOptions.Aliases = []string{"latest"}
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		Convey("find can select it by metadata and alias", func() {
+			mf.Command = Find
+			mf.FileName = ""
+			mf.StorageOptions.JSONOutput = true
+
+			mf.StorageOptions.Filter = `{"metadata.owner": "web", aliases: "latest"}`
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldContainSubstring, `"filename":"report.txt"`)
+			So(output, ShouldContainSubstring, `"metadata":{"owner":"web","version":2}`)
+
+			mf.StorageOptions.Filter = `{"metadata.owner": "db"}`
+			output, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,302 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// QuarantineSuffix is appended to the GridFS prefix to name the bucket
+	// that 'fsck --repair' moves broken files into.
+	QuarantineSuffix = ".quarantine"
+
+	// defaultOrphanAge is how old orphan chunks must be for 'fsck --repair'
+	// to remove them, unless --orphanAge is given.
+	defaultOrphanAge = time.Hour
+)
+
+// fsckFile is a document in the files collection of a GridFS bucket. Unlike
+// GFSFile, it accepts any type of _id, since fsck has to cope with files
+// written by any driver.
+type fsckFile struct {
+	Id        interface{} `bson:"_id"`
+	Name      string      `bson:"filename"`
+	Length    int64       `bson:"length"`
+	ChunkSize int         `bson:"chunkSize"`
+	Md5       string      `bson:"md5"`
+}
+
+// gfsChunk is a document in the chunks collection of a GridFS bucket.
+type gfsChunk struct {
+	Id      interface{} `bson:"_id,omitempty"`
+	FilesId interface{} `bson:"files_id"`
+	N       int         `bson:"n"`
+	Data    []byte      `bson:"data"`
+}
+
+// chunkSource is the part of a cursor used to read the chunks of a file.
+type chunkSource interface {
+	Next(result interface{}) bool
+	Err() error
+}
+
+// fsckReport is the result of checking a GridFS bucket.
+type fsckReport struct {
+	Files int
+	// Broken holds the files with problems, along with their problems
+	Broken []brokenFile
+	// Orphans holds the files_id of chunks with no files document, along
+	// with the number of chunks for each
+	Orphans []orphanChunks
+}
+
+type brokenFile struct {
+	File     fsckFile
+	Problems []string
+}
+
+type orphanChunks struct {
+	FilesId interface{}
+	Count   int
+}
+
+// expectedChunks returns the number of chunks a file of the given length is
+// split into.
+func expectedChunks(file fsckFile) int {
+	if file.Length == 0 || file.ChunkSize <= 0 {
+		return 0
+	}
+	return int((file.Length + int64(file.ChunkSize) - 1) / int64(file.ChunkSize))
+}
+
+// checkFileChunks reads the chunks of a file, which must be sorted by n, and
+// returns a description of each problem found: missing, duplicate or extra
+// chunks, chunks of the wrong size, or a checksum that doesn't match the
+// stored MD5.
+func checkFileChunks(file fsckFile, chunks chunkSource) ([]string, error) {
+	var problems []string
+	expected := expectedChunks(file)
+	hash := md5.New()
+	next := 0
+	var chunk gfsChunk
+	for chunks.Next(&chunk) {
+		switch {
+		case chunk.N < next:
+			problems = append(problems, fmt.Sprintf("duplicate chunk %v", chunk.N))
+			continue
+		case chunk.N >= expected:
+			problems = append(problems, fmt.Sprintf("unexpected chunk %v of %v", chunk.N, expected))
+			continue
+		case chunk.N > next:
+			problems = append(problems, fmt.Sprintf("missing chunk(s) %v", chunkRange(next, chunk.N-1)))
+		}
+		next = chunk.N + 1
+
+		size := int64(file.ChunkSize)
+		if chunk.N == expected-1 {
+			size = file.Length - int64(expected-1)*int64(file.ChunkSize)
+		}
+		if int64(len(chunk.Data)) != size {
+			problems = append(problems, fmt.Sprintf("chunk %v has %v bytes, expected %v", chunk.N, len(chunk.Data), size))
+		}
+		hash.Write(chunk.Data)
+	}
+	if err := chunks.Err(); err != nil {
+		return nil, fmt.Errorf("error reading chunks of GridFS file '%v': %v", file.Name, err)
+	}
+	if next < expected {
+		problems = append(problems, fmt.Sprintf("missing chunk(s) %v", chunkRange(next, expected-1)))
+	}
+
+	// a checksum over incomplete data is bound to differ
+	if len(problems) == 0 && file.Md5 != "" {
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != file.Md5 {
+			problems = append(problems, fmt.Sprintf("md5 is %v, expected %v", sum, file.Md5))
+		}
+	}
+	return problems, nil
+}
+
+func chunkRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("%v", first)
+	}
+	return fmt.Sprintf("%v-%v", first, last)
+}
+
+// fsck checks every file in the bucket against its chunks, then looks for
+// chunks that don't belong to any file.
+func fsck(gfs *mgo.GridFS) (*fsckReport, error) {
+	report := &fsckReport{}
+
+	cursor := gfs.Files.Find(nil).Sort("_id").Iter()
+	defer cursor.Close()
+	var file fsckFile
+	for cursor.Next(&file) {
+		report.Files++
+		chunks := gfs.Chunks.Find(bson.M{"files_id": file.Id}).Sort("n").Iter()
+		problems, err := checkFileChunks(file, chunks)
+		chunks.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(problems) > 0 {
+			report.Broken = append(report.Broken, brokenFile{File: file, Problems: problems})
+		}
+		log.Logf(log.DebugHigh, "checked GridFS file '%v'", file.Name)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	// chunks are read in files_id order, so each distinct files_id only
+	// needs to be looked up once
+	chunks := gfs.Chunks.Find(nil).Select(bson.M{"files_id": 1}).Sort("files_id", "n").Iter()
+	defer chunks.Close()
+	var chunk gfsChunk
+	var lastFilesId interface{}
+	var current *orphanChunks
+	for i := 0; chunks.Next(&chunk); i++ {
+		if i > 0 && reflect.DeepEqual(lastFilesId, chunk.FilesId) {
+			if current != nil {
+				current.Count++
+			}
+			continue
+		}
+		lastFilesId = chunk.FilesId
+		current = nil
+		count, err := gfs.Files.FindId(chunk.FilesId).Count()
+		if err != nil {
+			return nil, fmt.Errorf("error looking up GridFS file with _id %v: %v", chunk.FilesId, err)
+		}
+		if count == 0 {
+			report.Orphans = append(report.Orphans, orphanChunks{FilesId: chunk.FilesId, Count: 1})
+			current = &report.Orphans[len(report.Orphans)-1]
+		}
+	}
+	if err := chunks.Err(); err != nil {
+		return nil, fmt.Errorf("error reading GridFS chunks: %v", err)
+	}
+	return report, nil
+}
+
+// quarantine moves a file and its chunks into the quarantine bucket.
+func quarantine(gfs, quarantineGFS *mgo.GridFS, id interface{}) error {
+	var fileDoc bson.D
+	if err := gfs.Files.FindId(id).One(&fileDoc); err != nil {
+		return err
+	}
+	if _, err := quarantineGFS.Files.UpsertId(id, fileDoc); err != nil {
+		return err
+	}
+	chunks := gfs.Chunks.Find(bson.M{"files_id": id}).Iter()
+	var chunkDoc bson.D
+	for chunks.Next(&chunkDoc) {
+		if err := quarantineGFS.Chunks.Insert(chunkDoc); err != nil && !mgo.IsDup(err) {
+			chunks.Close()
+			return err
+		}
+		chunkDoc = nil
+	}
+	if err := chunks.Close(); err != nil {
+		return err
+	}
+	return gfs.RemoveId(id)
+}
+
+// removeOrphanChunks removes the chunks with the given files_id, and returns
+// true, if they all were written before the cutoff and there still is no
+// files document for them. Uploads write the chunks of a file before its
+// files document, so the chunks of an upload in progress look like orphans
+// until it completes. The age of a chunk is that of its ObjectId _id, so
+// chunks with other _ids are never removed. An upload that stalls for longer
+// than the cutoff before writing its files document can still lose its
+// chunks.
+func removeOrphanChunks(gfs *mgo.GridFS, filesId interface{}, cutoff time.Time) (bool, error) {
+	recent, err := gfs.Chunks.Find(bson.M{
+		"files_id": filesId,
+		"_id":      bson.M{"$not": bson.M{"$lt": bson.NewObjectIdWithTime(cutoff)}},
+	}).Count()
+	if err != nil || recent > 0 {
+		return false, err
+	}
+	// check again, since an upload may have finished since fsck ran
+	files, err := gfs.Files.FindId(filesId).Count()
+	if err != nil || files > 0 {
+		return false, err
+	}
+	_, err = gfs.Chunks.RemoveAll(bson.M{"files_id": filesId})
+	return err == nil, err
+}
+
+// handle logic for 'fsck' command
+func (mf *MongoFiles) handleFsck(session *mgo.Session) (string, error) {
+	gfs := mf.gridFS(session)
+	report, err := fsck(gfs)
+	if err != nil {
+		return "", err
+	}
+
+	repair := mf.StorageOptions.Repair
+	orphanAge := defaultOrphanAge
+	if mf.StorageOptions.OrphanAge != "" {
+		if orphanAge, err = parseAge("orphanAge", mf.StorageOptions.OrphanAge); err != nil {
+			return "", err
+		}
+	}
+	orphanCutoff := time.Now().Add(-orphanAge)
+	quarantinePrefix := mf.StorageOptions.GridFSPrefix + QuarantineSuffix
+	quarantineGFS := session.DB(mf.StorageOptions.DB).GridFS(quarantinePrefix)
+
+	var output []string
+	for _, broken := range report.Broken {
+		id, err := marshalJSONValue(broken.File.Id)
+		if err != nil {
+			return "", err
+		}
+		output = append(output, fmt.Sprintf("file '%v' (_id %v): %v",
+			broken.File.Name, id, strings.Join(broken.Problems, "; ")))
+		if repair {
+			if err = quarantine(gfs, quarantineGFS, broken.File.Id); err != nil {
+				return "", fmt.Errorf("error quarantining GridFS file '%v': %v", broken.File.Name, err)
+			}
+			output = append(output, fmt.Sprintf("\tmoved to GridFS prefix '%v'", quarantinePrefix))
+		}
+	}
+	orphans := 0
+	for _, orphan := range report.Orphans {
+		orphans += orphan.Count
+		id, err := marshalJSONValue(orphan.FilesId)
+		if err != nil {
+			return "", err
+		}
+		output = append(output, fmt.Sprintf("%v orphan chunk(s) with files_id %v", orphan.Count, id))
+		if repair {
+			removed, err := removeOrphanChunks(gfs, orphan.FilesId, orphanCutoff)
+			if err != nil {
+				return "", fmt.Errorf("error removing orphan chunks with files_id %v: %v", orphan.FilesId, err)
+			}
+			if removed {
+				output = append(output, "\tremoved")
+			} else {
+				output = append(output, "\tkept, since they may belong to an upload in progress")
+			}
+		}
+	}
+	output = append(output, fmt.Sprintf("checked %v file(s): %v broken, %v orphan chunk(s)",
+		report.Files, len(report.Broken), orphans))
+
+	result := strings.Join(output, "\n") + "\n"
+	if !repair && (len(report.Broken) > 0 || orphans > 0) {
+		return result, fmt.Errorf("GridFS bucket '%v' has errors; run with --repair to fix them",
+			mf.StorageOptions.GridFSPrefix)
+	}
+	return result, nil
+}
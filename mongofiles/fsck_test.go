@@ -0,0 +1,192 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+// chunkSlice is a chunkSource over chunks held in memory.
+type chunkSlice struct {
+	chunks []gfsChunk
+	next   int
+}
+
+func (cs *chunkSlice) Next(result interface{}) bool {
+	if cs.next >= len(cs.chunks) {
+		return false
+	}
+	*result.(*gfsChunk) = cs.chunks[cs.next]
+	cs.next++
+	return true
+}
+
+func (cs *chunkSlice) Err() error {
+	return nil
+}
+
+func md5Hex(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCheckFileChunks(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a 10 byte file in chunks of 4 bytes", t, func() {
+		file := fsckFile{Name: "f", Length: 10, ChunkSize: 4, Md5: md5Hex("aaaabbbbcc")}
+		chunks := []gfsChunk{
+			{N: 0, Data: []byte("aaaa")},
+			{N: 1, Data: []byte("bbbb")},
+			{N: 2, Data: []byte("cc")},
+		}
+
+		Convey("a complete file has no problems", func() {
+			problems, err := checkFileChunks(file, &chunkSlice{chunks: chunks})
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+
+		Convey("missing chunks are reported", func() {
+			problems, err := checkFileChunks(file, &chunkSlice{chunks: chunks[1:2]})
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{"missing chunk(s) 0", "missing chunk(s) 2"})
+
+			problems, err = checkFileChunks(file, &chunkSlice{})
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{"missing chunk(s) 0-2"})
+		})
+
+		Convey("duplicate, extra and short chunks are reported", func() {
+			broken := []gfsChunk{
+				chunks[0],
+				chunks[0],
+				{N: 1, Data: []byte("bb")},
+				chunks[2],
+				{N: 3, Data: []byte("dd")},
+			}
+			problems, err := checkFileChunks(file, &chunkSlice{chunks: broken})
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{
+				"duplicate chunk 0",
+				"chunk 1 has 2 bytes, expected 4",
+				"unexpected chunk 3 of 3",
+			})
+		})
+
+		Convey("a checksum mismatch is reported", func() {
+			file.Md5 = md5Hex("something else")
+			problems, err := checkFileChunks(file, &chunkSlice{chunks: chunks})
+			So(err, ShouldBeNil)
+			So(len(problems), ShouldEqual, 1)
+			So(problems[0], ShouldStartWith, "md5 is "+md5Hex("aaaabbbbcc"))
+		})
+
+		Convey("an empty file has no chunks", func() {
+			problems, err := checkFileChunks(fsckFile{Length: 0, ChunkSize: 4}, &chunkSlice{})
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestValidateFsckCommand(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"fsck", ""})
+		So(err, ShouldBeNil)
+
+		Convey("fsck takes no filename", func() {
+			So(mf.ValidateCommand([]string{Fsck}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{Fsck, "name"}), ShouldNotBeNil)
+		})
+
+		Convey("--repair is only accepted with fsck", func() {
+			mf.StorageOptions.Repair = true
+			So(mf.ValidateCommand([]string{Fsck}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+		})
+
+		Convey("--orphanAge is only accepted with --repair, as a duration", func() {
+			mf.StorageOptions.OrphanAge = "2d"
+			So(mf.ValidateCommand([]string{Fsck}), ShouldNotBeNil)
+			mf.StorageOptions.Repair = true
+			So(mf.ValidateCommand([]string{Fsck}), ShouldBeNil)
+			mf.StorageOptions.OrphanAge = "soon"
+			So(mf.ValidateCommand([]string{Fsck}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFsck(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a GridFS bucket with a broken file and orphan chunks", t, func() {
+		_, err := setUpGridFSTestData()
+		So(err, ShouldBeNil)
+
+		sessionProvider, err := db.NewSessionProvider(*toolOptions)
+		So(err, ShouldBeNil)
+		session, err := sessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		gfs := session.DB(testDB).GridFS("fs")
+
+		// testfile2 loses its only chunk, and two chunks belong to no file
+		var file GFSFile
+		So(gfs.Find(bson.M{"filename": "testfile2"}).One(&file), ShouldBeNil)
+		So(gfs.Chunks.Remove(bson.M{"files_id": file.Id}), ShouldBeNil)
+		orphanId := bson.NewObjectId()
+		for n := 0; n < 2; n++ {
+			So(gfs.Chunks.Insert(bson.M{"files_id": orphanId, "n": n, "data": []byte("x")}), ShouldBeNil)
+		}
+
+		mf, err := simpleMongoFilesInstance([]string{Fsck, ""})
+		So(err, ShouldBeNil)
+
+		Convey("fsck reports the problems and fails", func() {
+			output, err := mf.Run(false)
+			So(err, ShouldNotBeNil)
+			So(output, ShouldContainSubstring, "file 'testfile2'")
+			So(output, ShouldContainSubstring, fmt.Sprintf(`2 orphan chunk(s) with files_id {"$oid":"%v"}`, orphanId.Hex()))
+			So(strings.HasSuffix(output, "checked 3 file(s): 1 broken, 2 orphan chunk(s)\n"), ShouldBeTrue)
+		})
+
+		Convey("fsck --repair keeps orphan chunks written recently", func() {
+			mf.StorageOptions.Repair = true
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldContainSubstring, "kept, since they may belong to an upload in progress")
+			orphans, err := gfs.Chunks.Find(bson.M{"files_id": orphanId}).Count()
+			So(err, ShouldBeNil)
+			So(orphans, ShouldEqual, 2)
+		})
+
+		Convey("fsck --repair fixes them", func() {
+			mf.StorageOptions.Repair = true
+			mf.StorageOptions.OrphanAge = "0s"
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			quarantined, err := session.DB(testDB).GridFS("fs" + QuarantineSuffix).Find(nil).Count()
+			So(err, ShouldBeNil)
+			So(quarantined, ShouldEqual, 1)
+
+			mf.StorageOptions.Repair = false
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "checked 2 file(s): 0 broken, 0 orphan chunk(s)\n")
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -64,10 +64,22 @@ func main() {
 		os.Exit(util.ExitBadOptions)
 	}
 
+	// create a session provider for the server that 'copy' writes to, with
+	// the ssl options of the source, and its credentials unless --toUsername
+	// is given
+	if storageOpts.To != "" {
+		mf.SessionProviderTo, err = db.NewSessionProvider(mf.CopyToolOptions())
+		if err != nil {
+			log.Logf(log.Always, "error connecting to destination host: %v", err)
+			os.Exit(util.ExitError)
+		}
+	}
+
 	output, err := mf.Run(true)
+	// some commands, like fsck, report what they found even when they fail
+	fmt.Printf("%s", output)
 	if err != nil {
 		log.Logf(log.Always, "Failed: %v", err)
 		os.Exit(util.ExitError)
 	}
-	fmt.Printf("%s", output)
 }
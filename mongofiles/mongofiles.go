@@ -26,6 +26,13 @@ const (
 	GetID    = "get_id"
 	Delete   = "delete"
 	DeleteID = "delete_id"
+	PutDir   = "put_dir"
+	GetDir   = "get_dir"
+	Sync     = "sync"
+	Find     = "find"
+	Fsck     = "fsck"
+	Prune    = "prune"
+	Copy     = "copy"
 )
 
 // MongoFiles is a container for the user-specified options and
@@ -40,6 +47,9 @@ type MongoFiles struct {
 	// for connecting to the db
 	SessionProvider *db.SessionProvider
 
+	// for connecting to the server given by --to, which 'copy' writes to
+	SessionProviderTo *db.SessionProvider
+
 	// command to run
 	Command string
 
@@ -56,6 +66,7 @@ type GFSFile struct {
 	Md5         string        `bson:"md5"`
 	UploadDate  time.Time     `bson:"uploadDate"`
 	ContentType string        `bson:"contentType,omitempty"`
+	Aliases     []string      `bson:"aliases,omitempty"`
 }
 
 // ValidateCommand ensures the arguments supplied are valid.
@@ -70,13 +81,22 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 
 	var fileName string
 	switch args[0] {
-	case List:
+	case List, Prune, Copy:
 		if len(args) == 1 {
 			fileName = ""
 		} else {
 			fileName = args[1]
 		}
-	case Search, Put, Get, Delete, GetID, DeleteID:
+	case Find:
+		// files are selected with --filter rather than by name
+		if len(args) > 1 {
+			return fmt.Errorf("'%v' does not take a filename; use --filter to select files", args[0])
+		}
+	case Fsck:
+		if len(args) > 1 {
+			return fmt.Errorf("'%v' does not take a filename; it checks the whole bucket", args[0])
+		}
+	case Search, Put, Get, Delete, GetID, DeleteID, PutDir, GetDir, Sync:
 		// also make sure the supporting argument isn't literally an
 		// empty string for example, mongofiles get ""
 		if len(args) == 1 || args[1] == "" {
@@ -91,14 +111,129 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		return fmt.Errorf("--prefix can not be blank")
 	}
 
+	if mf.StorageOptions.Delete && args[0] != Sync {
+		return fmt.Errorf("--delete can only be used with sync")
+	}
+
+	if mf.StorageOptions.Repair && args[0] != Fsck {
+		return fmt.Errorf("--repair can only be used with fsck")
+	}
+
+	if mf.StorageOptions.OrphanAge != "" {
+		if !mf.StorageOptions.Repair {
+			return fmt.Errorf("--orphanAge can only be used with fsck --repair")
+		}
+		if _, err := parseAge("orphanAge", mf.StorageOptions.OrphanAge); err != nil {
+			return err
+		}
+	}
+
+	if err := mf.validateRangeOptions(args[0]); err != nil {
+		return err
+	}
+
+	if err := mf.validateVersionOptions(args[0]); err != nil {
+		return err
+	}
+
+	if err := mf.validateCopyOptions(args[0]); err != nil {
+		return err
+	}
+
+	if mf.StorageOptions.ChunkSize < 0 || mf.StorageOptions.ChunkSize > MaxChunkSizeKB {
+		return fmt.Errorf("--chunkSize must be between 0 and %v", MaxChunkSizeKB)
+	}
+
+	if mf.StorageOptions.NumChunkWorkers < 0 {
+		return fmt.Errorf("--numChunkWorkers can not be negative")
+	}
+
+	if mf.StorageOptions.NumParallel < 0 {
+		return fmt.Errorf("--numParallel can not be negative")
+	}
+
 	// set the mongofiles command and file name
 	mf.Command = args[0]
 	mf.FileName = fileName
 	return nil
 }
 
+// validateRangeOptions checks the options for downloading part of a file.
+func (mf *MongoFiles) validateRangeOptions(command string) error {
+	opts := mf.StorageOptions
+	if opts.Offset == 0 && opts.Length == 0 && !opts.Resume {
+		return nil
+	}
+	if command != Get && command != GetID {
+		return fmt.Errorf("--offset, --length and --resume can only be used with get|get_id")
+	}
+	if opts.Offset < 0 {
+		return fmt.Errorf("--offset can not be negative")
+	}
+	if opts.Length < 0 {
+		return fmt.Errorf("--length can not be negative")
+	}
+	if opts.Resume && opts.LocalFileName == "-" {
+		return fmt.Errorf("--resume can not be used when writing to stdout")
+	}
+	return nil
+}
+
+// validateVersionOptions checks the options for working with the versions
+// of a file.
+func (mf *MongoFiles) validateVersionOptions(command string) error {
+	opts := mf.StorageOptions
+	if opts.Versions && command != List && command != Search {
+		return fmt.Errorf("--versions can only be used with list|search")
+	}
+
+	if opts.FileVersion != "" || opts.At != "" {
+		if command != Get {
+			return fmt.Errorf("--fileVersion and --at can only be used with get")
+		}
+		if opts.FileVersion != "" && opts.At != "" {
+			return fmt.Errorf("--fileVersion and --at can not be used together")
+		}
+		if opts.FileVersion != "" {
+			if _, err := parseVersion(opts.FileVersion); err != nil {
+				return err
+			}
+		} else if _, err := parseAt(opts.At); err != nil {
+			return err
+		}
+	}
+
+	if command != Prune {
+		if opts.Keep != 0 || opts.OlderThan != "" {
+			return fmt.Errorf("--keep and --olderThan can only be used with prune")
+		}
+		return nil
+	}
+	if opts.Keep < 0 {
+		return fmt.Errorf("--keep can not be negative")
+	}
+	if opts.Keep == 0 && opts.OlderThan == "" {
+		return fmt.Errorf("'%v' needs --keep or --olderThan to select the versions to remove", command)
+	}
+	if opts.OlderThan != "" {
+		if _, err := parseAge("olderThan", opts.OlderThan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gridFS returns the GridFS bucket to use on the given session.
+func (mf *MongoFiles) gridFS(session *mgo.Session) *mgo.GridFS {
+	return session.DB(mf.StorageOptions.DB).GridFS(mf.StorageOptions.GridFSPrefix)
+}
+
 // Query GridFS for files and display the results.
 func (mf *MongoFiles) findAndDisplay(gfs *mgo.GridFS, query bson.M) (string, error) {
+	if mf.StorageOptions.Versions {
+		return mf.findAndDisplayVersions(gfs, query)
+	}
+
 	display := ""
 
 	cursor := gfs.Find(query).Iter()
@@ -132,7 +267,7 @@ func (mf *MongoFiles) getLocalFileName(gridFile *mgo.GridFile) string {
 
 // handle logic for 'get' command
 func (mf *MongoFiles) handleGet(gfs *mgo.GridFS) (string, error) {
-	gFile, err := gfs.Open(mf.FileName)
+	gFile, err := mf.openVersion(gfs, mf.FileName)
 	if err != nil {
 		return "", fmt.Errorf("error opening GridFS file '%s': %v", mf.FileName, err)
 	}
@@ -190,12 +325,45 @@ func (mf *MongoFiles) parseID() (interface{}, error) {
 	return id, nil
 }
 
-// writeFile writes a file from gridFS to stdout or the filesystem.
+// downloadRange returns the range of bytes [start, end) of a GridFS file of
+// the given size to write, given the --offset and --length options and the
+// number of bytes already written by an interrupted download.
+func downloadRange(size, offset, length, written int64) (int64, int64, error) {
+	if offset > size {
+		return 0, 0, fmt.Errorf("--offset %v is past the end of the file, which is %v bytes long", offset, size)
+	}
+	end := size
+	if length > 0 && offset+length < size {
+		end = offset + length
+	}
+	start := offset + written
+	if start > end {
+		return 0, 0, fmt.Errorf("local file has %v bytes, more than the %v requested", written, end-offset)
+	}
+	return start, end, nil
+}
+
+// writeFile writes a file, or the range of it given by --offset and
+// --length, from gridFS to stdout or the filesystem. With --resume, the data
+// is appended to what an earlier download already wrote to the local file.
 func (mf *MongoFiles) writeFile(gridFile *mgo.GridFile) (err error) {
 	localFileName := mf.getLocalFileName(gridFile)
 	var localFile io.WriteCloser
+	var written int64
 	if localFileName == "-" {
 		localFile = os.Stdout
+	} else if mf.StorageOptions.Resume {
+		var file *os.File
+		if file, err = os.OpenFile(localFileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666); err != nil {
+			return fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
+		}
+		localFile, written = file, info.Size()
+		log.Logf(log.DebugLow, "resuming download into local file '%v' after %v bytes", localFileName, written)
 	} else {
 		if localFile, err = os.Create(localFileName); err != nil {
 			return fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
@@ -204,7 +372,19 @@ func (mf *MongoFiles) writeFile(gridFile *mgo.GridFile) (err error) {
 		log.Logf(log.DebugLow, "created local file '%v'", localFileName)
 	}
 
-	if _, err = io.Copy(localFile, gridFile); err != nil {
+	start, end, err := downloadRange(gridFile.Size(), mf.StorageOptions.Offset, mf.StorageOptions.Length, written)
+	if err != nil {
+		return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
+	}
+	if start > 0 {
+		if _, err = gridFile.Seek(start, os.SEEK_SET); err != nil {
+			return fmt.Errorf("error seeking to byte %v of GridFS file '%v': %v\n", start, gridFile.Name(), err)
+		}
+	}
+
+	// GridFile reads one chunk at a time, and CopyN only holds a small buffer
+	// of it, so streaming a large range doesn't need much memory
+	if _, err = io.CopyN(localFile, gridFile, end-start); err != nil {
 		return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
 	}
 	return nil
@@ -225,7 +405,11 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 		output = fmt.Sprintf("removed all instances of '%v' from GridFS\n", mf.FileName)
 	}
 
-	var err error
+	metadata, err := mf.getMetadata()
+	if err != nil {
+		return "", err
+	}
+
 	var localFile io.ReadCloser
 
 	if localFileName == "-" {
@@ -239,23 +423,11 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS) (string, error) {
 		log.Logf(log.DebugLow, "creating GridFS file '%v' from local file '%v'", mf.FileName, localFileName)
 	}
 
-	gFile, err := gfs.Create(mf.FileName)
-	if err != nil {
-		return "", fmt.Errorf("error while creating '%v' in GridFS: %v\n", mf.FileName, err)
-	}
-	defer gFile.Close()
-
-	// set optional mime type
-	if mf.StorageOptions.ContentType != "" {
-		gFile.SetContentType(mf.StorageOptions.ContentType)
-	}
-
-	_, err = io.Copy(gFile, localFile)
-	if err != nil {
+	if _, err = mf.storeFile(gfs, mf.FileName, localFile, metadata); err != nil {
 		return "", fmt.Errorf("error while storing '%v' into GridFS: %v\n", localFileName, err)
 	}
 
-	output += fmt.Sprintf("added file: %v\n", gFile.Name())
+	output += fmt.Sprintf("added file: %v\n", mf.FileName)
 	return output, nil
 }
 
@@ -308,7 +480,7 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 		return "", err
 	}
 	// get GridFS handle
-	gfs := session.DB(mf.StorageOptions.DB).GridFS(mf.StorageOptions.GridFSPrefix)
+	gfs := mf.gridFS(session)
 
 	var output string
 
@@ -339,6 +511,35 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
+	case Find:
+
+		output, err = mf.handleFind(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Fsck:
+
+		// the report is returned even when the bucket has errors
+		output, err = mf.handleFsck(session)
+		if err != nil {
+			return output, err
+		}
+
+	case Copy:
+
+		output, err = mf.handleCopy(session)
+		if err != nil {
+			return "", err
+		}
+
+	case Prune:
+
+		output, err = mf.handlePrune(gfs)
+		if err != nil {
+			return "", err
+		}
+
 	case Get:
 
 		output, err = mf.handleGet(gfs)
@@ -375,6 +576,27 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
+	case PutDir:
+
+		output, err = mf.handlePutDir(session)
+		if err != nil {
+			return "", err
+		}
+
+	case GetDir:
+
+		output, err = mf.handleGetDir(session)
+		if err != nil {
+			return "", err
+		}
+
+	case Sync:
+
+		output, err = mf.handleSync(session)
+		if err != nil {
+			return "", err
+		}
+
 	}
 
 	return output, nil
@@ -13,6 +13,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -533,3 +534,124 @@ func TestMongoFilesCommands(t *testing.T) {
 	})
 
 }
+
+// Test that the byte range written by get honors --offset, --length and
+// the bytes already written by an interrupted download
+func TestDownloadRange(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a 100 byte GridFS file", t, func() {
+		Convey("the whole file is written by default", func() {
+			start, end, err := downloadRange(100, 0, 0, 0)
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 0)
+			So(end, ShouldEqual, 100)
+		})
+
+		Convey("--offset and --length select a range", func() {
+			start, end, err := downloadRange(100, 10, 20, 0)
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 10)
+			So(end, ShouldEqual, 30)
+
+			start, end, err = downloadRange(100, 90, 20, 0)
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 90)
+			So(end, ShouldEqual, 100)
+
+			_, _, err = downloadRange(100, 101, 0, 0)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a resumed download starts after the bytes already written", func() {
+			start, end, err := downloadRange(100, 10, 20, 5)
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, 15)
+			So(end, ShouldEqual, 30)
+
+			start, end, err = downloadRange(100, 0, 0, 100)
+			So(err, ShouldBeNil)
+			So(start, ShouldEqual, end)
+
+			_, _, err = downloadRange(100, 0, 0, 101)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// Test that the range options are only accepted where they make sense
+func TestValidateRangeOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"get", "file"})
+		So(err, ShouldBeNil)
+
+		Convey("range options are accepted with get and get_id", func() {
+			mf.StorageOptions.Offset = 10
+			mf.StorageOptions.Resume = true
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{GetID, "1"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{Put, "file"}), ShouldNotBeNil)
+		})
+
+		Convey("negative values are rejected", func() {
+			mf.StorageOptions.Length = -1
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldNotBeNil)
+		})
+
+		Convey("--resume can not write to stdout", func() {
+			mf.StorageOptions.Resume = true
+			mf.StorageOptions.LocalFileName = "-"
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldNotBeNil)
+		})
+	})
+}
+
+// Test that get can write part of a file and resume an interrupted download
+func TestGetRange(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a GridFS file of several chunks", t, func() {
+		contents, err := ioutil.ReadFile(filepath.Join("testdata", "lorem_ipsum_287613_bytes.txt"))
+		So(err, ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstance([]string{Put, "lorem_ipsum"})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = filepath.Join("testdata", "lorem_ipsum_287613_bytes.txt")
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "mongofiles_range")
+		So(err, ShouldBeNil)
+		mf.Command = Get
+		mf.StorageOptions.LocalFileName = filepath.Join(dir, "lorem_ipsum")
+
+		Convey("--offset and --length write a range spanning chunks", func() {
+			mf.StorageOptions.Offset = 255*1024 - 10
+			mf.StorageOptions.Length = 20
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			written, err := ioutil.ReadFile(mf.StorageOptions.LocalFileName)
+			So(err, ShouldBeNil)
+			So(string(written), ShouldEqual, string(contents[255*1024-10:255*1024+10]))
+		})
+
+		Convey("--resume appends the rest of a partial file", func() {
+			So(ioutil.WriteFile(mf.StorageOptions.LocalFileName, contents[:1000], 0644), ShouldBeNil)
+			mf.StorageOptions.Resume = true
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			written, err := ioutil.ReadFile(mf.StorageOptions.LocalFileName)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(written, contents), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
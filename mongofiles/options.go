@@ -12,6 +12,13 @@ Possible commands include:
 	get_id    - get a file with the given '_id'
 	delete    - delete all files with filename 'filename'
 	delete_id - delete a file with the given '_id'
+	put_dir   - add every file below the local directory 'filename', named by their relative paths
+	get_dir   - get every file whose name begins with 'filename' into the --local directory
+	find      - list files matching the --filter query on any field of the files collection
+	fsck      - check that every file has all of its chunks and a matching MD5, and look for orphan chunks
+	copy      - copy all files, or files whose names begin with 'filename', to the bucket given by --to, --toDB and --toPrefix
+	prune     - remove old versions of all files, or of files named 'filename', selected by --keep and --olderThan
+	sync      - upload files below the local directory 'filename' that are new or differ in size or MD5
 
 See http://docs.mongodb.org/manual/reference/program/mongofiles/ for more information.`
 
@@ -20,15 +27,78 @@ type StorageOptions struct {
 	// Specified database to use. defaults to 'test' if none is specified
 	DB string `short:"d" default:"test" default-mask:"-" long:"db" description:"database to use (default is 'test')"`
 
-	// 'LocalFileName' is an option that specifies what filename to use for (put|get)
-	LocalFileName string `long:"local" short:"l" description:"local filename for put|get"`
+	// 'LocalFileName' is an option that specifies what filename to use for (put|get),
+	// or the directory to write to for get_dir
+	LocalFileName string `long:"local" short:"l" description:"local filename for put|get, or local directory for get_dir (defaults to the current directory)"`
 
 	// 'ContentType' is an option that specifies the Content/MIME type to use for 'put'
 	ContentType string `long:"type" short:"t" description:"content/MIME type for put (optional)"`
 
+	// 'Metadata' is an extended JSON document stored as the metadata of files added with put
+	Metadata string `long:"metadata" description:"metadata document to store with files added by put|put_dir|sync, as a JSON string, e.g. '{owner: \"web\"}'"`
+
+	// 'Aliases' are stored as the aliases of files added with put
+	Aliases []string `long:"alias" description:"alias to store with files added by put|put_dir|sync; may be given more than once"`
+
+	// 'Filter' is the query that 'find' and 'copy' run against the files collection
+	Filter string `long:"filter" description:"query filter for find|copy, as a JSON string, e.g. '{\"metadata.owner\": \"web\"}'"`
+
+	// if set, 'find' prints whole file documents as extended JSON instead of a table
+	JSONOutput bool `long:"json" description:"print the results of find as extended JSON documents, one per line, instead of a table"`
+
+	// if set, 'Repair' makes fsck fix the problems it finds
+	Repair bool `long:"repair" description:"for fsck, remove orphan chunks and move broken files to the '<prefix>.quarantine' GridFS prefix"`
+
+	// 'OrphanAge' is how old orphan chunks must be for fsck --repair to remove them
+	OrphanAge string `long:"orphanAge" description:"for fsck --repair, only remove orphan chunks written longer ago than this, e.g. 30m or 2d, since uploads in progress write their chunks before the file (defaults to 1h)"`
+
 	// if set, 'Replace' will remove other files with same name after 'put'
 	Replace bool `long:"replace" short:"r" description:"remove other files with same name after put"`
 
+	// 'Offset' and 'Length' select the range of bytes that get writes
+	Offset int64 `long:"offset" description:"for get|get_id, byte of the file to start writing from"`
+	Length int64 `long:"length" description:"for get|get_id, number of bytes to write (defaults to the rest of the file)"`
+
+	// if set, 'Resume' makes get append to a partially downloaded local file
+	Resume bool `long:"resume" description:"for get|get_id, continue an interrupted download by appending to the local file"`
+
+	// 'ChunkSize' is the size of the chunks files are split into by put, in KB
+	ChunkSize int `long:"chunkSize" description:"for put|put_dir|sync, size of GridFS chunks in KB (255 by default)"`
+
+	// 'NumChunkWorkers' is the number of chunks of a file that put writes at once
+	NumChunkWorkers int `long:"numChunkWorkers" default:"1" default-mask:"-" description:"for put|put_dir|sync, number of chunks of each file to write in parallel (1 by default)"`
+
+	// if set, 'Versions' makes list and search number the versions of each file
+	Versions bool `long:"versions" description:"for list|search, show the version number and upload date of each file with the same name"`
+
+	// 'FileVersion' and 'At' select the version of a file that get writes
+	FileVersion string `long:"fileVersion" description:"for get, version of the file to get: 0 is the oldest, 1 the next, and -1 the newest (the default), -2 the one before"`
+	At          string `long:"at" description:"for get, get the newest version uploaded no later than this date, e.g. 2006-01-02T15:04:05Z"`
+
+	// 'Keep' and 'OlderThan' select the versions of a file that prune removes
+	Keep      int    `long:"keep" description:"for prune, number of the newest versions of each file to keep"`
+	OlderThan string `long:"olderThan" description:"for prune, only remove versions uploaded longer ago than this, e.g. 30d or 12h; the newest version is always kept"`
+
+	// 'To', 'ToDB' and 'ToPrefix' name the GridFS bucket that copy writes to;
+	// each defaults to the source's
+	To       string `long:"to" description:"for copy, host to copy files to (setname/host1,host2 for replica sets), with the same credentials as the source unless --toUsername is given"`
+	ToDB     string `long:"toDB" description:"for copy, database to copy files to (defaults to --db)"`
+	ToPrefix string `long:"toPrefix" description:"for copy, GridFS prefix to copy files to (defaults to --prefix)"`
+
+	// 'ToUsername', 'ToPassword' and 'ToAuthSource' are the credentials for the --to host
+	ToUsername   string `long:"toUsername" description:"for copy, username for authentication to the --to host"`
+	ToPassword   string `long:"toPassword" description:"for copy, password for authentication to the --to host"`
+	ToAuthSource string `long:"toAuthenticationDatabase" description:"for copy, database that holds the --toUsername user's credentials"`
+
+	// 'RemoteDir' is the GridFS filename prefix that put_dir and sync store relative paths under
+	RemoteDir string `long:"remoteDir" description:"for put_dir|sync, GridFS directory to store files under, e.g. 'assets' names local file 'a/b.png' 'assets/a/b.png'"`
+
+	// 'NumParallel' is the number of files put_dir, get_dir and sync transfer at once
+	NumParallel int `long:"numParallel" short:"j" default:"4" default-mask:"-" description:"number of files to transfer in parallel for put_dir|get_dir|sync (4 by default)"`
+
+	// if set, 'Delete' makes sync remove GridFS files that are missing locally
+	Delete bool `long:"delete" description:"for sync, remove GridFS files under --remoteDir that don't exist in the local directory"`
+
 	// GridFSPrefix specifies what GridFS prefix to use; defaults to 'fs'
 	GridFSPrefix string `long:"prefix" default:"fs" default-mask:"-" description:"GridFS prefix to use (default is 'fs')"`
 
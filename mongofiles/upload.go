@@ -0,0 +1,162 @@
+package mongofiles
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxChunkSizeKB is the largest --chunkSize accepted, leaving room below the
+// 16MB document limit for the rest of the chunk document.
+const MaxChunkSizeKB = 15 * 1024
+
+// gfsFileDoc is the document written to the files collection of a GridFS
+// bucket by the parallel uploader. Its layout matches the one mgo writes.
+type gfsFileDoc struct {
+	Id          interface{} `bson:"_id"`
+	ChunkSize   int         `bson:"chunkSize"`
+	UploadDate  time.Time   `bson:"uploadDate"`
+	Length      int64       `bson:"length,minsize"`
+	MD5         string      `bson:"md5"`
+	Filename    string      `bson:"filename,omitempty"`
+	ContentType string      `bson:"contentType,omitempty"`
+	Aliases     []string    `bson:"aliases,omitempty"`
+	Metadata    interface{} `bson:"metadata,omitempty"`
+}
+
+// storeFile writes everything read from reader to a new GridFS file with the
+// given name, along with the content type, metadata and aliases from the
+// options, and returns the _id of the new file. With --numChunkWorkers above
+// 1, several chunks are written at once.
+func (mf *MongoFiles) storeFile(gfs *mgo.GridFS, name string, reader io.Reader, metadata bson.D) (interface{}, error) {
+	if mf.StorageOptions.NumChunkWorkers > 1 {
+		return mf.storeFileParallel(gfs, name, reader, metadata)
+	}
+
+	gFile, err := gfs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if mf.StorageOptions.ChunkSize > 0 {
+		gFile.SetChunkSize(mf.StorageOptions.ChunkSize * 1024)
+	}
+	mf.setFileAttributes(gFile, metadata)
+	if _, err = io.Copy(gFile, reader); err != nil {
+		gFile.Abort()
+		gFile.Close()
+		return nil, err
+	}
+	if err = gFile.Close(); err != nil {
+		return nil, err
+	}
+	if err = mf.setAliases(gfs, gFile.Id()); err != nil {
+		return nil, err
+	}
+	return gFile.Id(), nil
+}
+
+// storeFileParallel is like storeFile, but writes chunks from a pool of
+// --numChunkWorkers goroutines, each with its own connection. The files
+// document is only written once every chunk has been, so readers never see a
+// partial file; if anything fails, the chunks written so far are removed.
+func (mf *MongoFiles) storeFileParallel(gfs *mgo.GridFS, name string, reader io.Reader, metadata bson.D) (interface{}, error) {
+	chunkSize := mf.StorageOptions.ChunkSize * 1024
+	if chunkSize <= 0 {
+		chunkSize = 255 * 1024
+	}
+	file := gfsFileDoc{
+		Id:          bson.NewObjectId(),
+		ChunkSize:   chunkSize,
+		Filename:    name,
+		ContentType: mf.StorageOptions.ContentType,
+		Aliases:     mf.StorageOptions.Aliases,
+	}
+	if metadata != nil {
+		file.Metadata = metadata
+	}
+
+	length, sum, err := uploadChunks(gfs, file.Id, reader, chunkSize, mf.StorageOptions.NumChunkWorkers)
+	if err == nil {
+		file.Length, file.MD5, file.UploadDate = length, sum, bson.Now()
+		err = gfs.Files.Insert(file)
+	}
+	if err != nil {
+		gfs.Chunks.RemoveAll(bson.M{"files_id": file.Id})
+		return nil, err
+	}
+	gfs.Chunks.EnsureIndexKey("files_id", "n")
+	log.Logf(log.DebugLow, "wrote %v bytes to GridFS file '%v' in %v byte chunks", length, name, chunkSize)
+	return file.Id, nil
+}
+
+// uploadChunks splits the data read from reader into chunks of chunkSize
+// bytes and inserts them for the file with the given _id from numWorkers
+// goroutines. The MD5 is computed as the data is read, since the chunks may
+// be written in any order. It returns the length and MD5 of the data.
+func uploadChunks(gfs *mgo.GridFS, id interface{}, reader io.Reader, chunkSize, numWorkers int) (int64, string, error) {
+	chunks := make(chan gfsChunk, numWorkers)
+	errs := make(chan error, numWorkers)
+	failed := make(chan struct{})
+	var failOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := gfs.Chunks.Database.Session.Copy()
+			defer session.Close()
+			collection := gfs.Chunks.With(session)
+			for chunk := range chunks {
+				if err := collection.Insert(chunk); err != nil {
+					errs <- fmt.Errorf("error writing chunk %v: %v", chunk.N, err)
+					failOnce.Do(func() { close(failed) })
+					return
+				}
+			}
+		}()
+	}
+
+	// at most a chunk per worker is waiting in the channel, so memory use is
+	// bounded by the number of workers rather than the size of the file
+	var length int64
+	hash := md5.New()
+	var readErr error
+read:
+	for n := 0; ; n++ {
+		data := make([]byte, chunkSize)
+		size, err := io.ReadFull(reader, data)
+		if size > 0 {
+			hash.Write(data[:size])
+			length += int64(size)
+			chunk := gfsChunk{Id: bson.NewObjectId(), FilesId: id, N: n, Data: data[:size]}
+			select {
+			case chunks <- chunk:
+			case <-failed:
+				break read
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return 0, "", err
+	}
+	if readErr != nil {
+		return 0, "", readErr
+	}
+	return length, hex.EncodeToString(hash.Sum(nil)), nil
+}
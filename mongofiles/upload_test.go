@@ -0,0 +1,95 @@
+package mongofiles
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateUploadOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"put", "file"})
+		So(err, ShouldBeNil)
+
+		Convey("--chunkSize must fit in a chunk document", func() {
+			mf.StorageOptions.ChunkSize = 1024
+			So(mf.ValidateCommand([]string{Put, "file"}), ShouldBeNil)
+			mf.StorageOptions.ChunkSize = MaxChunkSizeKB + 1
+			So(mf.ValidateCommand([]string{Put, "file"}), ShouldNotBeNil)
+			mf.StorageOptions.ChunkSize = -1
+			So(mf.ValidateCommand([]string{Put, "file"}), ShouldNotBeNil)
+		})
+
+		Convey("--numChunkWorkers can not be negative", func() {
+			mf.StorageOptions.NumChunkWorkers = -1
+			So(mf.ValidateCommand([]string{Put, "file"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParallelPut(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With a file put in small chunks from several workers", t, func() {
+		localFileName := filepath.Join("testdata", "lorem_ipsum_287613_bytes.txt")
+		contents, err := ioutil.ReadFile(localFileName)
+		So(err, ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstance([]string{Put, "lorem_ipsum"})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = localFileName
+		mf.StorageOptions.ChunkSize = 16
+		mf.StorageOptions.NumChunkWorkers = 4
+		mf.StorageOptions.Aliases = []string{"lorem"}
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		Convey("the files document describes the chunks that were written", func() {
+			sessionProvider, err := db.NewSessionProvider(*toolOptions)
+			So(err, ShouldBeNil)
+			session, err := sessionProvider.GetSession()
+			So(err, ShouldBeNil)
+			defer session.Close()
+
+			var file GFSFile
+			So(session.DB(testDB).GridFS("fs").Find(nil).One(&file), ShouldBeNil)
+			sum := md5.Sum(contents)
+			So(file.Md5, ShouldEqual, hex.EncodeToString(sum[:]))
+			So(file.Length, ShouldEqual, len(contents))
+			So(file.ChunkSize, ShouldEqual, 16*1024)
+			So(file.Aliases, ShouldResemble, []string{"lorem"})
+
+			chunks, err := session.DB(testDB).GridFS("fs").Chunks.Find(nil).Count()
+			So(err, ShouldBeNil)
+			So(chunks, ShouldEqual, expectedChunks(fsckFile{Length: file.Length, ChunkSize: file.ChunkSize}))
+		})
+
+		Convey("the file reads back unchanged", func() {
+			dir, err := ioutil.TempDir("", "mongofiles_upload")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			mf.Command = Get
+			mf.StorageOptions.LocalFileName = filepath.Join(dir, "lorem_ipsum")
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			written, err := ioutil.ReadFile(mf.StorageOptions.LocalFileName)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(written, contents), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
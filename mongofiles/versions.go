@@ -0,0 +1,212 @@
+package mongofiles
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files with the same name are treated as versions of one file, ordered by
+// uploadDate. As in the GridFS spec, version 0 is the oldest, 1 the next,
+// and negative numbers count back from the newest, which is version -1.
+
+// parseVersion parses the --fileVersion option.
+func parseVersion(version string) (int, error) {
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, fmt.Errorf("--fileVersion must be an integer, e.g. 0 for the oldest or -1 for the newest")
+	}
+	return n, nil
+}
+
+// parseAt parses the --at option as one of the ISO-8601 formats accepted by
+// the tools, or as a date alone.
+func parseAt(at string) (time.Time, error) {
+	if date, err := util.FormatDate(at); err == nil {
+		return date.(time.Time), nil
+	}
+	date, err := time.Parse("2006-01-02", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--at must be a date, e.g. 2006-01-02 or 2006-01-02T15:04:05Z")
+	}
+	return date, nil
+}
+
+// parseAge parses an age option such as --olderThan: a Go duration like
+// "36h", or a number of days like "30d".
+func parseAge(option, age string) (time.Duration, error) {
+	if strings.HasSuffix(age, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+		if err == nil && days >= 0 {
+			return time.Duration(days) * 24 * time.Hour, nil
+		}
+	} else if duration, err := time.ParseDuration(age); err == nil && duration >= 0 {
+		return duration, nil
+	}
+	return 0, fmt.Errorf("--%v must be a duration, e.g. 30d or 12h", option)
+}
+
+// fileVersions returns every version of the named file, oldest first.
+func fileVersions(gfs *mgo.GridFS, name string) ([]GFSFile, error) {
+	var versions []GFSFile
+	if err := gfs.Find(bson.M{"filename": name}).Sort("uploadDate", "_id").All(&versions); err != nil {
+		return nil, fmt.Errorf("error retrieving versions of GridFS file '%v': %v", name, err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no GridFS file named '%v'", name)
+	}
+	return versions, nil
+}
+
+// selectVersion picks a version from the oldest-first list of versions:
+// the newest one uploaded no later than at, if at is set, and otherwise the
+// one with the given version number.
+func selectVersion(versions []GFSFile, version int, at time.Time) (GFSFile, error) {
+	if !at.IsZero() {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if !versions[i].UploadDate.After(at) {
+				return versions[i], nil
+			}
+		}
+		return GFSFile{}, fmt.Errorf("no version of '%v' was uploaded by %v",
+			versions[0].Name, at.Format(time.RFC3339))
+	}
+	i := version
+	if version < 0 {
+		i = len(versions) + version
+	}
+	if i < 0 || i >= len(versions) {
+		return GFSFile{}, fmt.Errorf("'%v' has no version %v; it has %v version(s)",
+			versions[0].Name, version, len(versions))
+	}
+	return versions[i], nil
+}
+
+// openVersion opens the version of the named file selected by --fileVersion or
+// --at, or the newest one if neither is set.
+func (mf *MongoFiles) openVersion(gfs *mgo.GridFS, name string) (*mgo.GridFile, error) {
+	if mf.StorageOptions.FileVersion == "" && mf.StorageOptions.At == "" {
+		return gfs.Open(name)
+	}
+
+	version := -1
+	var at time.Time
+	var err error
+	if mf.StorageOptions.FileVersion != "" {
+		if version, err = parseVersion(mf.StorageOptions.FileVersion); err != nil {
+			return nil, err
+		}
+	} else if at, err = parseAt(mf.StorageOptions.At); err != nil {
+		return nil, err
+	}
+
+	versions, err := fileVersions(gfs, name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := selectVersion(versions, version, at)
+	if err != nil {
+		return nil, err
+	}
+	log.Logf(log.Info, "found version of '%v' uploaded at %v", name, file.UploadDate.Format(time.RFC3339))
+	return gfs.OpenId(file.Id)
+}
+
+// findAndDisplayVersions is like findAndDisplay, but numbers the versions of
+// each file and shows when each was uploaded.
+func (mf *MongoFiles) findAndDisplayVersions(gfs *mgo.GridFS, query bson.M) (string, error) {
+	display := ""
+
+	cursor := gfs.Find(query).Sort("filename", "uploadDate", "_id").Iter()
+	defer cursor.Close()
+
+	var file GFSFile
+	version := 0
+	lastName := ""
+	for i := 0; cursor.Next(&file); i++ {
+		if i == 0 || file.Name != lastName {
+			version = 0
+			lastName = file.Name
+		}
+		display += fmt.Sprintf("%s\t%d\t%d\t%s\n", file.Name, file.Length, version,
+			file.UploadDate.UTC().Format(time.RFC3339))
+		version++
+	}
+	if err := cursor.Err(); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	return display, nil
+}
+
+// pruneVersions returns the versions of a file, given newest first, that
+// should be removed: those beyond the newest keep, if keep is set, that were
+// uploaded before cutoff, if cutoff is set. The newest version is never
+// removed.
+func pruneVersions(versions []GFSFile, keep int, cutoff time.Time) []GFSFile {
+	if keep < 1 {
+		keep = 1
+	}
+	var prune []GFSFile
+	for i := keep; i < len(versions); i++ {
+		if cutoff.IsZero() || versions[i].UploadDate.Before(cutoff) {
+			prune = append(prune, versions[i])
+		}
+	}
+	return prune
+}
+
+// handle logic for 'prune' command
+func (mf *MongoFiles) handlePrune(gfs *mgo.GridFS) (string, error) {
+	var cutoff time.Time
+	if mf.StorageOptions.OlderThan != "" {
+		age, err := parseAge("olderThan", mf.StorageOptions.OlderThan)
+		if err != nil {
+			return "", err
+		}
+		cutoff = time.Now().Add(-age)
+	}
+
+	query := bson.M{}
+	if mf.FileName != "" {
+		query["filename"] = mf.FileName
+	}
+	cursor := gfs.Find(query).Sort("filename", "-uploadDate", "-_id").Iter()
+	defer cursor.Close()
+
+	// versions are grouped by name, newest first
+	var prune, versions []GFSFile
+	pruned := 0
+	pruneFile := func() {
+		if old := pruneVersions(versions, mf.StorageOptions.Keep, cutoff); len(old) > 0 {
+			prune = append(prune, old...)
+			pruned++
+		}
+		versions = nil
+	}
+	var file GFSFile
+	for cursor.Next(&file) {
+		if len(versions) > 0 && file.Name != versions[0].Name {
+			pruneFile()
+		}
+		versions = append(versions, file)
+	}
+	if err := cursor.Err(); err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	pruneFile()
+
+	for _, old := range prune {
+		if err := gfs.RemoveId(old.Id); err != nil {
+			return "", fmt.Errorf("error while removing version of '%v' uploaded at %v: %v",
+				old.Name, old.UploadDate.Format(time.RFC3339), err)
+		}
+		log.Logf(log.Info, "removed version of '%v' uploaded at %v", old.Name, old.UploadDate.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("removed %v old version(s) of %v file(s)\n", len(prune), pruned), nil
+}
@@ -0,0 +1,211 @@
+package mongofiles
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseVersionOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When parsing the version options", t, func() {
+		Convey("--olderThan accepts days and Go durations", func() {
+			age, err := parseAge("olderThan", "30d")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 30*24*time.Hour)
+			age, err = parseAge("olderThan", "90m")
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, 90*time.Minute)
+			for _, bad := range []string{"", "d", "-1d", "-5h", "soon"} {
+				_, err = parseAge("olderThan", bad)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("--at accepts dates with or without a time", func() {
+			at, err := parseAt("2015-06-01")
+			So(err, ShouldBeNil)
+			So(at, ShouldResemble, time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC))
+			at, err = parseAt("2015-06-01T10:30:00Z")
+			So(err, ShouldBeNil)
+			So(at.Hour(), ShouldEqual, 10)
+			_, err = parseAt("June")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSelectVersion(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With three versions of a file", t, func() {
+		day := func(d int) time.Time { return time.Date(2015, 6, d, 0, 0, 0, 0, time.UTC) }
+		versions := []GFSFile{
+			{Name: "f", Length: 1, UploadDate: day(1)},
+			{Name: "f", Length: 2, UploadDate: day(2)},
+			{Name: "f", Length: 3, UploadDate: day(3)},
+		}
+
+		Convey("versions count up from the oldest and down from the newest", func() {
+			for version, length := range map[int]int64{0: 1, 2: 3, -1: 3, -3: 1} {
+				file, err := selectVersion(versions, version, time.Time{})
+				So(err, ShouldBeNil)
+				So(file.Length, ShouldEqual, length)
+			}
+			_, err := selectVersion(versions, 3, time.Time{})
+			So(err, ShouldNotBeNil)
+			_, err = selectVersion(versions, -4, time.Time{})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--at picks the newest version uploaded by then", func() {
+			file, err := selectVersion(versions, -1, day(2).Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 2)
+			file, err = selectVersion(versions, -1, day(2))
+			So(err, ShouldBeNil)
+			So(file.Length, ShouldEqual, 2)
+			_, err = selectVersion(versions, -1, day(0))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPruneVersions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With four versions of a file, newest first", t, func() {
+		now := time.Now()
+		versions := []GFSFile{
+			{Length: 4, UploadDate: now.Add(-1 * time.Hour)},
+			{Length: 3, UploadDate: now.Add(-2 * time.Hour)},
+			{Length: 2, UploadDate: now.Add(-3 * time.Hour)},
+			{Length: 1, UploadDate: now.Add(-4 * time.Hour)},
+		}
+		lengths := func(files []GFSFile) []int64 {
+			var result []int64
+			for _, file := range files {
+				result = append(result, file.Length)
+			}
+			return result
+		}
+
+		Convey("--keep removes all but the newest versions", func() {
+			So(lengths(pruneVersions(versions, 2, time.Time{})), ShouldResemble, []int64{2, 1})
+			So(pruneVersions(versions, 4, time.Time{}), ShouldBeEmpty)
+		})
+
+		Convey("--olderThan removes old versions, but never the newest", func() {
+			So(lengths(pruneVersions(versions, 0, now.Add(-150*time.Minute))), ShouldResemble, []int64{2, 1})
+			So(lengths(pruneVersions(versions, 0, now)), ShouldResemble, []int64{3, 2, 1})
+		})
+
+		Convey("both options must agree for a version to be removed", func() {
+			So(lengths(pruneVersions(versions, 3, now.Add(-150*time.Minute))), ShouldResemble, []int64{1})
+		})
+	})
+}
+
+func TestValidateVersionOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstance([]string{"get", "file"})
+		So(err, ShouldBeNil)
+
+		Convey("--fileVersion and --at are only accepted with get, one at a time", func() {
+			mf.StorageOptions.FileVersion = "-2"
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{GetID, "1"}), ShouldNotBeNil)
+			mf.StorageOptions.At = "2015-06-01"
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldNotBeNil)
+			mf.StorageOptions.FileVersion = "latest"
+			mf.StorageOptions.At = ""
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldNotBeNil)
+		})
+
+		Convey("prune needs --keep or --olderThan", func() {
+			So(mf.ValidateCommand([]string{Prune}), ShouldNotBeNil)
+			mf.StorageOptions.Keep = 2
+			So(mf.ValidateCommand([]string{Prune}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{Prune, "file"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+		})
+
+		Convey("--versions is only accepted with list and search", func() {
+			mf.StorageOptions.Versions = true
+			So(mf.ValidateCommand([]string{List}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{Get, "file"}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestVersionCommands(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.IntegrationTestType)
+
+	Convey("With three versions of a file in GridFS", t, func() {
+		dir, err := ioutil.TempDir("", "mongofiles_versions")
+		So(err, ShouldBeNil)
+		localFileName := filepath.Join(dir, "file")
+
+		mf, err := simpleMongoFilesInstance([]string{Put, "versioned"})
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = localFileName
+		for _, contents := range []string{"one", "two!", "three"} {
+			So(ioutil.WriteFile(localFileName, []byte(contents), 0644), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			// keep the upload dates apart
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		Convey("list --versions numbers them", func() {
+			mf.Command = List
+			mf.StorageOptions.Versions = true
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			lines := cleanAndTokenizeTestOutput(output)
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0], ShouldStartWith, "versioned\t3\t0\t")
+			So(lines[2], ShouldStartWith, "versioned\t5\t2\t")
+		})
+
+		Convey("get --fileVersion writes an older version", func() {
+			mf.Command = Get
+			mf.StorageOptions.FileVersion = "-2"
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			contents, err := ioutil.ReadFile(localFileName)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "two!")
+		})
+
+		Convey("prune --keep removes the oldest versions", func() {
+			mf.Command = Prune
+			mf.FileName = ""
+			mf.StorageOptions.Keep = 1
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "removed 2 old version(s) of 1 file(s)\n")
+
+			mf.Command = Get
+			mf.FileName = "versioned"
+			mf.StorageOptions.FileVersion = "0"
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			contents, err := ioutil.ReadFile(localFileName)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "three")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/dezmodue/mongo-tools/common/bsonutil"
 	"github.com/dezmodue/mongo-tools/common/db"
 	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/transform"
 	"github.com/dezmodue/mongo-tools/common/util"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/tomb.v2"
@@ -33,6 +34,19 @@ type importWorker struct {
 
 	// used to synchronise all worker goroutines
 	tomb *tomb.Tomb
+
+	// processor is applied to each converted document
+	processor documentProcessor
+}
+
+// documentProcessor holds the optional steps that import workers apply to
+// each document once it has been converted
+type documentProcessor struct {
+	// transformer, if set, rewrites each document
+	transformer *transform.Transformer
+
+	// validator, if set, rejects documents that don't match a JSON schema
+	validator *schemaValidator
 }
 
 // an interface for tracking the number of bytes, which is used in mongoimport to feed
@@ -116,7 +130,10 @@ func doSequentialStreaming(workers []*importWorker, readDocs chan Converter, out
 	for {
 		processedDocument, open := <-workers[i].processedDocumentChan
 		if open {
-			outputChan <- processedDocument
+			// nil marks a document rejected by the processor
+			if processedDocument != nil {
+				outputChan <- processedDocument
+			}
 		} else {
 			numDoneWorkers++
 		}
@@ -238,8 +255,9 @@ func setNestedValue(key string, value interface{}, document *bson.D) {
 // streamDocuments concurrently processes data gotten from the inputChan
 // channel in parallel and then sends over the processed data to the outputChan
 // channel - either in sequence or concurrently (depending on the value of
-// ordered) - in which the data was received
-func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan bson.D) (retErr error) {
+// ordered) - in which the data was received. The processor is applied to each
+// document before it is sent on the outputChan channel
+func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, outputChan chan bson.D, processor documentProcessor) (retErr error) {
 	if numDecoders == 0 {
 		numDecoders = 1
 	}
@@ -257,7 +275,8 @@ func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, out
 		iw := &importWorker{
 			unprocessedDataChan:   inChan,
 			processedDocumentChan: outChan,
-			tomb: importTomb,
+			tomb:                  importTomb,
+			processor:             processor,
 		}
 		importWorkers = append(importWorkers, iw)
 		wg.Add(1)
@@ -286,13 +305,18 @@ func streamDocuments(ordered bool, numDecoders int, readDocs chan Converter, out
 }
 
 // tokensToBSON reads in slice of records - along with ordered fields names -
-// and returns a BSON document for the record.
-func tokensToBSON(fields, tokens []string, numProcessed uint64) (bson.D, error) {
+// and returns a BSON document for the record. Tokens equal to nullValue, if
+// it isn't nil, are null.
+func tokensToBSON(fields, tokens []string, numProcessed uint64, nullValue *string) (bson.D, error) {
 	log.Logf(log.DebugHigh, "got line: %v", tokens)
 	var parsedValue interface{}
 	document := bson.D{}
 	for index, token := range tokens {
-		parsedValue = getParsedValue(token)
+		if nullValue != nil && token == *nullValue {
+			parsedValue = nil
+		} else {
+			parsedValue = getParsedValue(token)
+		}
 		if index < len(fields) {
 			if strings.Index(fields[index], ".") != -1 {
 				setNestedValue(fields[index], parsedValue, &document)
@@ -381,9 +405,36 @@ func (iw *importWorker) processDocuments(ordered bool) error {
 			if err != nil {
 				return err
 			}
+			document, err = iw.processor.process(document)
+			if err != nil {
+				return err
+			}
+			// rejected documents are passed on as nil in ordered mode, so
+			// that doSequentialStreaming keeps reading the workers in step
+			if document == nil && !ordered {
+				continue
+			}
 			iw.processedDocumentChan <- document
 		case <-iw.tomb.Dying():
 			return nil
 		}
 	}
 }
+
+// process transforms and validates a converted document. It returns a nil
+// document if the document was rejected.
+func (dp documentProcessor) process(document bson.D) (bson.D, error) {
+	var err error
+	if dp.transformer != nil {
+		if document, err = dp.transformer.Apply(document); err != nil {
+			return nil, fmt.Errorf("error transforming document: %v", err)
+		}
+	}
+	if dp.validator != nil {
+		valid, err := dp.validator.validate(document)
+		if err != nil || !valid {
+			return nil, err
+		}
+	}
+	return document, nil
+}
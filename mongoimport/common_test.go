@@ -6,6 +6,7 @@ import (
 	"github.com/dezmodue/mongo-tools/common/log"
 	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/testutil"
+	"github.com/dezmodue/mongo-tools/common/transform"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/tomb.v2"
@@ -309,7 +310,7 @@ func TestTokensToBSON(t *testing.T) {
 				bson.DocElem{"b", 2},
 				bson.DocElem{"c", "hello"},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, uint64(0))
+			bsonD, err := tokensToBSON(fields, tokens, uint64(0), nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
@@ -324,14 +325,14 @@ func TestTokensToBSON(t *testing.T) {
 				bson.DocElem{"field3", "mongodb"},
 				bson.DocElem{"field4", "user"},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, uint64(0))
+			bsonD, err := tokensToBSON(fields, tokens, uint64(0), nil)
 			So(err, ShouldBeNil)
 			So(bsonD, ShouldResemble, expectedDocument)
 		})
 		Convey("an error should be thrown if duplicate headers are found", func() {
 			fields := []string{"a", "b", "field3"}
 			tokens := []string{"1", "2", "hello", "mongodb", "user"}
-			_, err := tokensToBSON(fields, tokens, uint64(0))
+			_, err := tokensToBSON(fields, tokens, uint64(0), nil)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("fields with nested values should be set appropriately", func() {
@@ -344,7 +345,7 @@ func TestTokensToBSON(t *testing.T) {
 					bson.DocElem{"a", "hello"},
 				}},
 			}
-			bsonD, err := tokensToBSON(fields, tokens, uint64(0))
+			bsonD, err := tokensToBSON(fields, tokens, uint64(0), nil)
 			So(err, ShouldBeNil)
 			So(expectedDocument[0].Name, ShouldResemble, bsonD[0].Name)
 			So(expectedDocument[0].Value, ShouldResemble, bsonD[0].Value)
@@ -429,6 +430,29 @@ func TestProcessDocuments(t *testing.T) {
 			// close will throw a runtime error if outputChannel is already closed
 			close(outputChannel)
 		})
+		Convey("processDocuments should apply the transformer, if any, to converted documents", func() {
+			inputChannel := make(chan Converter, 100)
+			outputChannel := make(chan bson.D, 100)
+			transformer, err := transform.New([]transform.Step{
+				{Op: transform.Rename, Field: "field1", To: "nested.field"},
+				{Op: transform.Drop, Field: "field2"},
+			})
+			So(err, ShouldBeNil)
+			iw := &importWorker{
+				unprocessedDataChan:   inputChannel,
+				processedDocumentChan: outputChannel,
+				tomb:                  &tomb.Tomb{},
+				processor:             documentProcessor{transformer: transformer},
+			}
+			inputChannel <- csvConverters[0]
+			close(inputChannel)
+			So(iw.processDocuments(true), ShouldBeNil)
+			doc1 := <-outputChannel
+			So(doc1, ShouldResemble, bson.D{
+				bson.DocElem{"field3", "c"},
+				bson.DocElem{"nested", bson.D{bson.DocElem{"field", "a"}}},
+			})
+		})
 	})
 }
 
@@ -492,7 +516,7 @@ func TestStreamDocuments(t *testing.T) {
 				inputChannel <- csvConverter
 			}
 			close(inputChannel)
-			So(streamDocuments(true, 3, inputChannel, outputChannel), ShouldBeNil)
+			So(streamDocuments(true, 3, inputChannel, outputChannel, documentProcessor{}), ShouldBeNil)
 
 			// ensure documents are streamed out and processed in the correct manner
 			for _, expectedDocument := range expectedDocuments {
@@ -510,7 +534,7 @@ func TestStreamDocuments(t *testing.T) {
 			close(inputChannel)
 
 			// ensure that an error is returned on the error channel
-			So(streamDocuments(true, 3, inputChannel, outputChannel), ShouldNotBeNil)
+			So(streamDocuments(true, 3, inputChannel, outputChannel, documentProcessor{}), ShouldNotBeNil)
 		})
 	})
 }
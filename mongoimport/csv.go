@@ -2,7 +2,7 @@ package mongoimport
 
 import (
 	"fmt"
-	"github.com/dezmodue/mongo-tools/mongoimport/csv"
+	"github.com/dezmodue/mongo-tools/common/csv"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 )
@@ -25,6 +25,12 @@ type CSVInputReader struct {
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
 
+	// processor is applied to each document after it is decoded
+	processor documentProcessor
+
+	// nullValue, if not nil, is the field value that is imported as null
+	nullValue *string
+
 	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
 	sizeTracker
 }
@@ -33,6 +39,7 @@ type CSVInputReader struct {
 type CSVConverter struct {
 	fields, data []string
 	index        uint64
+	nullValue    *string
 }
 
 // NewCSVInputReader returns a CSVInputReader configured to read data from the
@@ -87,16 +94,17 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				return
 			}
 			csvRecordChan <- CSVConverter{
-				fields: r.fields,
-				data:   r.csvRecord,
-				index:  r.numProcessed,
+				fields:    r.fields,
+				data:      r.csvRecord,
+				index:     r.numProcessed,
+				nullValue: r.nullValue,
 			}
 			r.numProcessed++
 		}
 	}()
 
 	go func() {
-		csvErrChan <- streamDocuments(ordered, r.numDecoders, csvRecordChan, readDocs)
+		csvErrChan <- streamDocuments(ordered, r.numDecoders, csvRecordChan, readDocs, r.processor)
 	}()
 
 	return channelQuorumError(csvErrChan, 2)
@@ -109,5 +117,6 @@ func (c CSVConverter) Convert() (bson.D, error) {
 		c.fields,
 		c.data,
 		c.index,
+		c.nullValue,
 	)
 }
@@ -274,3 +274,52 @@ func TestCSVConvert(t *testing.T) {
 		})
 	})
 }
+
+func TestCSVDialects(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a CSV input reader", t, func() {
+		fields := []string{"a", "b", "c"}
+
+		Convey("a configured delimiter, quote and escape should be used", func() {
+			contents := `1;'x\'s;y';z`
+			r := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			r.csvReader.Comma = ';'
+			r.csvReader.Quote = '\''
+			r.csvReader.Escape = '\\'
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"a", 1},
+				bson.DocElem{"b", "x's;y"},
+				bson.DocElem{"c", "z"},
+			})
+		})
+
+		Convey("empty fields should be kept with a tab delimiter", func() {
+			contents := "1\t\t 3"
+			r := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			r.csvReader.Comma = '\t'
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"a", 1},
+				bson.DocElem{"b", ""},
+				bson.DocElem{"c", 3},
+			})
+		})
+
+		Convey("fields equal to the null value should be null", func() {
+			nullValue := "NULL"
+			contents := `NULL,"NULL",x`
+			r := NewCSVInputReader(fields, bytes.NewReader([]byte(contents)), 1)
+			r.nullValue = &nullValue
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"a", nil},
+				bson.DocElem{"b", nil},
+				bson.DocElem{"c", "x"},
+			})
+		})
+	})
+}
@@ -0,0 +1,177 @@
+package mongoimport
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/log"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// expandInputFiles returns the files named by the given paths, expanding
+// any glob patterns among them. Patterns that match no file are an error.
+func expandInputFiles(patterns []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			var err error
+			matches, err = filepath.Glob(util.ToUniversalPath(pattern))
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern '%v': %v", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match '%v'", pattern)
+			}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// importState records the input files that were imported completely in
+// the --stateFile, one absolute path per line.
+type importState struct {
+	completed map[string]bool
+	file      *os.File
+	lock      sync.Mutex
+}
+
+// openImportState reads the files already recorded in the named state file,
+// creating it if it doesn't exist, and opens it to record more.
+func openImportState(path string) (*importState, error) {
+	file, err := os.OpenFile(util.ToUniversalPath(path), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening state file: %v", err)
+	}
+	state := &importState{completed: map[string]bool{}, file: file}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			state.completed[line] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	return state, nil
+}
+
+// isCompleted returns true if the input file was recorded as imported.
+func (state *importState) isCompleted(fileName string) bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.completed[stateKey(fileName)]
+}
+
+// record records the input file as imported.
+func (state *importState) record(fileName string) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	key := stateKey(fileName)
+	state.completed[key] = true
+	if _, err := fmt.Fprintln(state.file, key); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	return state.file.Sync()
+}
+
+func (state *importState) Close() error {
+	return state.file.Close()
+}
+
+// stateKey returns the name under which an input file is recorded; it's
+// absolute so that reruns from another directory find it.
+func stateKey(fileName string) string {
+	if abs, err := filepath.Abs(fileName); err == nil {
+		return abs
+	}
+	return fileName
+}
+
+// importFiles imports each of the input files, --numParallelFiles at a time,
+// skipping those already recorded in the --stateFile, and reports the
+// number of documents imported from each one. It stops at the first file
+// that fails.
+func (imp *MongoImport) importFiles() error {
+	var state *importState
+	if imp.InputOptions.StateFile != "" {
+		var err error
+		if state, err = openImportState(imp.InputOptions.StateFile); err != nil {
+			return err
+		}
+		defer state.Close()
+	}
+
+	numWorkers := imp.InputOptions.NumParallelFiles
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+	fileChan := make(chan string)
+	errChan := make(chan error, numWorkers)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fileName := range fileChan {
+				if err := imp.importInputFile(fileName, state); err != nil {
+					errChan <- err
+					stopOnce.Do(func() { close(stop) })
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, fileName := range imp.inputFiles {
+		if state != nil && state.isCompleted(fileName) {
+			log.Logf(log.Always, "skipping %v, which was already imported", fileName)
+			continue
+		}
+		select {
+		case fileChan <- fileName:
+		case <-stop:
+			break feed
+		}
+	}
+	close(fileChan)
+	wg.Wait()
+	close(errChan)
+	return <-errChan
+}
+
+// importInputFile imports one of several input files, and records it in
+// the state, if any, once it is imported completely.
+func (imp *MongoImport) importInputFile(fileName string, state *importState) error {
+	log.Logf(log.Info, "importing %v", fileName)
+	numImported, err := imp.importFile(fileName)
+	message := fmt.Sprintf("%v %v document(s) from %v", ModeVerb(imp.IngestOptions.Mode), numImported, fileName)
+	if err != nil {
+		log.Logf(log.Always, "%v before failing", message)
+		return fmt.Errorf("error importing %v: %v", fileName, err)
+	}
+	// the count for a single file is the total, which is reported anyway
+	if len(imp.inputFiles) > 1 {
+		log.Log(log.Always, message)
+	} else {
+		log.Log(log.Info, message)
+	}
+	if state != nil {
+		return state.record(fileName)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package mongoimport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExpandInputFiles(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When expanding input files", t, func() {
+		Convey("plain paths should be kept even if they don't exist", func() {
+			files, err := expandInputFiles([]string{"b.csv", "a.csv"})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{"b.csv", "a.csv"})
+		})
+
+		Convey("files matched more than once should only be imported once", func() {
+			files, err := expandInputFiles([]string{"testdata/test.?sv", "testdata/test.csv"})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{"testdata/test.csv", "testdata/test.tsv"})
+		})
+	})
+}
+
+func TestImportState(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a state file", t, func() {
+		stateFile, err := ioutil.TempFile("", "mongoimport_state")
+		So(err, ShouldBeNil)
+		stateFile.Close()
+
+		state, err := openImportState(stateFile.Name())
+		So(err, ShouldBeNil)
+		So(state.isCompleted("testdata/test.csv"), ShouldBeFalse)
+		So(state.record("testdata/test.csv"), ShouldBeNil)
+		So(state.isCompleted("testdata/test.csv"), ShouldBeTrue)
+		So(state.Close(), ShouldBeNil)
+
+		Convey("recorded files should be completed when it is reopened", func() {
+			state, err := openImportState(stateFile.Name())
+			So(err, ShouldBeNil)
+			So(state.isCompleted("testdata/test.csv"), ShouldBeTrue)
+			So(state.isCompleted("testdata/test.tsv"), ShouldBeFalse)
+			So(state.Close(), ShouldBeNil)
+		})
+
+		Reset(func() {
+			os.Remove(stateFile.Name())
+		})
+	})
+}
@@ -0,0 +1,267 @@
+package mongoimport
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/transform"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Types of fixed-width fields, besides the cast types of transforms.
+const (
+	// fixedWidthAuto values are parsed as numbers where possible, as CSV
+	// and TSV values are
+	fixedWidthAuto = "auto"
+	// fixedWidthDate values are parsed with the field's layout
+	fixedWidthDate = "date"
+)
+
+// Ways of trimming the padding from fixed-width field values.
+const (
+	trimBoth  = "both"
+	trimLeft  = "left"
+	trimRight = "right"
+	trimNone  = "none"
+)
+
+// FixedWidthField describes where a field is found in fixed-width records
+// and how its value is parsed.
+type FixedWidthField struct {
+	// Name is the name of the field, which may use dot notation
+	Name string `json:"name"`
+
+	// Offset is the position in the record of the field's first character,
+	// counting from 0
+	Offset int `json:"offset"`
+
+	// Width is the number of characters in the field
+	Width int `json:"width"`
+
+	// Type is "auto" (the default), "date", or a transform cast type, e.g.
+	// "int" or "string"
+	Type string `json:"type"`
+
+	// Layout is the Go time layout of "date" fields; if empty, ISO-8601
+	// dates are accepted
+	Layout string `json:"layout"`
+
+	// Trim is the padding that is trimmed from the value, either "both"
+	// (the default), "left", "right" or "none"
+	Trim string `json:"trim"`
+}
+
+// FixedWidthInputReader implements the InputReader interface for fixed-width
+// input, in which each line is a record whose fields are found at the
+// offsets given by a spec.
+type FixedWidthInputReader struct {
+	// spec describes the fields of each record
+	spec []FixedWidthField
+
+	// lineReader is the underlying reader used to read the records
+	lineReader *bufio.Reader
+
+	// numLines tracks the number of lines read from the underlying reader
+	numLines uint64
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// processor is applied to each document after it is decoded
+	processor documentProcessor
+
+	// nullValue, if not nil, is the field value that is imported as null
+	nullValue *string
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+}
+
+// FixedWidthConverter implements the Converter interface for fixed-width input.
+type FixedWidthConverter struct {
+	spec      []FixedWidthField
+	data      string
+	line      uint64
+	nullValue *string
+}
+
+// ParseFixedWidthSpec reads a JSON array of fields from the spec file at the
+// given path, and returns an error if any of them is invalid.
+func ParseFixedWidthSpec(path string) ([]FixedWidthField, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec file: %v", err)
+	}
+	var spec []FixedWidthField
+	if err = json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("error parsing spec file '%v': %v", path, err)
+	}
+	if len(spec) == 0 {
+		return nil, fmt.Errorf("spec file '%v' has no fields", path)
+	}
+	names := make([]string, 0, len(spec))
+	for i := range spec {
+		field := &spec[i]
+		if field.Type == "" {
+			field.Type = fixedWidthAuto
+		}
+		if field.Trim == "" {
+			field.Trim = trimBoth
+		}
+		if err = field.validate(); err != nil {
+			return nil, fmt.Errorf("invalid spec field #%v: %v", i+1, err)
+		}
+		names = append(names, field.Name)
+	}
+	if err = validateFields(names); err != nil {
+		return nil, fmt.Errorf("invalid spec file '%v': %v", path, err)
+	}
+	return spec, nil
+}
+
+func (field FixedWidthField) validate() error {
+	if field.Name == "" {
+		return fmt.Errorf("a field requires a name")
+	}
+	if field.Offset < 0 || field.Width <= 0 {
+		return fmt.Errorf("'%v' requires a positive width and an offset of 0 or more", field.Name)
+	}
+	switch field.Type {
+	case fixedWidthAuto, fixedWidthDate, transform.TypeInt, transform.TypeLong, transform.TypeDouble,
+		transform.TypeString, transform.TypeBool, transform.TypeObjectId:
+	default:
+		return fmt.Errorf("unknown type '%v' for '%v'", field.Type, field.Name)
+	}
+	switch field.Trim {
+	case trimBoth, trimLeft, trimRight, trimNone:
+	default:
+		return fmt.Errorf("unknown trim '%v' for '%v', choose '%v', '%v', '%v' or '%v'",
+			field.Trim, field.Name, trimBoth, trimLeft, trimRight, trimNone)
+	}
+	return nil
+}
+
+// NewFixedWidthInputReader returns a FixedWidthInputReader configured to read
+// records described by the spec from the given io.Reader, using exactly
+// "numDecoders" goroutines.
+func NewFixedWidthInputReader(spec []FixedWidthField, in io.Reader, numDecoders int) *FixedWidthInputReader {
+	szCount := &sizeTrackingReader{in, 0}
+	return &FixedWidthInputReader{
+		spec:        spec,
+		lineReader:  bufio.NewReader(szCount),
+		numDecoders: numDecoders,
+		sizeTracker: szCount,
+	}
+}
+
+// ReadAndValidateHeader is a no-op for fixed-width input, whose fields are
+// given by the spec.
+func (r *FixedWidthInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if streaming fails. Blank
+// lines are skipped.
+func (r *FixedWidthInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+	recordChan := make(chan Converter, r.numDecoders)
+	errChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		for {
+			record, err := r.lineReader.ReadString(entryDelimiter)
+			if err != nil && err != io.EOF {
+				close(recordChan)
+				errChan <- fmt.Errorf("read error on line %v: %v", r.numLines+1, err)
+				return
+			}
+			if record != "" {
+				r.numLines++
+			}
+			if record = strings.TrimRight(record, "\r\n"); record != "" {
+				recordChan <- FixedWidthConverter{
+					spec:      r.spec,
+					data:      record,
+					line:      r.numLines,
+					nullValue: r.nullValue,
+				}
+			}
+			if err == io.EOF {
+				close(recordChan)
+				errChan <- nil
+				return
+			}
+		}
+	}()
+
+	// begin processing read bytes
+	go func() {
+		errChan <- streamDocuments(ordered, r.numDecoders, recordChan, readDocs, r.processor)
+	}()
+
+	return channelQuorumError(errChan, 2)
+}
+
+// Convert implements the Converter interface for fixed-width input. It
+// converts a FixedWidthConverter struct to a BSON document. Fields beyond
+// the end of the record are empty; empty values of types other than "auto"
+// and "string", and values equal to the null value, are null.
+func (c FixedWidthConverter) Convert() (bson.D, error) {
+	characters := []rune(c.data)
+	document := bson.D{}
+	for _, field := range c.spec {
+		token := ""
+		if field.Offset < len(characters) {
+			end := field.Offset + field.Width
+			if end > len(characters) {
+				end = len(characters)
+			}
+			token = string(characters[field.Offset:end])
+		}
+		switch field.Trim {
+		case trimBoth:
+			token = strings.TrimSpace(token)
+		case trimLeft:
+			token = strings.TrimLeft(token, " \t")
+		case trimRight:
+			token = strings.TrimRight(token, " \t")
+		}
+
+		var value interface{}
+		if c.nullValue == nil || token != *c.nullValue {
+			var err error
+			if value, err = field.parse(token); err != nil {
+				return nil, fmt.Errorf("line %v: field '%v': %v", c.line, field.Name, err)
+			}
+		}
+		if strings.Index(field.Name, ".") != -1 {
+			setNestedValue(field.Name, value, &document)
+		} else {
+			document = append(document, bson.DocElem{field.Name, value})
+		}
+	}
+	return document, nil
+}
+
+// parse returns the value of the field given by the token.
+func (field FixedWidthField) parse(token string) (interface{}, error) {
+	switch field.Type {
+	case fixedWidthAuto:
+		return getParsedValue(token), nil
+	case transform.TypeString:
+		return token, nil
+	}
+	if strings.TrimSpace(token) == "" {
+		return nil, nil
+	}
+	if field.Type == fixedWidthDate {
+		return transform.ParseDate(strings.TrimSpace(token), field.Layout)
+	}
+	return transform.CastValue(token, field.Type)
+}
@@ -0,0 +1,129 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFixedWidthSpec(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a fixed-width spec file", t, func() {
+		Convey("the fields should be read with their defaults", func() {
+			spec, err := ParseFixedWidthSpec("testdata/test_fixedwidth_spec.json")
+			So(err, ShouldBeNil)
+			So(len(spec), ShouldEqual, 4)
+			So(spec[0], ShouldResemble, FixedWidthField{Name: "id", Offset: 0, Width: 4, Type: "int", Trim: trimBoth})
+			So(spec[2].Type, ShouldEqual, fixedWidthAuto)
+		})
+
+		Convey("invalid fields should be rejected", func() {
+			specs := []string{
+				`[]`,
+				`[{"offset": 0, "width": 1}]`,
+				`[{"name": "a", "offset": 0, "width": 0}]`,
+				`[{"name": "a", "offset": -1, "width": 1}]`,
+				`[{"name": "a", "offset": 0, "width": 1, "type": "decimal"}]`,
+				`[{"name": "a", "offset": 0, "width": 1, "trim": "middle"}]`,
+				`[{"name": "a", "offset": 0, "width": 1}, {"name": "a", "offset": 1, "width": 1}]`,
+			}
+			for _, contents := range specs {
+				file, err := ioutil.TempFile("", "spec")
+				So(err, ShouldBeNil)
+				_, err = file.WriteString(contents)
+				So(err, ShouldBeNil)
+				So(file.Close(), ShouldBeNil)
+				_, err = ParseFixedWidthSpec(file.Name())
+				os.Remove(file.Name())
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("a missing spec file should be an error", func() {
+			_, err := ParseFixedWidthSpec("testdata/missing_spec.json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestFixedWidthStreamDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+	Convey("With a fixed-width input reader", t, func() {
+		spec, err := ParseFixedWidthSpec("testdata/test_fixedwidth_spec.json")
+		So(err, ShouldBeNil)
+
+		Convey("fields should be read from their offsets and parsed", func() {
+			contents := "  12Ada     Lovelace2015-12-10\n\n   7Alan    Turing  \n"
+			r := NewFixedWidthInputReader(spec, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan bson.D, 2)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"id", int32(12)},
+				bson.DocElem{"name", &bson.D{
+					bson.DocElem{"first", "Ada"},
+					bson.DocElem{"last", "Lovelace"},
+				}},
+				bson.DocElem{"joined", time.Date(2015, 12, 10, 0, 0, 0, 0, time.UTC)},
+			})
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"id", int32(7)},
+				bson.DocElem{"name", &bson.D{
+					bson.DocElem{"first", "Alan"},
+					bson.DocElem{"last", "Turing"},
+				}},
+				bson.DocElem{"joined", nil},
+			})
+		})
+
+		Convey("the last line should be read without a trailing newline", func() {
+			contents := "   1Grace   Hopper"
+			r := NewFixedWidthInputReader(spec, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			doc := <-docChan
+			So(doc[0], ShouldResemble, bson.DocElem{"id", int32(1)})
+		})
+
+		Convey("values equal to the null value should be null", func() {
+			contents := "NULLGrace   Hopper\n"
+			r := NewFixedWidthInputReader(spec, bytes.NewReader([]byte(contents)), 1)
+			nullValue := "NULL"
+			r.nullValue = &nullValue
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			doc := <-docChan
+			So(doc[0], ShouldResemble, bson.DocElem{"id", nil})
+		})
+
+		Convey("values that can not be parsed should be an error with the line number", func() {
+			contents := "   1Grace   Hopper\n\n  x2Alan    Turing\n"
+			r := NewFixedWidthInputReader(spec, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan bson.D, 2)
+			err := r.StreamDocument(true, docChan)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "line 3: field 'id':")
+		})
+
+		Convey("trimming should follow the spec", func() {
+			trimSpec := []FixedWidthField{
+				{Name: "a", Offset: 0, Width: 4, Type: "string", Trim: trimLeft},
+				{Name: "b", Offset: 4, Width: 4, Type: "string", Trim: trimRight},
+				{Name: "c", Offset: 8, Width: 4, Type: "string", Trim: trimNone},
+			}
+			contents := "  x y   z  \n"
+			r := NewFixedWidthInputReader(trimSpec, bytes.NewReader([]byte(contents)), 1)
+			docChan := make(chan bson.D, 1)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				bson.DocElem{"a", "x "},
+				bson.DocElem{"b", "y"},
+				bson.DocElem{"c", "z  "},
+			})
+		})
+	})
+}
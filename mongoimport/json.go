@@ -47,12 +47,19 @@ type JSONInputReader struct {
 
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
+
+	// processor is applied to each document after it is decoded
+	processor documentProcessor
+
+	// jsonFormat is the Extended JSON format of the input
+	jsonFormat string
 }
 
 // JSONConverter implements the Converter interface for JSON input.
 type JSONConverter struct {
-	data  []byte
-	index uint64
+	data       []byte
+	index      uint64
+	jsonFormat string
 }
 
 var (
@@ -121,8 +128,9 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				return
 			}
 			rawChan <- JSONConverter{
-				data:  rawBytes,
-				index: r.numProcessed,
+				data:       rawBytes,
+				index:      r.numProcessed,
+				jsonFormat: r.jsonFormat,
 			}
 			r.numProcessed++
 		}
@@ -130,7 +138,7 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 
 	// begin processing read bytes
 	go func() {
-		jsonErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan)
+		jsonErrChan <- streamDocuments(ordered, r.numDecoders, rawChan, readChan, r.processor)
 	}()
 
 	return channelQuorumError(jsonErrChan, 2)
@@ -145,6 +153,12 @@ func (c JSONConverter) Convert() (bson.D, error) {
 	}
 	log.Logf(log.DebugHigh, "got line: %v", document)
 
+	if c.jsonFormat == json.CanonicalFormat || c.jsonFormat == json.RelaxedFormat {
+		if err = bsonutil.CheckExtJSONV2(document); err != nil {
+			return nil, fmt.Errorf("error parsing document #%v: %v", c.index, err)
+		}
+	}
+
 	bsonD, err := bsonutil.GetExtendedBsonD(document)
 	if err != nil {
 		return nil, fmt.Errorf("error getting extended BSON for document #%v: %v", c.index, err)
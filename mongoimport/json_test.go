@@ -2,6 +2,7 @@ package mongoimport
 
 import (
 	"bytes"
+	"github.com/dezmodue/mongo-tools/common/json"
 	"github.com/dezmodue/mongo-tools/common/testutil"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
@@ -235,5 +236,22 @@ func TestJSONConvert(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(document, ShouldResemble, expectedDocument)
 		})
+		Convey("with a canonical format, Extended JSON v2 should be converted", func() {
+			jsonConverter := JSONConverter{
+				data:       []byte(`{"a":{"$numberLong":"5"},"b":{"$numberDouble":"1.5"}}`),
+				jsonFormat: json.CanonicalFormat,
+			}
+			document, err := jsonConverter.Convert()
+			So(err, ShouldBeNil)
+			So(document, ShouldResemble, bson.D{{"a", int64(5)}, {"b", 1.5}})
+		})
+		Convey("with a canonical format, shell syntax should be rejected", func() {
+			jsonConverter := JSONConverter{
+				data:       []byte(`{"a":NumberLong(5)}`),
+				jsonFormat: json.CanonicalFormat,
+			}
+			_, err := jsonConverter.Convert()
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
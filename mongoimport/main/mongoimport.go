@@ -72,9 +72,10 @@ func main() {
 		if err != nil {
 			log.Logf(log.Always, "Failed: %v", err)
 		}
-		message := fmt.Sprintf("imported 1 document")
+		verb := mongoimport.ModeVerb(ingestOpts.Mode)
+		message := fmt.Sprintf("%v 1 document", verb)
 		if numDocs != 1 {
-			message = fmt.Sprintf("imported %v documents", numDocs)
+			message = fmt.Sprintf("%v %v documents", verb, numDocs)
 		}
 		log.Logf(log.Always, message)
 	}
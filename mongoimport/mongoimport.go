@@ -1,13 +1,17 @@
-// Package mongoimport allows importing content from a JSON, CSV, or TSV into a MongoDB instance.
+// Package mongoimport allows importing content from a JSON, CSV, TSV or fixed-width file into a MongoDB instance.
 package mongoimport
 
 import (
 	"fmt"
+	"github.com/dezmodue/mongo-tools/common/csv"
 	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/json"
 	"github.com/dezmodue/mongo-tools/common/log"
 	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/progress"
+	"github.com/dezmodue/mongo-tools/common/schema"
 	"github.com/dezmodue/mongo-tools/common/text"
+	"github.com/dezmodue/mongo-tools/common/transform"
 	"github.com/dezmodue/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -17,13 +21,15 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Input format types accepted by mongoimport.
 const (
-	CSV  = "csv"
-	TSV  = "tsv"
-	JSON = "json"
+	CSV        = "csv"
+	TSV        = "tsv"
+	JSON       = "json"
+	FixedWidth = "fixedwidth"
 )
 
 const (
@@ -63,8 +69,23 @@ type MongoImport struct {
 	// fields to use for upsert operations
 	upsertFields []string
 
+	// processor holds the transformations and validation applied to each
+	// document as it is processed
+	processor documentProcessor
+
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// inputFiles are the files to import, after expanding glob patterns;
+	// if empty, documents are read from stdin
+	inputFiles []string
+
+	// csvDialect holds the characters that delimit, quote and escape the
+	// fields of CSV input
+	csvDialect csv.Dialect
+
+	// fixedWidthSpec describes the fields of fixed-width input
+	fixedWidthSpec []FixedWidthField
 }
 
 type InputReader interface {
@@ -101,7 +122,8 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == FixedWidth) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
@@ -130,6 +152,22 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 				return fmt.Errorf("incompatible options: --fieldFile and --headerline")
 			}
 		}
+	} else if imp.InputOptions.Type == FixedWidth {
+		if imp.InputOptions.Spec == "" {
+			return fmt.Errorf("must specify --spec to import this file type")
+		}
+		if imp.InputOptions.HeaderLine {
+			return fmt.Errorf("can not use --headerline when input type is %v", FixedWidth)
+		}
+		if imp.InputOptions.Fields != nil {
+			return fmt.Errorf("can not use --fields when input type is %v", FixedWidth)
+		}
+		if imp.InputOptions.FieldFile != nil {
+			return fmt.Errorf("can not use --fieldFile when input type is %v", FixedWidth)
+		}
+		if imp.fixedWidthSpec, err = ParseFixedWidthSpec(imp.InputOptions.Spec); err != nil {
+			return err
+		}
 	} else {
 		// input type is JSON
 		if imp.InputOptions.HeaderLine {
@@ -144,6 +182,39 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		if imp.IngestOptions.IgnoreBlanks {
 			return fmt.Errorf("can not use --ignoreBlanks when input type is JSON")
 		}
+		if imp.InputOptions.NullValue != nil {
+			return fmt.Errorf("can not use --nullValue when input type is JSON")
+		}
+	}
+
+	if imp.InputOptions.Type != FixedWidth && imp.InputOptions.Spec != "" {
+		return fmt.Errorf("can not use --spec when input type is %v", imp.InputOptions.Type)
+	}
+
+	imp.csvDialect, err = csv.ParseDialect(imp.InputOptions.Delimiter, imp.InputOptions.Quote, imp.InputOptions.Escape)
+	if err != nil {
+		return err
+	}
+	if imp.InputOptions.Type != CSV && imp.csvDialect != csv.DefaultDialect {
+		return fmt.Errorf("can not use --delimiter, --quote or --escape when input type is %v", imp.InputOptions.Type)
+	}
+
+	if imp.InputOptions.Encoding == "" {
+		imp.InputOptions.Encoding = text.UTF8
+	}
+	if imp.InputOptions.Encoding, err = text.ParseEncoding(imp.InputOptions.Encoding); err != nil {
+		return err
+	}
+
+	imp.InputOptions.JSONFormat = strings.ToLower(imp.InputOptions.JSONFormat)
+	if imp.InputOptions.JSONFormat == "" {
+		imp.InputOptions.JSONFormat = json.LegacyFormat
+	}
+	if err = json.ValidateFormat(imp.InputOptions.JSONFormat); err != nil {
+		return err
+	}
+	if imp.InputOptions.JSONFormat != json.LegacyFormat && imp.InputOptions.Type != JSON {
+		return fmt.Errorf("can not use --jsonFormat when input type is %v", imp.InputOptions.Type)
 	}
 
 	if imp.IngestOptions.UpsertFields != "" {
@@ -156,6 +227,42 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		imp.upsertFields = []string{"_id"}
 	}
 
+	if imp.InputOptions.Transform != "" {
+		imp.processor.transformer, err = transform.NewFromFile(imp.InputOptions.Transform)
+		if err != nil {
+			return err
+		}
+	}
+
+	if imp.IngestOptions.ValidateSchema != "" {
+		if imp.IngestOptions.MaxRejects < 0 {
+			return fmt.Errorf("--maxRejects can not be negative")
+		}
+		documentSchema, err := schema.ParseFile(imp.IngestOptions.ValidateSchema)
+		if err != nil {
+			return err
+		}
+		imp.processor.validator = &schemaValidator{
+			schema:     documentSchema,
+			maxRejects: uint64(imp.IngestOptions.MaxRejects),
+		}
+	} else {
+		if imp.IngestOptions.Rejects != "" {
+			return fmt.Errorf("can not use --rejects without --validateSchema")
+		}
+		if imp.IngestOptions.MaxRejects != 0 {
+			return fmt.Errorf("can not use --maxRejects without --validateSchema")
+		}
+	}
+
+	imp.IngestOptions.Mode = strings.ToLower(imp.IngestOptions.Mode)
+	if imp.IngestOptions.Mode == "" {
+		imp.IngestOptions.Mode = InsertMode
+	}
+	if err = imp.validateMode(); err != nil {
+		return err
+	}
+
 	if imp.IngestOptions.Upsert {
 		imp.IngestOptions.MaintainInsertionOrder = true
 		log.Logf(log.Info, "using upsert fields: %v", imp.upsertFields)
@@ -184,28 +291,37 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 		imp.ToolOptions.BulkBufferSize = 10000
 	}
 
-	// ensure no more than one positional argument is supplied
-	if len(args) > 1 {
-		return fmt.Errorf("only one positional argument is allowed")
-	}
-
-	// ensure either a positional argument is supplied or an argument is passed
+	// ensure either positional arguments are supplied or an argument is passed
 	// to the --file flag - and not both
 	if imp.InputOptions.File != "" && len(args) != 0 {
 		return fmt.Errorf("incompatible options: --file and positional argument(s)")
 	}
 
-	if imp.InputOptions.File == "" {
-		if len(args) != 0 {
-			// if --file is not supplied, use the positional argument supplied
-			imp.InputOptions.File = args[0]
-		}
+	patterns := args
+	if imp.InputOptions.File != "" {
+		patterns = []string{imp.InputOptions.File}
+	}
+	if imp.inputFiles, err = expandInputFiles(patterns); err != nil {
+		return err
+	}
+	if len(imp.inputFiles) != 0 {
+		// --file holds the first file, which names the collection by default
+		imp.InputOptions.File = imp.inputFiles[0]
+	}
+	if len(imp.inputFiles) > 1 && imp.ToolOptions.Collection == "" {
+		return fmt.Errorf("must specify a collection with --collection when importing multiple files")
+	}
+	if imp.InputOptions.NumParallelFiles < 0 {
+		return fmt.Errorf("--numParallelFiles can not be negative")
+	}
+	if imp.InputOptions.StateFile != "" && len(imp.inputFiles) == 0 {
+		return fmt.Errorf("can not use --stateFile when importing from stdin")
 	}
 
 	// ensure we have a valid string to use for the collection
 	if imp.ToolOptions.Collection == "" {
 		log.Logf(log.Always, "no collection specified")
-		fileBaseName := filepath.Base(imp.InputOptions.File)
+		fileBaseName := util.TrimCompressorExtension(filepath.Base(imp.InputOptions.File))
 		lastDotIndex := strings.LastIndex(fileBaseName, ".")
 		if lastDotIndex != -1 {
 			fileBaseName = fileBaseName[0:lastDotIndex]
@@ -220,12 +336,13 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	return nil
 }
 
-// getSourceReader returns an io.Reader to read from the input source. Also
-// returns a progress.Progressor which can be used to track progress if the
-// reader supports it.
-func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
-	if imp.InputOptions.File != "" {
-		file, err := os.Open(util.ToUniversalPath(imp.InputOptions.File))
+// getSourceReader returns an io.Reader to read from the named file, or from
+// stdin if fileName is empty. Also returns the size of the input, which can
+// be used to track progress if it is known. Files ending in .gz or .zst are
+// decompressed.
+func (imp *MongoImport) getSourceReader(fileName string) (io.ReadCloser, int64, error) {
+	if fileName != "" {
+		file, err := os.Open(util.ToUniversalPath(fileName))
 		if err != nil {
 			return nil, -1, err
 		}
@@ -234,7 +351,21 @@ func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
 			return nil, -1, err
 		}
 		log.Logf(log.Info, "filesize: %v bytes", fileStat.Size())
-		return file, int64(fileStat.Size()), err
+
+		compressor := util.CompressorFromPath(fileName)
+		if compressor == util.NoCompressor {
+			return file, int64(fileStat.Size()), err
+		}
+		// progress is tracked on the compressed bytes, since the size of
+		// the decompressed data isn't known in advance
+		log.Logf(log.Info, "decompressing %v input", compressor)
+		compressed := &sizeTrackingReader{reader: file}
+		reader, err := util.NewDecompressingReader(&readCloser{compressed, file}, compressor)
+		if err != nil {
+			file.Close()
+			return nil, -1, err
+		}
+		return &decompressingReader{reader, compressed}, int64(fileStat.Size()), nil
 	}
 
 	log.Logf(log.Info, "reading from stdin")
@@ -243,6 +374,19 @@ func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
 	return os.Stdin, 0, nil
 }
 
+// readCloser combines an io.Reader with the io.Closer of its source.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressingReader is an io.ReadCloser of decompressed data which tracks
+// the number of compressed bytes read.
+type decompressingReader struct {
+	io.ReadCloser
+	sizeTracker
+}
+
 // fileSizeProgressor implements Progressor to allow a sizeTracker to hook up with a
 // progress.Bar instance, so that the progress bar can report the percentage of the file read.
 type fileSizeProgressor struct {
@@ -258,13 +402,55 @@ func (fsp *fileSizeProgressor) Progress() (int64, int64) {
 // number of documents successfully imported to the appropriate namespace and
 // any error encountered in doing this
 func (imp *MongoImport) ImportDocuments() (uint64, error) {
-	source, fileSize, err := imp.getSourceReader()
+	if validator := imp.processor.validator; validator != nil {
+		validator.rejects = log.Writer(0)
+		if imp.IngestOptions.Rejects != "" {
+			rejectsFile, err := os.Create(util.ToUniversalPath(imp.IngestOptions.Rejects))
+			if err != nil {
+				return 0, fmt.Errorf("error creating rejects file: %v", err)
+			}
+			defer rejectsFile.Close()
+			validator.rejects = rejectsFile
+		}
+		defer func() {
+			log.Logf(log.Always, "%v document(s) failed schema validation", validator.numRejected)
+		}()
+	}
+
+	if err := imp.prepareNamespace(); err != nil {
+		return 0, err
+	}
+
+	if len(imp.inputFiles) == 0 {
+		return imp.importFile("")
+	}
+	err := imp.importFiles()
+	return imp.insertionCount, err
+}
+
+// importFile imports the documents from the named file, or from stdin if
+// fileName is empty. It returns the number of documents imported from it.
+func (imp *MongoImport) importFile(fileName string) (uint64, error) {
+	source, fileSize, err := imp.getSourceReader(fileName)
 	if err != nil {
 		return 0, err
 	}
 	defer source.Close()
 
-	inputReader, err := imp.getInputReader(source)
+	// the input reader counts decoded, decompressed bytes, so compressed or
+	// transcoded input tracks its own progress
+	tracker, tracked := source.(sizeTracker)
+	var reader io.Reader = source
+	encoding := imp.InputOptions.Encoding
+	if encoding != "" && encoding != text.UTF8 && !tracked {
+		raw := &sizeTrackingReader{reader: source}
+		tracker, tracked, reader = raw, true, raw
+	}
+	if encoding != "" {
+		reader = text.NewDecodingReader(reader, encoding)
+	}
+
+	inputReader, err := imp.getInputReader(reader)
 	if err != nil {
 		return 0, err
 	}
@@ -275,9 +461,16 @@ func (imp *MongoImport) ImportDocuments() (uint64, error) {
 		}
 	}
 
+	if !tracked {
+		tracker = inputReader
+	}
+	name := fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	if len(imp.inputFiles) > 1 {
+		name = filepath.Base(fileName)
+	}
 	bar := &progress.Bar{
-		Name:      fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
-		Watching:  &fileSizeProgressor{fileSize, inputReader},
+		Name:      name,
+		Watching:  &fileSizeProgressor{fileSize, tracker},
 		Writer:    log.Writer(0),
 		BarLength: progressBarLength,
 		IsBytes:   true,
@@ -287,13 +480,13 @@ func (imp *MongoImport) ImportDocuments() (uint64, error) {
 	return imp.importDocuments(inputReader)
 }
 
-// importDocuments is a helper to ImportDocuments and does all the ingestion
-// work by taking data from the inputReader source and writing it to the
-// appropriate namespace
-func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported uint64, retErr error) {
+// prepareNamespace connects to the server, checking the type of node it's
+// connected to, and drops the target collection if necessary. It is done
+// once, before importing any files.
+func (imp *MongoImport) prepareNamespace() error {
 	session, err := imp.SessionProvider.GetSession()
 	if err != nil {
-		return 0, err
+		return err
 	}
 	defer session.Close()
 
@@ -313,12 +506,12 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 	// check if the server is a replica set, mongos, or standalone
 	imp.nodeType, err = imp.SessionProvider.GetNodeType()
 	if err != nil {
-		return 0, fmt.Errorf("error checking connected node type: %v", err)
+		return fmt.Errorf("error checking connected node type: %v", err)
 	}
 	log.Logf(log.Info, "connected to node type: %v", imp.nodeType)
 
 	if err = imp.configureSession(session); err != nil {
-		return 0, fmt.Errorf("error configuring session: %v", err)
+		return fmt.Errorf("error configuring session: %v", err)
 	}
 
 	// drop the database if necessary
@@ -330,11 +523,17 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 			C(imp.ToolOptions.Collection)
 		if err := collection.DropCollection(); err != nil {
 			if err.Error() != db.ErrNsNotFound.Error() {
-				return 0, err
+				return err
 			}
 		}
 	}
+	return nil
+}
 
+// importDocuments is a helper to ImportDocuments and does all the ingestion
+// work by taking data from the inputReader source and writing it to the
+// appropriate namespace
+func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported uint64, retErr error) {
 	readDocs := make(chan bson.D, workerBufferSize)
 	processingErrChan := make(chan error)
 	ordered := imp.IngestOptions.MaintainInsertionOrder
@@ -345,17 +544,19 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 	}()
 
 	// insert documents into the target database
+	var numInserted uint64
 	go func() {
-		processingErrChan <- imp.ingestDocuments(readDocs)
+		processingErrChan <- imp.ingestDocuments(readDocs, &numInserted)
 	}()
 
-	return imp.insertionCount, channelQuorumError(processingErrChan, 2)
+	retErr = channelQuorumError(processingErrChan, 2)
+	return atomic.LoadUint64(&numInserted), retErr
 }
 
 // ingestDocuments accepts a channel from which it reads documents to be inserted
 // into the target collection. It spreads the insert/upsert workload across one
-// or more workers.
-func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
+// or more workers, and adds the number of documents they insert to numInserted.
+func (imp *MongoImport) ingestDocuments(readDocs chan bson.D, numInserted *uint64) (retErr error) {
 	numInsertionWorkers := imp.IngestOptions.NumInsertionWorkers
 	if numInsertionWorkers <= 0 {
 		numInsertionWorkers = 1
@@ -376,7 +577,7 @@ func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
 		go func() {
 			defer wg.Done()
 			// only set the first insertion error and cause sibling goroutines to terminate immediately
-			err := imp.runInsertionWorker(readDocs)
+			err := imp.runInsertionWorker(readDocs, numInserted)
 			mt.Lock()
 			defer mt.Unlock()
 			if err != nil && retErr == nil {
@@ -409,7 +610,7 @@ func (imp *MongoImport) configureSession(session *mgo.Session) error {
 
 // runInsertionWorker is a helper to InsertDocuments - it reads document off
 // the read channel and prepares then in batches for insertion into the databas
-func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
+func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D, numInserted *uint64) (err error) {
 	session, err := imp.SessionProvider.GetSession()
 	if err != nil {
 		return fmt.Errorf("error connecting to mongod: %v", err)
@@ -436,7 +637,7 @@ readLoop:
 			// and send documents over the wire when we hit the batch size
 			// or when we're at/over the maximum message size threshold
 			if len(documents) == imp.ToolOptions.BulkBufferSize || numMessageBytes >= maxMessageSizeBytes {
-				if err = imp.insert(documents, collection); err != nil {
+				if err = imp.insert(documents, collection, numInserted); err != nil {
 					return err
 				}
 				documents = documents[:0]
@@ -463,7 +664,7 @@ readLoop:
 
 	// ingest any documents left in slice
 	if len(documents) != 0 {
-		return imp.insert(documents, collection)
+		return imp.insert(documents, collection, numInserted)
 	}
 	return nil
 }
@@ -497,8 +698,10 @@ func (imp *MongoImport) handleUpsert(documents []bson.Raw, collection *mgo.Colle
 
 // insert  performs the actual insertion/updates. If no upsert fields are
 // present in the document to be inserted, it simply inserts the documents
-// into the given collection
-func (imp *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection) (err error) {
+// into the given collection. In delete and update mode, the documents
+// describe the deletes and updates to apply instead. The number of documents
+// inserted, deleted or updated is added to insertionCount and to count.
+func (imp *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection, count *uint64) (err error) {
 	numInserted := 0
 	stopOnError := imp.IngestOptions.StopOnError
 	maintainInsertionOrder := imp.IngestOptions.MaintainInsertionOrder
@@ -507,12 +710,17 @@ func (imp *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection)
 		imp.insertionLock.Lock()
 		imp.insertionCount += uint64(numInserted)
 		imp.insertionLock.Unlock()
+		atomic.AddUint64(count, uint64(numInserted))
 	}()
 
 	if imp.IngestOptions.Upsert {
 		numInserted, err = imp.handleUpsert(documents, collection)
 		return err
 	}
+	if imp.IngestOptions.Mode == DeleteMode || imp.IngestOptions.Mode == UpdateMode {
+		numInserted, err = imp.applyWrites(documents, collection)
+		return err
+	}
 	if len(documents) == 0 {
 		return
 	}
@@ -545,6 +753,13 @@ func (imp *MongoImport) insert(documents []bson.Raw, collection *mgo.Collection)
 
 // getInputReader returns an implementation of InputReader based on the input type
 func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
+	if imp.InputOptions.Type == FixedWidth {
+		fixedWidthInputReader := NewFixedWidthInputReader(imp.fixedWidthSpec, in, imp.ToolOptions.NumDecodingWorkers)
+		fixedWidthInputReader.processor = imp.processor
+		fixedWidthInputReader.nullValue = imp.InputOptions.NullValue
+		return fixedWidthInputReader, nil
+	}
+
 	var fields []string
 	var err error
 	if imp.InputOptions.Fields != nil {
@@ -564,9 +779,21 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 	}
 
 	if imp.InputOptions.Type == CSV {
-		return NewCSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers), nil
+		csvInputReader := NewCSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers)
+		csvInputReader.csvReader.Comma = imp.csvDialect.Comma
+		csvInputReader.csvReader.Quote = imp.csvDialect.Quote
+		csvInputReader.csvReader.Escape = imp.csvDialect.Escape
+		csvInputReader.processor = imp.processor
+		csvInputReader.nullValue = imp.InputOptions.NullValue
+		return csvInputReader, nil
 	} else if imp.InputOptions.Type == TSV {
-		return NewTSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers), nil
-	}
-	return NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.ToolOptions.NumDecodingWorkers), nil
+		tsvInputReader := NewTSVInputReader(fields, in, imp.ToolOptions.NumDecodingWorkers)
+		tsvInputReader.processor = imp.processor
+		tsvInputReader.nullValue = imp.InputOptions.NullValue
+		return tsvInputReader, nil
+	}
+	jsonInputReader := NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.ToolOptions.NumDecodingWorkers)
+	jsonInputReader.processor = imp.processor
+	jsonInputReader.jsonFormat = imp.InputOptions.JSONFormat
+	return jsonInputReader, nil
 }
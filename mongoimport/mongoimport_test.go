@@ -2,9 +2,12 @@ package mongoimport
 
 import (
 	"fmt"
+	"github.com/dezmodue/mongo-tools/common/csv"
 	"github.com/dezmodue/mongo-tools/common/db"
 	"github.com/dezmodue/mongo-tools/common/options"
 	"github.com/dezmodue/mongo-tools/common/testutil"
+	"github.com/dezmodue/mongo-tools/common/text"
+	"github.com/dezmodue/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2/bson"
 	"io"
@@ -141,12 +144,34 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.ValidateSettings([]string{"a"}), ShouldNotBeNil)
 		})
 
-		Convey("an error should be thrown if there's more than one positional argument", func() {
+		Convey("an error should be thrown if there's more than one positional argument and no collection", func() {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
+			imp.ToolOptions.Namespace.Collection = ""
 			So(imp.ValidateSettings([]string{"a", "b"}), ShouldNotBeNil)
 		})
 
+		Convey("no error should be thrown if there's more than one positional argument and a collection", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			So(imp.ValidateSettings([]string{"a", "b"}), ShouldBeNil)
+			So(imp.inputFiles, ShouldResemble, []string{"a", "b"})
+		})
+
+		Convey("glob patterns given with --file should be expanded", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.File = "testdata/test_plain*.json"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.inputFiles, ShouldResemble, []string{"testdata/test_plain.json", "testdata/test_plain2.json"})
+		})
+
+		Convey("an error should be thrown if a glob pattern matches no files", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			So(imp.ValidateSettings([]string{"testdata/*.missing"}), ShouldNotBeNil)
+		})
+
 		Convey("an error should be thrown if --headerline is used with JSON input", func() {
 			imp, err := NewMongoImport()
 			So(err, ShouldBeNil)
@@ -300,6 +325,110 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			So(imp.ValidateSettings([]string{}), ShouldBeNil)
 			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "input")
 		})
+
+		Convey("an error should be thrown if the transform file can not be read", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Transform = "testdata/does_not_exist.json"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --rejects or --maxRejects are "+
+			"used without --validateSchema", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.IngestOptions.Rejects = "rejects.json"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+
+			imp, err = NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.IngestOptions.MaxRejects = 10
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("a schema validator should be set up if --validateSchema is given", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.IngestOptions.ValidateSchema = "testdata/test_schema.json"
+			imp.IngestOptions.MaxRejects = 10
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.processor.validator, ShouldNotBeNil)
+			So(imp.processor.validator.maxRejects, ShouldEqual, 10)
+		})
+
+		Convey("a CSV dialect should be parsed from --delimiter, --quote and --escape", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Delimiter = "tab"
+			imp.InputOptions.Quote = "'"
+			imp.InputOptions.Escape = `\`
+			imp.InputOptions.Encoding = "UTF16"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.csvDialect, ShouldResemble, csv.Dialect{Comma: '\t', Quote: '\'', Escape: '\\'})
+			So(imp.InputOptions.Encoding, ShouldEqual, text.UTF16)
+		})
+
+		Convey("an error should be thrown if the CSV dialect is ambiguous", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Delimiter = `"`
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if a CSV dialect is given for TSV input", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = TSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Delimiter = ";"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --nullValue is used with JSON input", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			nullValue := "NULL"
+			imp.InputOptions.NullValue = &nullValue
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if the encoding isn't supported", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Encoding = "ebcdic"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("fixed-width input should require --spec and parse it", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = FixedWidth
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.InputOptions.Spec = "testdata/test_fixedwidth_spec.json"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(len(imp.fixedWidthSpec), ShouldEqual, 4)
+		})
+
+		Convey("an error should be thrown if --fields is used with fixed-width input", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Type = FixedWidth
+			imp.InputOptions.Spec = "testdata/test_fixedwidth_spec.json"
+			fields := "a,b"
+			imp.InputOptions.Fields = &fields
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if --spec is used with other input types", func() {
+			imp, err := NewMongoImport()
+			So(err, ShouldBeNil)
+			imp.InputOptions.Spec = "testdata/test_fixedwidth_spec.json"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
 	})
 }
 
@@ -314,7 +443,7 @@ func TestGetSourceReader(t *testing.T) {
 				imp.InputOptions.File = "/path/to/input/file/dot/input.txt"
 				imp.InputOptions.Type = CSV
 				imp.ToolOptions.Namespace.Collection = ""
-				_, _, err = imp.getSourceReader()
+				_, _, err = imp.getSourceReader(imp.InputOptions.File)
 				So(err, ShouldNotBeNil)
 			})
 
@@ -323,7 +452,7 @@ func TestGetSourceReader(t *testing.T) {
 				So(err, ShouldBeNil)
 				imp.InputOptions.File = "testdata/test_array.json"
 				imp.InputOptions.Type = JSON
-				_, _, err = imp.getSourceReader()
+				_, _, err = imp.getSourceReader(imp.InputOptions.File)
 				So(err, ShouldBeNil)
 			})
 
@@ -331,9 +460,41 @@ func TestGetSourceReader(t *testing.T) {
 				imp, err := NewMongoImport()
 				So(err, ShouldBeNil)
 				imp.InputOptions.File = ""
-				_, _, err = imp.getSourceReader()
+				_, _, err = imp.getSourceReader(imp.InputOptions.File)
 				So(err, ShouldBeNil)
 			})
+
+			for _, compressor := range []string{util.GzipCompressor, util.ZstdCompressor} {
+				compressor := compressor
+				Convey(compressor+" files should be decompressed, with progress on compressed bytes", func() {
+					contents, err := ioutil.ReadFile("testdata/test_plain.json")
+					So(err, ShouldBeNil)
+					file, err := ioutil.TempFile("", "mongoimport_compressed")
+					So(err, ShouldBeNil)
+					fileName := file.Name() + util.CompressorExtension(compressor)
+					So(os.Rename(file.Name(), fileName), ShouldBeNil)
+					writer, err := util.NewCompressingWriter(file, compressor)
+					So(err, ShouldBeNil)
+					_, err = writer.Write(contents)
+					So(err, ShouldBeNil)
+					So(writer.Close(), ShouldBeNil)
+
+					imp, err := NewMongoImport()
+					So(err, ShouldBeNil)
+					imp.InputOptions.File = fileName
+					source, fileSize, err := imp.getSourceReader(fileName)
+					So(err, ShouldBeNil)
+					decompressed, err := ioutil.ReadAll(source)
+					So(err, ShouldBeNil)
+					So(source.Close(), ShouldBeNil)
+					So(decompressed, ShouldResemble, contents)
+					So(source.(sizeTracker).Size(), ShouldEqual, fileSize)
+
+					Reset(func() {
+						os.Remove(fileName)
+					})
+				})
+			}
 		})
 }
 
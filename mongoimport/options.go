@@ -2,7 +2,7 @@ package mongoimport
 
 var Usage = `<options> <file>
 
-Import CSV, TSV or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Import CSV, TSV, fixed-width or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
 
 See http://docs.mongodb.org/manual/reference/program/mongoimport/ for more information.`
 
@@ -15,16 +15,46 @@ type InputOptions struct {
 	FieldFile *string `long:"fieldFile" description:"file with field names - 1 per line"`
 
 	// Specifies the location and name of a file containing the data to import.
-	File string `long:"file" description:"file to import from; if not specified, stdin is used"`
+	File string `long:"file" description:"file to import from, decompressed if it ends in .gz or .zst; may be a glob pattern, e.g. 'drops/*.csv', to import several files; if not specified, stdin is used"`
+
+	// NumParallelFiles is the number of files imported at the same time when importing several files.
+	NumParallelFiles int `long:"numParallelFiles" default:"1" default-mask:"-" description:"number of files to import concurrently when importing several files (defaults to 1)"`
+
+	// StateFile records the files that were imported completely, so that they are skipped when the import is rerun.
+	StateFile string `long:"stateFile" description:"file to record each input file in once it is imported completely; files already recorded in it are skipped"`
 
 	// Treats the input source's first line as field list (csv and tsv only).
 	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
 
+	// Delimiter is the character that separates the fields of CSV input.
+	Delimiter string `long:"delimiter" default:"," default-mask:"-" description:"the character that separates CSV fields, e.g. ';'; a tab can be given as '\\t' or tab (CSV only, defaults to ',')"`
+
+	// Quote is the character that encloses quoted fields of CSV input.
+	Quote string `long:"quote" default:"\"" default-mask:"-" description:"the character that encloses quoted CSV fields (CSV only, defaults to '\"')"`
+
+	// Escape is the character that escapes the character following it within quoted fields of CSV input.
+	Escape string `long:"escape" description:"the character that escapes the character following it within quoted CSV fields, e.g. '\\'; if not specified, quote characters in quoted fields are doubled (CSV only)"`
+
+	// Encoding is the character encoding of the input.
+	Encoding string `long:"encoding" default:"utf-8" default-mask:"-" description:"the character encoding of the input, either utf-8, utf-16, utf-16le, utf-16be or latin1; a leading byte order mark is skipped, and gives the byte order of utf-16 (defaults to 'utf-8')"`
+
+	// NullValue is the CSV, TSV and fixed-width field value that is imported as null.
+	NullValue *string `long:"nullValue" description:"field value to import as null, e.g. NULL or \\N (CSV, TSV and fixed-width only)"`
+
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
 
-	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv (defaults to 'json')"`
+	// JSONFormat is the Extended JSON format of JSON input.
+	JSONFormat string `long:"jsonFormat" default:"legacy" default-mask:"-" description:"the Extended JSON format of the input, either legacy, canonical or relaxed; canonical and relaxed reject shell syntax such as NumberLong(...), and Decimal128 values ($numberDecimal) are not supported (defaults to 'legacy')"`
+
+	// Transform is a file containing a JSON array of field transformations to apply to each document.
+	Transform string `long:"transform" description:"file with a JSON array of transformations (rename, drop, cast, compute, split, date) to apply to each document"`
+
+	// Spec is a file containing a JSON array describing the fields of fixed-width input.
+	Spec string `long:"spec" description:"file with a JSON array of the fields of fixed-width input, each with a name, offset and width, and optionally a type (auto, date, int, long, double, string, bool or objectId), a date layout, and the padding to trim (both, left, right or none) (fixedwidth only)"`
+
+	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV, TSV and fixed-width files.
+	Type string `long:"type" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, or fixedwidth (defaults to 'json')"`
 }
 
 // Name returns a description of the InputOptions struct.
@@ -38,11 +68,14 @@ type IngestOptions struct {
 	Drop bool `long:"drop" description:"drop collection before inserting documents"`
 
 	// Ignores fields with empty values in CSV and TSV imports.
-	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
+	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV, TSV and fixed-width input"`
 
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert documents in the order of their appearance in the input source"`
 
+	// Mode selects whether the input documents are inserted, or describe deletes or updates.
+	Mode string `long:"mode" default:"insert" default-mask:"-" description:"what to do with the input, either insert, delete - delete the documents matching each input document, or its 'filter' field for JSON - or update - apply the 'update' of each JSON {filter: ..., update: ...} document to the documents matching its 'filter' (defaults to 'insert')"`
+
 	// Sets the number of insertion routines to use
 	NumInsertionWorkers int `short:"j" long:"numInsertionWorkers" description:"number of insert operations to run concurrently (defaults to 1)" default:"1" default-mask:"-"`
 
@@ -55,6 +88,15 @@ type IngestOptions struct {
 	// Specifies a list of fields for the query portion of the upsert; defaults to _id field.
 	UpsertFields string `long:"upsertFields" description:"comma-separated fields for the query part of the upsert"`
 
+	// ValidateSchema is a JSON Schema (draft 4) file that documents are checked against before being inserted.
+	ValidateSchema string `long:"validateSchema" description:"JSON Schema (draft 4) file to validate each document against before inserting it"`
+
+	// Rejects is a file to write documents that fail schema validation to, one JSON object per line.
+	Rejects string `long:"rejects" description:"file to write documents that fail schema validation to; if not specified, they are logged"`
+
+	// MaxRejects stops the import once this many documents have failed schema validation.
+	MaxRejects int `long:"maxRejects" description:"stop importing after this many documents fail schema validation (defaults to 0, never stop)"`
+
 	// Sets write concern level for write operations.
 	WriteConcern string `long:"writeConcern" default:"majority" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}' (defaults to 'majority')"`
 }
@@ -32,15 +32,22 @@ type TSVInputReader struct {
 	// numDecoders is the number of concurrent goroutines to use for decoding
 	numDecoders int
 
+	// processor is applied to each document after it is decoded
+	processor documentProcessor
+
+	// nullValue, if not nil, is the field value that is imported as null
+	nullValue *string
+
 	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
 	sizeTracker
 }
 
 // TSVConverter implements the Converter interface for TSV input.
 type TSVConverter struct {
-	fields []string
-	data   string
-	index  uint64
+	fields    []string
+	data      string
+	index     uint64
+	nullValue *string
 }
 
 // NewTSVInputReader returns a TSVInputReader configured to read input from the
@@ -92,9 +99,10 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				return
 			}
 			tsvRecordChan <- TSVConverter{
-				fields: r.fields,
-				data:   r.tsvRecord,
-				index:  r.numProcessed,
+				fields:    r.fields,
+				data:      r.tsvRecord,
+				index:     r.numProcessed,
+				nullValue: r.nullValue,
 			}
 			r.numProcessed++
 		}
@@ -102,7 +110,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 
 	// begin processing read bytes
 	go func() {
-		tsvErrChan <- streamDocuments(ordered, r.numDecoders, tsvRecordChan, readDocs)
+		tsvErrChan <- streamDocuments(ordered, r.numDecoders, tsvRecordChan, readDocs, r.processor)
 	}()
 
 	return channelQuorumError(tsvErrChan, 2)
@@ -115,5 +123,6 @@ func (c TSVConverter) Convert() (bson.D, error) {
 		c.fields,
 		strings.Split(strings.TrimRight(c.data, "\r\n"), tokenSeparator),
 		c.index,
+		c.nullValue,
 	)
 }
@@ -0,0 +1,84 @@
+package mongoimport
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/bsonutil"
+	"github.com/dezmodue/mongo-tools/common/json"
+	"github.com/dezmodue/mongo-tools/common/schema"
+	"gopkg.in/mgo.v2/bson"
+	"io"
+	"sync"
+)
+
+// schemaValidator checks documents against a JSON schema and writes the ones
+// that fail - along with their violations - to a rejects stream.
+type schemaValidator struct {
+	schema *schema.Schema
+
+	// rejects receives one JSON object per rejected document
+	rejects io.Writer
+
+	// maxRejects, if non-zero, is the number of rejected documents after
+	// which the import is stopped
+	maxRejects uint64
+
+	// numRejected counts the documents that failed validation
+	numRejected uint64
+
+	// rejectsLock serializes writes to rejects and updates to numRejected
+	rejectsLock sync.Mutex
+}
+
+// rejectedDocument is the format in which rejected documents are written.
+type rejectedDocument struct {
+	Errors   []schema.Violation `json:"errors"`
+	Document interface{}        `json:"document"`
+}
+
+// validate returns true if the document matches the schema. Otherwise, the
+// document is written to the rejects stream and validate returns false, along
+// with a non-nil error if the limit of rejected documents has been reached.
+func (sv *schemaValidator) validate(document bson.D) (bool, error) {
+	violations := sv.schema.Validate(document)
+	if len(violations) == 0 {
+		return true, nil
+	}
+	line, err := sv.formatReject(document, violations)
+	if err != nil {
+		return false, fmt.Errorf("error writing rejected document: %v", err)
+	}
+
+	sv.rejectsLock.Lock()
+	defer sv.rejectsLock.Unlock()
+	if _, err = sv.rejects.Write(line); err != nil {
+		return false, fmt.Errorf("error writing rejected document: %v", err)
+	}
+	sv.numRejected++
+	if sv.maxRejects != 0 && sv.numRejected >= sv.maxRejects {
+		return false, fmt.Errorf("reached the limit of %v documents that failed schema validation", sv.maxRejects)
+	}
+	return false, nil
+}
+
+// formatReject returns the line written to the rejects stream for a document.
+func (sv *schemaValidator) formatReject(document bson.D, violations []schema.Violation) ([]byte, error) {
+	// round trip the document through BSON so that nested documents are
+	// all of a type the extended JSON converter accepts
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	normalized := bson.D{}
+	if err = bson.Unmarshal(raw, &normalized); err != nil {
+		return nil, err
+	}
+	extendedDocument, err := bsonutil.ConvertBSONValueToJSON(normalized)
+	if err != nil {
+		return nil, err
+	}
+	line, err := json.Marshal(rejectedDocument{violations, extendedDocument})
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
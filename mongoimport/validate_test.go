@@ -0,0 +1,97 @@
+package mongoimport
+
+import (
+	"bytes"
+	"github.com/dezmodue/mongo-tools/common/schema"
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Given a schema validator", t, func() {
+		documentSchema, err := schema.Parse([]byte(`{
+			"properties": {"a": {"type": "integer"}, "b": {"type": "object", "required": ["c"]}}
+		}`))
+		So(err, ShouldBeNil)
+		rejects := &bytes.Buffer{}
+		validator := &schemaValidator{schema: documentSchema, rejects: rejects}
+
+		Convey("valid documents should be accepted and not written to the rejects stream", func() {
+			valid, err := validator.validate(bson.D{{"a", 1}, {"b", &bson.D{{"c", "d"}}}})
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+			So(rejects.Len(), ShouldEqual, 0)
+			So(validator.numRejected, ShouldEqual, 0)
+		})
+
+		Convey("invalid documents should be written to the rejects stream with their violations", func() {
+			valid, err := validator.validate(bson.D{{"a", "x"}, {"b", &bson.D{{"d", 1}}}})
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+			So(validator.numRejected, ShouldEqual, 1)
+			So(rejects.String(), ShouldEqual, `{"errors":[`+
+				`{"path":"/a","message":"expected integer, got string"},`+
+				`{"path":"/b/c","message":"required property is missing"}],`+
+				`"document":{"a":"x","b":{"d":1}}}`+"\n")
+		})
+
+		Convey("an error should be returned once the limit of rejected documents is reached", func() {
+			validator.maxRejects = 2
+			valid, err := validator.validate(bson.D{{"a", "x"}})
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+			valid, err = validator.validate(bson.D{{"a", "y"}})
+			So(err, ShouldNotBeNil)
+			So(valid, ShouldBeFalse)
+			So(strings.Count(rejects.String(), "\n"), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestProcessDocumentsWithValidator(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Given a document processor with a schema validator", t, func() {
+		documentSchema, err := schema.Parse([]byte(`{"required": ["field1"]}`))
+		So(err, ShouldBeNil)
+		processor := documentProcessor{
+			validator: &schemaValidator{schema: documentSchema, rejects: &bytes.Buffer{}},
+		}
+		Convey("rejected documents should not be streamed", func() {
+			inputChannel := make(chan Converter, 100)
+			outputChannel := make(chan bson.D, 100)
+			inputChannel <- csvConverters[0]
+			inputChannel <- csvConverters[1]
+			close(inputChannel)
+			So(streamDocuments(true, 2, inputChannel, outputChannel, processor), ShouldBeNil)
+			So(<-outputChannel, ShouldResemble, expectedDocuments[0])
+			_, open := <-outputChannel
+			So(open, ShouldBeFalse)
+			So(processor.validator.numRejected, ShouldEqual, 1)
+		})
+
+		Convey("rejected documents should not reorder or drop the others when ordered", func() {
+			numberSchema, err := schema.Parse([]byte(`{"properties": {"n": {"minimum": 10}}}`))
+			So(err, ShouldBeNil)
+			processor.validator.schema = numberSchema
+			inputChannel := make(chan Converter, 100)
+			outputChannel := make(chan bson.D, 100)
+			for _, n := range []string{"1", "11", "2", "13", "14", "15"} {
+				inputChannel <- CSVConverter{fields: []string{"n"}, data: []string{n}}
+			}
+			close(inputChannel)
+			So(streamDocuments(true, 2, inputChannel, outputChannel, processor), ShouldBeNil)
+			var numbers []interface{}
+			for document := range outputChannel {
+				numbers = append(numbers, document[0].Value)
+			}
+			So(numbers, ShouldResemble, []interface{}{11, 13, 14, 15})
+			So(processor.validator.numRejected, ShouldEqual, 2)
+		})
+	})
+}
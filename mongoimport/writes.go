@@ -0,0 +1,235 @@
+package mongoimport
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Ingest modes accepted by mongoimport.
+const (
+	InsertMode = "insert"
+	DeleteMode = "delete"
+	UpdateMode = "update"
+)
+
+// Limits on the statements of a single delete or update command. Servers
+// before 3.6 accept at most 1000 statements, and the whole command must fit
+// in a BSON document, leaving room for the rest of the command.
+const (
+	maxWriteBatchSize    = 1000
+	maxWriteCommandBytes = maxBSONSize - 16*1024
+
+	// statementOverhead bounds the bytes a statement adds to the document
+	// read from the input that it is built from
+	statementOverhead = 64
+)
+
+// Keys of the JSON documents that describe deletes and updates.
+const (
+	filterKey = "filter"
+	updateKey = "update"
+)
+
+// validateMode checks that the ingest mode is supported and can be used
+// with the other options.
+func (imp *MongoImport) validateMode() error {
+	switch imp.IngestOptions.Mode {
+	case InsertMode:
+		return nil
+	case DeleteMode, UpdateMode:
+	default:
+		return fmt.Errorf("unknown mode '%v', choose '%v', '%v' or '%v'",
+			imp.IngestOptions.Mode, InsertMode, DeleteMode, UpdateMode)
+	}
+	mode := imp.IngestOptions.Mode
+	if imp.IngestOptions.Upsert {
+		return fmt.Errorf("can not use --upsert or --upsertFields with --mode=%v", mode)
+	}
+	if imp.IngestOptions.Drop {
+		return fmt.Errorf("can not use --drop with --mode=%v", mode)
+	}
+	if imp.IngestOptions.ValidateSchema != "" {
+		return fmt.Errorf("can not use --validateSchema with --mode=%v", mode)
+	}
+	if mode == UpdateMode && imp.InputOptions.Type != JSON {
+		return fmt.Errorf("--mode=%v requires JSON input of {%v: ..., %v: ...} documents",
+			mode, filterKey, updateKey)
+	}
+	return nil
+}
+
+// ModeVerb returns the verb describing what the ingest mode does to the
+// documents it counts.
+func ModeVerb(mode string) string {
+	switch mode {
+	case DeleteMode:
+		return "deleted"
+	case UpdateMode:
+		return "updated"
+	}
+	return "imported"
+}
+
+// parseWriteOperation returns the filter and, in update mode, the update
+// described by a document read from the input. A CSV or TSV record is itself
+// the filter of a delete; a JSON document holds the filter and update under
+// the "filter" and "update" keys. Empty filters are an error, since they
+// would match every document in the collection.
+func (imp *MongoImport) parseWriteOperation(document bson.D) (filter, update bson.D, err error) {
+	if imp.InputOptions.Type != JSON {
+		filter = document
+	} else {
+		for _, elem := range document {
+			value, ok := elem.Value.(bson.D)
+			if !ok {
+				return nil, nil, fmt.Errorf("'%v' must be a document", elem.Name)
+			}
+			switch {
+			case elem.Name == filterKey:
+				filter = value
+			case elem.Name == updateKey && imp.IngestOptions.Mode == UpdateMode:
+				update = value
+			default:
+				return nil, nil, fmt.Errorf("unexpected field '%v' in %v operation", elem.Name, imp.IngestOptions.Mode)
+			}
+		}
+	}
+	if len(filter) == 0 {
+		return nil, nil, fmt.Errorf("%v operation has an empty or missing filter: %v", imp.IngestOptions.Mode, document)
+	}
+	if imp.IngestOptions.Mode == UpdateMode && len(update) == 0 {
+		return nil, nil, fmt.Errorf("%v operation has an empty or missing update: %v", imp.IngestOptions.Mode, document)
+	}
+	return filter, update, nil
+}
+
+// writeCommandResult is the reply to a delete or update command.
+type writeCommandResult struct {
+	// N is the number of documents deleted, or matched by updates
+	N           int `bson:"n"`
+	WriteErrors []struct {
+		Index  int    `bson:"index"`
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeErrors"`
+	WriteConcernError *struct {
+		ErrMsg string `bson:"errmsg"`
+	} `bson:"writeConcernError"`
+}
+
+// err returns the first error reported in the reply, if any.
+func (result *writeCommandResult) err() error {
+	if len(result.WriteErrors) > 0 {
+		writeError := result.WriteErrors[0]
+		if len(result.WriteErrors) > 1 {
+			return fmt.Errorf("%v (and %v more write errors)", writeError.ErrMsg, len(result.WriteErrors)-1)
+		}
+		return fmt.Errorf("%v", writeError.ErrMsg)
+	}
+	if result.WriteConcernError != nil {
+		return fmt.Errorf("write concern error: %v", result.WriteConcernError.ErrMsg)
+	}
+	return nil
+}
+
+// writeConcernDocument returns the write concern of a write command run with
+// the given session safety; nil safety means unacknowledged writes.
+func writeConcernDocument(safe *mgo.Safe) bson.D {
+	if safe == nil {
+		return bson.D{{"w", 0}}
+	}
+	writeConcern := bson.D{}
+	if safe.WMode != "" {
+		writeConcern = append(writeConcern, bson.DocElem{"w", safe.WMode})
+	} else if safe.W > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{"w", safe.W})
+	}
+	if safe.WTimeout > 0 {
+		writeConcern = append(writeConcern, bson.DocElem{"wtimeout", safe.WTimeout})
+	}
+	if safe.J {
+		writeConcern = append(writeConcern, bson.DocElem{"j", true})
+	}
+	if safe.FSync {
+		writeConcern = append(writeConcern, bson.DocElem{"fsync", true})
+	}
+	return writeConcern
+}
+
+// buildWriteCommands returns the delete or update commands, depending on
+// the mode, that apply the operations read from the input to the collection:
+// a deleteMany or updateMany for each. The operations are split into as many
+// commands as needed to stay within the limits of a single command. Invalid
+// operations are handled like failed inserts: they are logged and skipped, or
+// returned as an error with --stopOnError.
+func (imp *MongoImport) buildWriteCommands(documents []bson.Raw, collectionName string) ([]bson.D, error) {
+	stopOnError := imp.IngestOptions.StopOnError
+	var commands []bson.D
+	var statements []interface{}
+	numBytes := 0
+	for _, rawDocument := range documents {
+		document := bson.D{}
+		if err := bson.Unmarshal(rawDocument.Data, &document); err != nil {
+			return nil, fmt.Errorf("error unmarshaling document: %v", err)
+		}
+		filter, update, err := imp.parseWriteOperation(document)
+		if err != nil {
+			if err = filterIngestError(stopOnError, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		size := len(rawDocument.Data) + statementOverhead
+		if len(statements) == maxWriteBatchSize ||
+			(len(statements) > 0 && numBytes+size > maxWriteCommandBytes) {
+			commands = append(commands, imp.writeCommand(statements, collectionName))
+			statements, numBytes = nil, 0
+		}
+		if imp.IngestOptions.Mode == DeleteMode {
+			statements = append(statements, bson.D{{"q", filter}, {"limit", 0}})
+		} else {
+			statements = append(statements, bson.D{{"q", filter}, {"u", update}, {"multi", true}})
+		}
+		numBytes += size
+	}
+	if len(statements) > 0 {
+		commands = append(commands, imp.writeCommand(statements, collectionName))
+	}
+	return commands, nil
+}
+
+// writeCommand returns the delete or update command, depending on the mode,
+// running the statements against the collection.
+func (imp *MongoImport) writeCommand(statements []interface{}, collectionName string) bson.D {
+	command := bson.D{{"delete", collectionName}, {"deletes", statements}}
+	if imp.IngestOptions.Mode == UpdateMode {
+		command = bson.D{{"update", collectionName}, {"updates", statements}}
+	}
+	return append(command, bson.DocElem{"ordered", imp.IngestOptions.MaintainInsertionOrder})
+}
+
+// applyWrites deletes or updates all the documents matching each of the
+// operations read from the input, depending on the mode, with as few write
+// commands as the batch allows. The operations are applied in order only
+// with --maintainInsertionOrder. It returns the number of documents deleted,
+// or matched by updates.
+func (imp *MongoImport) applyWrites(documents []bson.Raw, collection *mgo.Collection) (numAffected int, err error) {
+	commands, err := imp.buildWriteCommands(documents, collection.Name)
+	if err != nil {
+		return 0, err
+	}
+	writeConcern := writeConcernDocument(collection.Database.Session.Safe())
+	for _, command := range commands {
+		command = append(command, bson.DocElem{"writeConcern", writeConcern})
+		result := writeCommandResult{}
+		if err = collection.Database.Run(command, &result); err == nil {
+			numAffected += result.N
+			err = result.err()
+		}
+		if err = filterIngestError(imp.IngestOptions.StopOnError, err); err != nil {
+			return numAffected, err
+		}
+	}
+	return numAffected, nil
+}
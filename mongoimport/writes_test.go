@@ -0,0 +1,225 @@
+package mongoimport
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"strings"
+	"testing"
+)
+
+func TestParseWriteOperation(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongoimport instance in update mode", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = JSON
+		imp.IngestOptions.Mode = UpdateMode
+
+		Convey("the filter and update of each document should be used", func() {
+			raw, err := bson.Marshal(bson.D{
+				{"filter", bson.D{{"sku", "a1"}}},
+				{"update", bson.D{{"$set", bson.D{{"qty", 0}}}}},
+			})
+			So(err, ShouldBeNil)
+			document := bson.D{}
+			So(bson.Unmarshal(raw, &document), ShouldBeNil)
+			filter, update, err := imp.parseWriteOperation(document)
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, bson.D{{"sku", "a1"}})
+			So(update, ShouldResemble, bson.D{{"$set", bson.D{{"qty", 0}}}})
+		})
+
+		Convey("documents without an update should be an error", func() {
+			_, _, err := imp.parseWriteOperation(bson.D{{"filter", bson.D{{"sku", "a1"}}}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("empty filters should be an error", func() {
+			_, _, err := imp.parseWriteOperation(bson.D{
+				{"filter", bson.D{}},
+				{"update", bson.D{{"$set", bson.D{{"qty", 0}}}}},
+			})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("unexpected fields should be an error", func() {
+			_, _, err := imp.parseWriteOperation(bson.D{
+				{"filter", bson.D{{"sku", "a1"}}},
+				{"upsert", true},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a mongoimport instance deleting CSV keys", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = CSV
+		imp.IngestOptions.Mode = DeleteMode
+
+		Convey("each record should be the filter", func() {
+			filter, update, err := imp.parseWriteOperation(bson.D{{"sku", "a1"}, {"store", 3}})
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, bson.D{{"sku", "a1"}, {"store", 3}})
+			So(update, ShouldBeNil)
+		})
+
+		Convey("a record with no fields should be an error", func() {
+			_, _, err := imp.parseWriteOperation(bson.D{})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateMode(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating the ingest mode", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+
+		Convey("the mode should default to insert", func() {
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.IngestOptions.Mode, ShouldEqual, InsertMode)
+		})
+
+		Convey("unknown modes should be an error", func() {
+			imp.IngestOptions.Mode = "replace"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("delete mode should accept CSV input", func() {
+			imp.IngestOptions.Mode = "DELETE"
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.IngestOptions.Mode, ShouldEqual, DeleteMode)
+		})
+
+		Convey("update mode should require JSON input", func() {
+			imp.IngestOptions.Mode = UpdateMode
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--drop and --upsert should not be used with delete mode", func() {
+			imp.IngestOptions.Mode = DeleteMode
+			imp.IngestOptions.Drop = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+			imp.IngestOptions.Drop = false
+			imp.IngestOptions.Upsert = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestBuildWriteCommands(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a mongoimport instance in update mode", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = JSON
+		imp.IngestOptions.Mode = UpdateMode
+
+		var documents []bson.Raw
+		for _, document := range []bson.D{
+			{{"filter", bson.D{{"sku", "a1"}}}, {"update", bson.D{{"$set", bson.D{{"qty", 0}}}}}},
+			{{"filter", bson.D{{"sku", "a2"}}}},
+			{{"filter", bson.D{{"sku", "a3"}}}, {"update", bson.D{{"$inc", bson.D{{"qty", 1}}}}}},
+		} {
+			data, err := bson.Marshal(document)
+			So(err, ShouldBeNil)
+			documents = append(documents, bson.Raw{3, data})
+		}
+
+		Convey("the valid operations should be batched into one command", func() {
+			commands, err := imp.buildWriteCommands(documents, "stock")
+			So(err, ShouldBeNil)
+			So(len(commands), ShouldEqual, 1)
+			So(commands[0], ShouldResemble, bson.D{
+				{"update", "stock"},
+				{"updates", []interface{}{
+					bson.D{{"q", bson.D{{"sku", "a1"}}}, {"u", bson.D{{"$set", bson.D{{"qty", 0}}}}}, {"multi", true}},
+					bson.D{{"q", bson.D{{"sku", "a3"}}}, {"u", bson.D{{"$inc", bson.D{{"qty", 1}}}}}, {"multi", true}},
+				}},
+				{"ordered", false},
+			})
+		})
+
+		Convey("invalid operations should stop the import with --stopOnError", func() {
+			imp.IngestOptions.StopOnError = true
+			_, err := imp.buildWriteCommands(documents, "stock")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("deletes should remove every match, in order with --maintainInsertionOrder", func() {
+			imp.IngestOptions.Mode = DeleteMode
+			imp.IngestOptions.MaintainInsertionOrder = true
+			commands, err := imp.buildWriteCommands(documents[1:2], "stock")
+			So(err, ShouldBeNil)
+			So(len(commands), ShouldEqual, 1)
+			So(commands[0], ShouldResemble, bson.D{
+				{"delete", "stock"},
+				{"deletes", []interface{}{bson.D{{"q", bson.D{{"sku", "a2"}}}, {"limit", 0}}}},
+				{"ordered", true},
+			})
+		})
+	})
+
+	Convey("With a mongoimport instance deleting CSV keys", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = CSV
+		imp.IngestOptions.Mode = DeleteMode
+
+		statementCounts := func(commands []bson.D) []int {
+			var counts []int
+			for _, command := range commands {
+				counts = append(counts, len(command[1].Value.([]interface{})))
+			}
+			return counts
+		}
+
+		Convey("commands should hold at most 1000 statements", func() {
+			var documents []bson.Raw
+			for i := 0; i < 2500; i++ {
+				data, err := bson.Marshal(bson.D{{"sku", i}})
+				So(err, ShouldBeNil)
+				documents = append(documents, bson.Raw{3, data})
+			}
+			commands, err := imp.buildWriteCommands(documents, "stock")
+			So(err, ShouldBeNil)
+			So(statementCounts(commands), ShouldResemble, []int{1000, 1000, 500})
+		})
+
+		Convey("commands should fit in a BSON document", func() {
+			data, err := bson.Marshal(bson.D{{"sku", strings.Repeat("x", 5*1024*1024)}})
+			So(err, ShouldBeNil)
+			documents := []bson.Raw{{3, data}, {3, data}, {3, data}, {3, data}, {3, data}}
+			commands, err := imp.buildWriteCommands(documents, "stock")
+			So(err, ShouldBeNil)
+			So(statementCounts(commands), ShouldResemble, []int{3, 2})
+			for _, command := range commands {
+				raw, err := bson.Marshal(command)
+				So(err, ShouldBeNil)
+				So(len(raw), ShouldBeLessThan, maxBSONSize)
+			}
+		})
+	})
+}
+
+func TestWriteConcernDocument(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("The session safety should become the write command's write concern", t, func() {
+		So(writeConcernDocument(nil), ShouldResemble, bson.D{{"w", 0}})
+		So(writeConcernDocument(&mgo.Safe{WMode: "majority", WTimeout: 500, J: true}), ShouldResemble,
+			bson.D{{"w", "majority"}, {"wtimeout", 500}, {"j", true}})
+		So(writeConcernDocument(&mgo.Safe{W: 2}), ShouldResemble, bson.D{{"w", 2}})
+	})
+}
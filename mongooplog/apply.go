@@ -0,0 +1,190 @@
+package mongooplog
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// oplogMaxCommandSize sets the maximum size for multiple buffered ops in the
+// applyOps command, as it does in mongorestore. Ops larger than this are still
+// applied, as single elements.
+const oplogMaxCommandSize = 1024 * 1024 * 8
+
+// DefaultBatchSize is the default maximum number of ops in an applyOps command.
+const DefaultBatchSize = 1000
+
+// oplogBatch is a list of raw oplog entries to apply with one applyOps.
+type oplogBatch struct {
+	entries []interface{}
+	bytes   int
+}
+
+// oplogApplier applies oplog entries to the destination in batches. With
+// more than one worker, entries are partitioned by namespace and document
+// _id, and the partitions are applied in parallel, so operations on the same
+// document are still applied in order. Commands act as barriers: everything
+// before them is applied first, and they are applied on their own.
+type oplogApplier struct {
+	session   *mgo.Session
+	batchSize int
+	batches   []oplogBatch
+
+	// Applied is the number of entries applied so far.
+	Applied int
+
+	// LastTimestamp is the timestamp of the last entry that has been
+	// applied, or skipped once every entry before it was applied, so that
+	// replaying the oplog can resume right after it.
+	LastTimestamp bson.MongoTimestamp
+
+	// the timestamp of the last entry queued or skipped
+	queuedTimestamp bson.MongoTimestamp
+	pending         int
+}
+
+// newOplogApplier returns an applier for the entries after the given
+// timestamp.
+func newOplogApplier(session *mgo.Session, opts *ApplyOptions, after bson.MongoTimestamp) *oplogApplier {
+	return &oplogApplier{
+		session:         session,
+		batchSize:       opts.BatchSize,
+		batches:         make([]oplogBatch, opts.NumApplyWorkers),
+		LastTimestamp:   after,
+		queuedTimestamp: after,
+	}
+}
+
+// isBarrier returns true if an entry has to be applied after every entry
+// before it, and before every entry after it: commands, and index builds
+// written as inserts into system.indexes.
+func isBarrier(entry *oplogEntry) bool {
+	return entry.Operation == "c" || strings.HasSuffix(entry.Namespace, ".system.indexes")
+}
+
+// partition returns which of n partitions an entry is applied in, chosen
+// by the namespace and _id of the document it changes.
+func partition(entry *oplogEntry, n int) int {
+	if n == 1 {
+		return 0
+	}
+	doc := entry.Object
+	if entry.Operation == "u" {
+		doc = entry.Query
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(entry.Namespace))
+	for _, elem := range doc {
+		if elem.Name == "_id" {
+			// documents with the same _id marshal to the same bytes
+			if id, err := bson.Marshal(bson.D{elem}); err == nil {
+				hash.Write(id)
+			}
+			break
+		}
+	}
+	return int(hash.Sum32() % uint32(n))
+}
+
+// Add queues an entry to be applied, applying the queued entries first if
+// the entry's batch is full or the entry is a barrier.
+func (a *oplogApplier) Add(entry *oplogEntry) error {
+	data, err := bson.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshaling oplog entry: %v", err)
+	}
+	raw := bson.Raw{Kind: 0x03, Data: data}
+
+	if isBarrier(entry) {
+		if err = a.Flush(); err != nil {
+			return err
+		}
+		if err = applyOps(a.session, []interface{}{raw}); err != nil {
+			return err
+		}
+		a.Applied++
+		a.queuedTimestamp = entry.Timestamp
+		a.LastTimestamp = entry.Timestamp
+		return nil
+	}
+
+	batch := &a.batches[partition(entry, len(a.batches))]
+	if len(batch.entries) > 0 &&
+		(len(batch.entries) >= a.batchSize || batch.bytes+len(data) > oplogMaxCommandSize) {
+		if err = a.Flush(); err != nil {
+			return err
+		}
+	}
+	batch.entries = append(batch.entries, raw)
+	batch.bytes += len(data)
+	a.pending++
+	a.queuedTimestamp = entry.Timestamp
+	return nil
+}
+
+// Skip records that the entry with the given timestamp isn't applied, so
+// that LastTimestamp can move past it.
+func (a *oplogApplier) Skip(ts bson.MongoTimestamp) {
+	a.queuedTimestamp = ts
+	if a.pending == 0 {
+		a.LastTimestamp = ts
+	}
+}
+
+// Flush applies every queued entry, returning once all are applied.
+func (a *oplogApplier) Flush() error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(a.batches))
+	nonEmpty := 0
+	for i := range a.batches {
+		if len(a.batches[i].entries) > 0 {
+			nonEmpty++
+		}
+	}
+	for i := range a.batches {
+		entries := a.batches[i].entries
+		if len(entries) == 0 {
+			continue
+		}
+		if nonEmpty == 1 {
+			errs[i] = applyOps(a.session, entries)
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session := a.session.Copy()
+			defer session.Close()
+			errs[i] = applyOps(session, entries)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range a.batches {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		a.Applied += len(a.batches[i].entries)
+		a.batches[i] = oplogBatch{}
+	}
+	a.pending = 0
+	a.LastTimestamp = a.queuedTimestamp
+	return nil
+}
+
+// applyOps applies a list of oplog entries with one applyOps command.
+func applyOps(session *mgo.Session, entries []interface{}) error {
+	res := &db.ApplyOpsResponse{}
+	if err := session.Run(bson.D{{"applyOps", entries}}, res); err != nil {
+		return fmt.Errorf("error applying ops: %v", err)
+	}
+	// check the server's response for an issue
+	if !res.Ok {
+		return fmt.Errorf("server gave error applying ops: %v", res.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package mongooplog
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When partitioning oplog entries", t, func() {
+		insert := &oplogEntry{Operation: "i", Namespace: "test.data",
+			Object: bson.D{{"_id", 7}, {"x", 1}}}
+		update := &oplogEntry{Operation: "u", Namespace: "test.data",
+			Object: bson.D{{"$set", bson.D{{"x", 2}}}}, Query: bson.D{{"_id", 7}}}
+		remove := &oplogEntry{Operation: "d", Namespace: "test.data",
+			Object: bson.D{{"_id", 7}}}
+
+		Convey("every operation on a document lands in the same partition", func() {
+			So(partition(update, 16), ShouldEqual, partition(insert, 16))
+			So(partition(remove, 16), ShouldEqual, partition(insert, 16))
+		})
+
+		Convey("documents are spread over the partitions", func() {
+			seen := map[int]bool{}
+			for id := 0; id < 100; id++ {
+				seen[partition(&oplogEntry{Operation: "i", Namespace: "test.data",
+					Object: bson.D{{"_id", id}}}, 4)] = true
+			}
+			So(len(seen), ShouldEqual, 4)
+		})
+
+		Convey("a single partition takes everything", func() {
+			So(partition(insert, 1), ShouldEqual, 0)
+		})
+	})
+}
+
+func TestIsBarrier(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("Commands and index builds are barriers, CRUD operations aren't", t, func() {
+		So(isBarrier(&oplogEntry{Operation: "c", Namespace: "test.$cmd"}), ShouldBeTrue)
+		So(isBarrier(&oplogEntry{Operation: "i", Namespace: "test.system.indexes"}), ShouldBeTrue)
+		So(isBarrier(&oplogEntry{Operation: "i", Namespace: "test.data"}), ShouldBeFalse)
+		So(isBarrier(&oplogEntry{Operation: "u", Namespace: "test.data"}), ShouldBeFalse)
+	})
+}
+
+func TestApplierTimestamps(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With an oplog applier", t, func() {
+		applier := newOplogApplier(nil, &ApplyOptions{BatchSize: 10, NumApplyWorkers: 2}, 5)
+		So(applier.LastTimestamp, ShouldEqual, 5)
+
+		Convey("skipped entries move the last timestamp when nothing is queued", func() {
+			applier.Skip(6)
+			So(applier.LastTimestamp, ShouldEqual, 6)
+		})
+
+		Convey("but not past entries queued and not yet applied", func() {
+			So(applier.Add(&oplogEntry{Timestamp: 6, Operation: "i", Namespace: "test.data",
+				Object: bson.D{{"_id", 1}}}), ShouldBeNil)
+			applier.Skip(7)
+			So(applier.LastTimestamp, ShouldEqual, 5)
+			So(applier.Applied, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,282 @@
+package mongooplog
+
+import (
+	"fmt"
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+	"strings"
+)
+
+// oplogEntry is an oplog entry with its documents kept in order, since the
+// name of a command has to remain its first field when the entry is applied.
+type oplogEntry struct {
+	Timestamp bson.MongoTimestamp `bson:"ts"`
+	HistoryID int64               `bson:"h"`
+	Version   int                 `bson:"v"`
+	Operation string              `bson:"op"`
+	Namespace string              `bson:"ns"`
+	Object    bson.D              `bson:"o"`
+	Query     bson.D              `bson:"o2,omitempty"`
+}
+
+// collectionCommands are the commands that act on the collection named by
+// their first field.
+var collectionCommands = map[string]bool{
+	"create":          true,
+	"drop":            true,
+	"createIndexes":   true,
+	"dropIndexes":     true,
+	"deleteIndexes":   true,
+	"collMod":         true,
+	"emptycapped":     true,
+	"convertToCapped": true,
+}
+
+// nsPattern matches namespaces, where each '*' matches any run of characters.
+type nsPattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func newNSPattern(pattern string) (*nsPattern, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("namespace pattern can not be empty")
+	}
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	regex, err := regexp.Compile("^" + strings.Join(parts, "(.*)") + "$")
+	if err != nil {
+		return nil, fmt.Errorf("error parsing namespace pattern '%v': %v", pattern, err)
+	}
+	return &nsPattern{pattern: pattern, regex: regex}, nil
+}
+
+// nsRename maps namespaces matching a pattern to a new namespace, in which
+// each '*' is replaced with what the matching '*' in the pattern matched.
+type nsRename struct {
+	from *nsPattern
+	to   string
+}
+
+func (r *nsRename) rename(namespace string) (string, bool) {
+	matches := r.from.regex.FindStringSubmatch(namespace)
+	if matches == nil {
+		return namespace, false
+	}
+	parts := strings.Split(r.to, "*")
+	renamed := parts[0]
+	for i, part := range parts[1:] {
+		renamed += matches[i+1] + part
+	}
+	return renamed, true
+}
+
+// oplogFilter decides which oplog entries are applied, and renames the
+// namespaces of the ones that are.
+type oplogFilter struct {
+	include, exclude []*nsPattern
+	renames          []nsRename
+	ops              map[string]bool
+	skipIndexBuilds  bool
+	skipDropDatabase bool
+}
+
+// newOplogFilter builds the filter described by the options. A nil set of
+// options applies every entry unchanged.
+func newOplogFilter(opts *FilterOptions) (*oplogFilter, error) {
+	filter := &oplogFilter{ops: map[string]bool{"i": true, "u": true, "d": true, "c": true}}
+	if opts == nil {
+		return filter, nil
+	}
+
+	for _, pattern := range opts.NSInclude {
+		ns, err := newNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --nsInclude: %v", err)
+		}
+		filter.include = append(filter.include, ns)
+	}
+	for _, pattern := range opts.NSExclude {
+		ns, err := newNSPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --nsExclude: %v", err)
+		}
+		filter.exclude = append(filter.exclude, ns)
+	}
+
+	if len(opts.NSFrom) != len(opts.NSTo) {
+		return nil, fmt.Errorf("--nsFrom and --nsTo must be given the same number of times")
+	}
+	for i, from := range opts.NSFrom {
+		ns, err := newNSPattern(from)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --nsFrom: %v", err)
+		}
+		if strings.Count(from, "*") != strings.Count(opts.NSTo[i], "*") {
+			return nil, fmt.Errorf("--nsFrom '%v' and --nsTo '%v' must have the same number of '*' wildcards",
+				from, opts.NSTo[i])
+		}
+		filter.renames = append(filter.renames, nsRename{from: ns, to: opts.NSTo[i]})
+	}
+
+	if opts.Ops != "" {
+		filter.ops = map[string]bool{}
+		for _, op := range strings.Split(opts.Ops, ",") {
+			op = strings.TrimSpace(op)
+			switch op {
+			case "i", "u", "d", "c":
+				filter.ops[op] = true
+			default:
+				return nil, fmt.Errorf("--ops can only contain i, u, d and c, not '%v'", op)
+			}
+		}
+	}
+
+	filter.skipIndexBuilds = opts.SkipIndexBuilds
+	filter.skipDropDatabase = opts.SkipDropDatabase
+	return filter, nil
+}
+
+// included returns true if a namespace matches --nsInclude, if given, and
+// doesn't match --nsExclude.
+func (f *oplogFilter) included(namespace string) bool {
+	for _, ns := range f.exclude {
+		if ns.regex.MatchString(namespace) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, ns := range f.include {
+		if ns.regex.MatchString(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// rename returns the namespace given by the first --nsFrom that matches.
+func (f *oplogFilter) rename(namespace string) string {
+	for _, r := range f.renames {
+		if renamed, ok := r.rename(namespace); ok {
+			return renamed
+		}
+	}
+	return namespace
+}
+
+// splitNamespace splits a namespace into its database and collection.
+func splitNamespace(namespace string) (string, string) {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[:i], namespace[i+1:]
+	}
+	return namespace, ""
+}
+
+// docString returns the string value of a field of a document.
+func docString(doc bson.D, name string) (string, int) {
+	for i, elem := range doc {
+		if elem.Name == name {
+			value, _ := elem.Value.(string)
+			return value, i
+		}
+	}
+	return "", -1
+}
+
+// Apply returns true if the oplog entry should be applied, after renaming
+// the namespaces in it as needed.
+func (f *oplogFilter) Apply(entry *oplogEntry) bool {
+	if !f.ops[entry.Operation] {
+		return false
+	}
+	if entry.Operation == "c" {
+		return f.applyCommand(entry)
+	}
+
+	// before 3.2, index builds are inserts of the index spec into
+	// <db>.system.indexes, which names the indexed collection
+	if strings.HasSuffix(entry.Namespace, ".system.indexes") {
+		if f.skipIndexBuilds {
+			return false
+		}
+		indexedNS, i := docString(entry.Object, "ns")
+		if i < 0 {
+			return true
+		}
+		if !f.included(indexedNS) {
+			return false
+		}
+		renamed := f.rename(indexedNS)
+		entry.Object[i].Value = renamed
+		toDB, _ := splitNamespace(renamed)
+		entry.Namespace = toDB + ".system.indexes"
+		return true
+	}
+
+	if !f.included(entry.Namespace) {
+		return false
+	}
+	entry.Namespace = f.rename(entry.Namespace)
+	return true
+}
+
+// applyCommand is Apply for commands, which name the namespaces they act on
+// in their payload.
+func (f *oplogFilter) applyCommand(entry *oplogEntry) bool {
+	if len(entry.Object) == 0 {
+		return true
+	}
+	dbName, _ := splitNamespace(entry.Namespace)
+	command := entry.Object[0].Name
+
+	switch {
+	case command == "renameCollection":
+		// both namespaces are given in full, and the command runs on admin
+		from, _ := entry.Object[0].Value.(string)
+		if !f.included(from) {
+			return false
+		}
+		entry.Object[0].Value = f.rename(from)
+		if to, i := docString(entry.Object, "to"); i >= 0 {
+			entry.Object[i].Value = f.rename(to)
+		}
+		return true
+
+	case collectionCommands[command]:
+		if command == "createIndexes" && f.skipIndexBuilds {
+			return false
+		}
+		collection, _ := entry.Object[0].Value.(string)
+		namespace := dbName + "." + collection
+		if !f.included(namespace) {
+			return false
+		}
+		renamed := f.rename(namespace)
+		toDB, toCollection := splitNamespace(renamed)
+		entry.Namespace = toDB + ".$cmd"
+		entry.Object[0].Value = toCollection
+		if _, i := docString(entry.Object, "ns"); i >= 0 {
+			entry.Object[i].Value = renamed
+		}
+		return true
+
+	default:
+		// dropDatabase and other database commands are matched and renamed
+		// as the namespace '<db>.*', so they are only applied when the
+		// whole database is
+		if command == "dropDatabase" && f.skipDropDatabase {
+			return false
+		}
+		namespace := dbName + ".*"
+		if !f.included(namespace) {
+			return false
+		}
+		toDB, _ := splitNamespace(f.rename(namespace))
+		entry.Namespace = toDB + ".$cmd"
+		return true
+	}
+}
@@ -0,0 +1,128 @@
+package mongooplog
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"testing"
+)
+
+func TestNewOplogFilter(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When building an oplog filter", t, func() {
+
+		Convey("no options apply every operation type", func() {
+			filter, err := newOplogFilter(nil)
+			So(err, ShouldBeNil)
+			So(filter.ops, ShouldResemble, map[string]bool{"i": true, "u": true, "d": true, "c": true})
+		})
+
+		Convey("--ops only accepts known operation types", func() {
+			filter, err := newOplogFilter(&FilterOptions{Ops: "i, u"})
+			So(err, ShouldBeNil)
+			So(filter.ops, ShouldResemble, map[string]bool{"i": true, "u": true})
+			_, err = newOplogFilter(&FilterOptions{Ops: "i,n"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--nsFrom and --nsTo must pair up", func() {
+			_, err := newOplogFilter(&FilterOptions{NSFrom: []string{"a.*"}})
+			So(err, ShouldNotBeNil)
+			_, err = newOplogFilter(&FilterOptions{NSFrom: []string{"a.*"}, NSTo: []string{"b.c"}})
+			So(err, ShouldNotBeNil)
+			_, err = newOplogFilter(&FilterOptions{NSFrom: []string{"a.*"}, NSTo: []string{"b.*"}})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("namespace patterns can not be empty", func() {
+			_, err := newOplogFilter(&FilterOptions{NSInclude: []string{""}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestOplogFilterApply(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a filter replicating part of the sales database", t, func() {
+		filter, err := newOplogFilter(&FilterOptions{
+			NSInclude: []string{"sales.*", "crm.accounts"},
+			NSExclude: []string{"sales.tmp*"},
+			NSFrom:    []string{"sales.*"},
+			NSTo:      []string{"reporting.sales_*"},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("CRUD operations are matched and renamed by namespace", func() {
+			entry := &oplogEntry{Operation: "i", Namespace: "sales.orders"}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "reporting.sales_orders")
+
+			entry = &oplogEntry{Operation: "u", Namespace: "crm.accounts"}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "crm.accounts")
+
+			So(filter.Apply(&oplogEntry{Operation: "d", Namespace: "crm.leads"}), ShouldBeFalse)
+			So(filter.Apply(&oplogEntry{Operation: "i", Namespace: "sales.tmp_1"}), ShouldBeFalse)
+		})
+
+		Convey("collection commands are renamed in their payload", func() {
+			entry := &oplogEntry{Operation: "c", Namespace: "sales.$cmd",
+				Object: bson.D{{"create", "orders"}, {"capped", true}}}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "reporting.$cmd")
+			So(entry.Object, ShouldResemble, bson.D{{"create", "sales_orders"}, {"capped", true}})
+
+			So(filter.Apply(&oplogEntry{Operation: "c", Namespace: "sales.$cmd",
+				Object: bson.D{{"drop", "tmp_1"}}}), ShouldBeFalse)
+		})
+
+		Convey("renameCollection renames both namespaces", func() {
+			entry := &oplogEntry{Operation: "c", Namespace: "admin.$cmd",
+				Object: bson.D{{"renameCollection", "sales.orders"}, {"to", "sales.archive"}}}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "admin.$cmd")
+			So(entry.Object, ShouldResemble, bson.D{
+				{"renameCollection", "reporting.sales_orders"}, {"to", "reporting.sales_archive"}})
+		})
+
+		Convey("old style index builds are matched by the indexed namespace", func() {
+			entry := &oplogEntry{Operation: "i", Namespace: "sales.system.indexes",
+				Object: bson.D{{"ns", "sales.orders"}, {"key", bson.D{{"date", 1}}}, {"name", "date_1"}}}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "reporting.system.indexes")
+			So(entry.Object[0].Value, ShouldEqual, "reporting.sales_orders")
+
+			So(filter.Apply(&oplogEntry{Operation: "i", Namespace: "crm.system.indexes",
+				Object: bson.D{{"ns", "crm.leads"}}}), ShouldBeFalse)
+		})
+
+		Convey("database commands are only applied when the whole database is", func() {
+			entry := &oplogEntry{Operation: "c", Namespace: "sales.$cmd",
+				Object: bson.D{{"dropDatabase", 1}}}
+			So(filter.Apply(entry), ShouldBeTrue)
+			So(entry.Namespace, ShouldEqual, "reporting.$cmd")
+
+			So(filter.Apply(&oplogEntry{Operation: "c", Namespace: "crm.$cmd",
+				Object: bson.D{{"dropDatabase", 1}}}), ShouldBeFalse)
+		})
+
+		Convey("index builds and dropDatabase can be skipped", func() {
+			filter.skipIndexBuilds = true
+			filter.skipDropDatabase = true
+			So(filter.Apply(&oplogEntry{Operation: "c", Namespace: "sales.$cmd",
+				Object: bson.D{{"createIndexes", "orders"}, {"key", bson.D{{"date", 1}}}}}), ShouldBeFalse)
+			So(filter.Apply(&oplogEntry{Operation: "i", Namespace: "sales.system.indexes",
+				Object: bson.D{{"ns", "sales.orders"}}}), ShouldBeFalse)
+			So(filter.Apply(&oplogEntry{Operation: "c", Namespace: "sales.$cmd",
+				Object: bson.D{{"dropDatabase", 1}}}), ShouldBeFalse)
+		})
+
+		Convey("operation types not in --ops are skipped", func() {
+			filter.ops = map[string]bool{"i": true}
+			So(filter.Apply(&oplogEntry{Operation: "i", Namespace: "sales.orders"}), ShouldBeTrue)
+			So(filter.Apply(&oplogEntry{Operation: "u", Namespace: "sales.orders"}), ShouldBeFalse)
+		})
+	})
+}
@@ -21,6 +21,10 @@ func main() {
 	// add the mongooplog-specific options
 	sourceOpts := &mongooplog.SourceOptions{}
 	opts.AddOptions(sourceOpts)
+	filterOpts := &mongooplog.FilterOptions{}
+	opts.AddOptions(filterOpts)
+	applyOpts := &mongooplog.ApplyOptions{}
+	opts.AddOptions(applyOpts)
 
 	// parse the command line options
 	args, err := opts.Parse()
@@ -80,6 +84,8 @@ func main() {
 	oplog := mongooplog.MongoOplog{
 		ToolOptions:         opts,
 		SourceOptions:       sourceOpts,
+		FilterOptions:       filterOpts,
+		ApplyOptions:        applyOpts,
 		SessionProviderFrom: sessionProviderFrom,
 		SessionProviderTo:   sessionProviderTo,
 	}
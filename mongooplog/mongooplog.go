@@ -19,6 +19,8 @@ type MongoOplog struct {
 
 	// mongooplog-specific options
 	SourceOptions *SourceOptions
+	FilterOptions *FilterOptions
+	ApplyOptions  *ApplyOptions
 
 	// session provider for the source server
 	SessionProviderFrom *db.SessionProvider
@@ -45,6 +47,26 @@ func (mo *MongoOplog) Run() error {
 
 	log.Logf(log.DebugLow, "using oplog namespace `%v.%v`", oplogDB, oplogColl)
 
+	filter, err := newOplogFilter(mo.FilterOptions)
+	if err != nil {
+		return err
+	}
+
+	if err = validateStateOptions(mo.SourceOptions); err != nil {
+		return err
+	}
+
+	applyOpts := mo.ApplyOptions
+	if applyOpts == nil {
+		applyOpts = &ApplyOptions{BatchSize: DefaultBatchSize, NumApplyWorkers: 1}
+	}
+	if applyOpts.BatchSize < 1 {
+		return fmt.Errorf("--batchSize must be at least 1")
+	}
+	if applyOpts.NumApplyWorkers < 1 {
+		return fmt.Errorf("--numApplyWorkers must be at least 1")
+	}
+
 	// connect to the destination server
 	toSession, err := mo.SessionProviderTo.GetSession()
 	if err != nil {
@@ -73,76 +95,153 @@ func (mo *MongoOplog) Run() error {
 	// set slave ok
 	fromSession.SetMode(mgo.Eventual, true)
 
+	// start after the last entry applied by an earlier run, if recorded,
+	// and otherwise --seconds ago
+	oplog := fromSession.DB(oplogDB).C(oplogColl)
+	after, resuming, err := mo.getResumeTimestamp(toSession)
+	if err != nil {
+		return err
+	}
+	if resuming {
+		if err = db.CheckOplogGap(oplog, after); err != nil {
+			return gapHint(err)
+		}
+		log.Logf(log.Always, "resuming after oplog timestamp %v", db.FormatTimestamp(after))
+	} else {
+		after = startTimestamp(mo.SourceOptions)
+	}
+
 	// get the tailing cursor for the source server's oplog
-	tail := buildTailingCursor(fromSession.DB(oplogDB).C(oplogColl),
-		mo.SourceOptions)
-	defer tail.Close()
+	tailer := &db.OplogTailer{Oplog: oplog}
+	tail := buildTailingCursor(oplog, mo.SourceOptions, after)
+	defer func() {
+		tail.Close()
+	}()
 
 	// read the cursor dry, applying ops to the destination
 	// server in the process
-	oplogEntry := &db.Oplog{}
-	res := &db.ApplyOpsResponse{}
+	entry := &oplogEntry{}
+	applier := newOplogApplier(toSession, applyOpts, after)
+	skipped := 0
+
+	// record how far the applied ops go, whenever that has changed
+	saved := after
+	saveProgress := func() error {
+		if applier.LastTimestamp == saved {
+			return nil
+		}
+		if err := mo.saveResumeTimestamp(toSession, applier.LastTimestamp); err != nil {
+			return err
+		}
+		saved = applier.LastTimestamp
+		return nil
+	}
 
 	log.Log(log.DebugLow, "applying oplog entries...")
 
-	for tail.Next(oplogEntry) {
-
-		// skip noops
-		if oplogEntry.Operation == "n" {
-			log.Logf(log.DebugHigh, "skipping no-op for namespace `%v`", oplogEntry.Namespace)
-			continue
+	for {
+		for tail.Next(entry) {
+			// skip noops
+			if entry.Operation == "n" {
+				log.Logf(log.DebugHigh, "skipping no-op for namespace `%v`", entry.Namespace)
+				applier.Skip(entry.Timestamp)
+				continue
+			}
+
+			// skip filtered out entries, renaming the namespaces of the rest
+			if !filter.Apply(entry) {
+				log.Logf(log.DebugHigh, "skipping filtered out op '%v' for namespace `%v`",
+					entry.Operation, entry.Namespace)
+				applier.Skip(entry.Timestamp)
+				skipped++
+				continue
+			}
+
+			// queue the op, applying the queued ops when a batch fills up
+			applied := applier.Applied
+			if err := applier.Add(entry); err != nil {
+				return err
+			}
+			if applier.Applied != applied {
+				if err := saveProgress(); err != nil {
+					return err
+				}
+			}
 		}
 
-		// prepare the op to be applied
-		opsToApply := []db.Oplog{*oplogEntry}
-
-		// apply the operation
-		err := toSession.Run(bson.M{"applyOps": opsToApply}, res)
-
-		if err != nil {
-			return fmt.Errorf("error applying ops: %v", err)
+		// apply whatever is left, even if the cursor failed
+		if err := applier.Flush(); err != nil {
+			return err
+		}
+		if err := saveProgress(); err != nil {
+			return err
 		}
 
-		// check the server's response for an issue
-		if !res.Ok {
-			return fmt.Errorf("server gave error applying ops: %v", res.ErrMsg)
+		err := tail.Err()
+		if !mo.SourceOptions.Follow {
+			// make sure there was no tailing error
+			if err != nil {
+				return fmt.Errorf("error querying oplog: %v", err)
+			}
+			break
+		}
+		if err == nil && tail.Timeout() {
+			// no new entries yet, wait again
+			continue
 		}
-	}
 
-	// make sure there was no tailing error
-	if err := tail.Err(); err != nil {
-		return fmt.Errorf("error querying oplog: %v", err)
+		// the cursor was lost or failed, e.g. because the source failed over,
+		// so query again after the last entry applied
+		newTail, err := tailer.Retail(tail, applier.LastTimestamp)
+		if err != nil {
+			return gapHint(err)
+		}
+		tail = newTail
 	}
 
-	log.Log(log.DebugLow, "done applying oplog entries")
+	log.Logf(log.DebugLow, "done applying oplog entries: applied %v, skipped %v filtered out",
+		applier.Applied, skipped)
 
 	return nil
 }
 
-// get the cursor for the oplog collection, based on the options
-// passed in to mongooplog
-func buildTailingCursor(oplog *mgo.Collection,
-	sourceOptions *SourceOptions) *mgo.Iter {
+// gapHint adds why it matters to an error reporting that the oplog no longer
+// holds the entries to apply.
+func gapHint(err error) error {
+	if db.IsOplogGap(err) {
+		return fmt.Errorf("%v, so they can't be applied without a gap", err)
+	}
+	return err
+}
 
+// startTimestamp returns the timestamp to read the oplog after when not
+// resuming: just before --seconds ago.
+func startTimestamp(sourceOptions *SourceOptions) bson.MongoTimestamp {
 	// how many seconds in the past we need
 	secondsInPast := time.Duration(sourceOptions.Seconds) * time.Second
 	// the time threshold for oplog queries
 	threshold := time.Now().Add(-secondsInPast)
-	// convert to a unix timestamp (seconds since epoch)
-	thresholdAsUnix := threshold.Unix()
 
-	// shift it appropriately, to prepare it to be converted to an
-	// oplog timestamp
-	thresholdShifted := uint64(thresholdAsUnix) << 32
+	return db.TimestampFromTime(threshold) - 1
+}
+
+// get the cursor for the oplog collection, based on the options
+// passed in to mongooplog: the entries after the given timestamp, waiting
+// for new ones with --follow
+func buildTailingCursor(oplog *mgo.Collection,
+	sourceOptions *SourceOptions, after bson.MongoTimestamp) *mgo.Iter {
+
+	if sourceOptions.Follow {
+		return db.TailOplog(oplog, nil, after)
+	}
 
 	// build the oplog query
 	oplogQuery := bson.M{
 		"ts": bson.M{
-			"$gte": bson.MongoTimestamp(thresholdShifted),
+			"$gt": after,
 		},
 	}
 
-	// TODO: wait time
 	return oplog.Find(oplogQuery).Iter()
 
 }
@@ -15,9 +15,40 @@ type SourceOptions struct {
 	From    string              `long:"from" description:"specify the host for mongooplog to retrive operations from"`
 	OplogNS string              `long:"oplogns" description:"specify the namespace in the --from host where the oplog lives (default 'local.oplog.rs') " default:"local.oplog.rs" default-mask:"-"`
 	Seconds bson.MongoTimestamp `long:"seconds" short:"s" description:"specify a number of seconds for mongooplog to pull from the remote host" default:"86400"  default-mask:"-"`
+
+	Follow    bool   `long:"follow" description:"keep waiting for new operations and applying them, until interrupted, instead of stopping at the end of the oplog"`
+	StateFile string `long:"stateFile" description:"file to record the timestamp of the last operation applied in; if it exists, operations after that timestamp are applied instead of the last --seconds"`
+	StateNS   string `long:"stateNS" description:"namespace on the destination to record the timestamp of the last operation applied in, as with --stateFile"`
 }
 
 // Name returns a human-readable group name for source options.
 func (_ *SourceOptions) Name() string {
 	return "source"
 }
+
+// FilterOptions defines the set of options to use in choosing which oplog entries are applied, and where.
+type FilterOptions struct {
+	NSInclude        []string `long:"nsInclude" value-name:"<namespace-pattern>" description:"only apply operations on namespaces matching the pattern, in which '*' matches any characters (e.g. 'sales.*'); may be given more than once"`
+	NSExclude        []string `long:"nsExclude" value-name:"<namespace-pattern>" description:"don't apply operations on namespaces matching the pattern; may be given more than once"`
+	NSFrom           []string `long:"nsFrom" value-name:"<namespace-pattern>" description:"rename namespaces matching the pattern to the matching --nsTo; may be given more than once"`
+	NSTo             []string `long:"nsTo" value-name:"<namespace-pattern>" description:"the namespace to apply operations matching the matching --nsFrom to, in which each '*' is replaced with what the '*' in --nsFrom matched"`
+	Ops              string   `long:"ops" value-name:"<op-types>" description:"comma-separated list of the operation types to apply: i (insert), u (update), d (delete) and c (command) (defaults to all)"`
+	SkipIndexBuilds  bool     `long:"skipIndexBuilds" description:"don't apply index builds"`
+	SkipDropDatabase bool     `long:"skipDropDatabase" description:"don't apply dropDatabase commands"`
+}
+
+// Name returns a human-readable group name for filter options.
+func (_ *FilterOptions) Name() string {
+	return "filter"
+}
+
+// ApplyOptions defines the set of options to use in applying oplog entries to the destination server.
+type ApplyOptions struct {
+	BatchSize       int `long:"batchSize" value-name:"<count>" description:"maximum number of operations to apply with each applyOps command (defaults to 1000)" default:"1000" default-mask:"-"`
+	NumApplyWorkers int `long:"numApplyWorkers" short:"j" value-name:"<count>" description:"number of applyOps commands to run in parallel; operations are split between them by namespace and document _id, so each document's operations stay in order (defaults to 1)" default:"1" default-mask:"-"`
+}
+
+// Name returns a human-readable group name for apply options.
+func (_ *ApplyOptions) Name() string {
+	return "apply"
+}
@@ -0,0 +1,89 @@
+package mongooplog
+
+import (
+	"fmt"
+	"github.com/dezmodue/mongo-tools/common/db"
+	"github.com/dezmodue/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The timestamp of the last oplog entry applied is recorded in the
+// --stateFile, or in a document of the --stateNS collection on the
+// destination, so that a later run resumes right after it. The document's
+// _id names the source oplog, so that one collection can hold the state of
+// several sources.
+
+// validateStateOptions checks the options recording the resume timestamp.
+func validateStateOptions(opts *SourceOptions) error {
+	if opts.StateFile != "" && opts.StateNS != "" {
+		return fmt.Errorf("--stateFile and --stateNS can not be used together")
+	}
+	if opts.StateNS != "" {
+		_, collection, err := util.SplitAndValidateNamespace(opts.StateNS)
+		if err != nil {
+			return fmt.Errorf("error parsing --stateNS: %v", err)
+		}
+		if collection == "" {
+			return fmt.Errorf("--stateNS must specify a collection")
+		}
+	}
+	return nil
+}
+
+// stateID returns the _id of the --stateNS document for the source oplog.
+func (mo *MongoOplog) stateID() string {
+	return mo.SourceOptions.From + "/" + mo.SourceOptions.OplogNS
+}
+
+// stateCollection returns the --stateNS collection on the destination.
+func (mo *MongoOplog) stateCollection(toSession *mgo.Session) *mgo.Collection {
+	dbName, collection, _ := util.SplitAndValidateNamespace(mo.SourceOptions.StateNS)
+	return toSession.DB(dbName).C(collection)
+}
+
+// getResumeTimestamp returns the timestamp of the last entry applied by an
+// earlier run, from the --stateFile or --stateNS, and false if neither has
+// one.
+func (mo *MongoOplog) getResumeTimestamp(toSession *mgo.Session) (bson.MongoTimestamp, bool, error) {
+	if mo.SourceOptions.StateNS != "" {
+		state := struct {
+			Timestamp bson.MongoTimestamp `bson:"ts"`
+		}{}
+		err := mo.stateCollection(toSession).FindId(mo.stateID()).One(&state)
+		if err == mgo.ErrNotFound {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, fmt.Errorf("error reading state from %v: %v", mo.SourceOptions.StateNS, err)
+		}
+		return state.Timestamp, true, nil
+	}
+
+	if mo.SourceOptions.StateFile != "" {
+		ts, ok, err := db.ReadTimestampFile(mo.SourceOptions.StateFile)
+		if err != nil {
+			return 0, false, fmt.Errorf("error reading --stateFile: %v", err)
+		}
+		return ts, ok, nil
+	}
+	return 0, false, nil
+}
+
+// saveResumeTimestamp records the timestamp of the last entry applied, so
+// that the next run starts right after it.
+func (mo *MongoOplog) saveResumeTimestamp(toSession *mgo.Session, ts bson.MongoTimestamp) error {
+	if mo.SourceOptions.StateNS != "" {
+		_, err := mo.stateCollection(toSession).UpsertId(mo.stateID(), bson.M{"$set": bson.M{"ts": ts}})
+		if err != nil {
+			return fmt.Errorf("error writing state to %v: %v", mo.SourceOptions.StateNS, err)
+		}
+		return nil
+	}
+	if mo.SourceOptions.StateFile != "" {
+		if err := db.WriteTimestampFile(mo.SourceOptions.StateFile, ts); err != nil {
+			return fmt.Errorf("error writing --stateFile: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package mongooplog
+
+import (
+	"github.com/dezmodue/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateStateOptions(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("When validating the state options", t, func() {
+		So(validateStateOptions(&SourceOptions{}), ShouldBeNil)
+		So(validateStateOptions(&SourceOptions{StateNS: "mongooplog.state"}), ShouldBeNil)
+		So(validateStateOptions(&SourceOptions{StateNS: "mongooplog"}), ShouldNotBeNil)
+		So(validateStateOptions(&SourceOptions{StateNS: "mongooplog.state",
+			StateFile: "state"}), ShouldNotBeNil)
+	})
+}
+
+func TestStateFile(t *testing.T) {
+	testutil.VerifyTestType(t, testutil.UnitTestType)
+
+	Convey("With a --stateFile", t, func() {
+		dir, err := ioutil.TempDir("", "mongooplog_state")
+		So(err, ShouldBeNil)
+		mo := &MongoOplog{SourceOptions: &SourceOptions{StateFile: filepath.Join(dir, "state")}}
+
+		Convey("there is nothing to resume from until a timestamp is saved", func() {
+			_, resuming, err := mo.getResumeTimestamp(nil)
+			So(err, ShouldBeNil)
+			So(resuming, ShouldBeFalse)
+
+			ts := bson.MongoTimestamp(1437000000<<32 | 7)
+			So(mo.saveResumeTimestamp(nil, ts), ShouldBeNil)
+			contents, err := ioutil.ReadFile(mo.SourceOptions.StateFile)
+			So(err, ShouldBeNil)
+			So(string(contents), ShouldEqual, "1437000000:7\n")
+
+			after, resuming, err := mo.getResumeTimestamp(nil)
+			So(err, ShouldBeNil)
+			So(resuming, ShouldBeTrue)
+			So(after, ShouldEqual, ts)
+		})
+
+		Convey("a state file that doesn't hold a timestamp is an error", func() {
+			So(ioutil.WriteFile(mo.SourceOptions.StateFile, []byte("garbage"), 0644), ShouldBeNil)
+			_, _, err := mo.getResumeTimestamp(nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
@@ -8,8 +8,6 @@ import (
 	"github.com/dezmodue/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"strconv"
-	"strings"
 	"time"
 )
 
@@ -140,30 +138,5 @@ func (restore *MongoRestore) TimestampBeforeLimit(ts bson.MongoTimestamp) bool {
 // a counter of operations in the oplog that occurred in the specified second.
 // It parses this timestamp string and returns a bson.MongoTimestamp type.
 func ParseTimestampFlag(ts string) (bson.MongoTimestamp, error) {
-	var seconds, increment int
-	timestampFields := strings.Split(ts, ":")
-	if len(timestampFields) > 2 {
-		return 0, fmt.Errorf("too many : characters")
-	}
-
-	seconds, err := strconv.Atoi(timestampFields[0])
-	if err != nil {
-		return 0, fmt.Errorf("error parsing timestamp seconds: %v", err)
-	}
-
-	// parse the increment field if it exists
-	if len(timestampFields) == 2 {
-		if len(timestampFields[1]) > 0 {
-			increment, err = strconv.Atoi(timestampFields[1])
-			if err != nil {
-				return 0, fmt.Errorf("error parsing timestamp increment: %v", err)
-			}
-		} else {
-			// handle the case where the user writes "<time_t>:" with no ordinal
-			increment = 0
-		}
-	}
-
-	timestamp := (int64(seconds) << 32) | int64(increment)
-	return bson.MongoTimestamp(timestamp), nil
+	return db.ParseTimestamp(ts)
 }